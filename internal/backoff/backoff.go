@@ -0,0 +1,17 @@
+// Package backoff computes retry delays for background deliveries.
+package backoff
+
+import "time"
+
+// Exponential returns base doubled for every attempt after the first, capped at max.
+func Exponential(attempt int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+
+	return delay
+}
@@ -0,0 +1,68 @@
+package databasehandler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	infrastructure "weather_subscription/internal/db/database_repository/infrastracture"
+	models "weather_subscription/internal/db/models"
+)
+
+var ErrInvalidAirQualityPreferences = errors.New("invalid air quality preferences")
+
+// normalizeAirQualityPreferences validates the scale, defaulting to EPA, and
+// the alert threshold against it.
+func normalizeAirQualityPreferences(preferences *models.AirQualityPreferences) error {
+	if preferences.Scale == "" {
+		preferences.Scale = models.AQIScaleEPA
+	}
+	scale, ok := models.ParseAQIScale(string(preferences.Scale))
+	if !ok {
+		return fmt.Errorf("%w: scale must be 'epa' or 'defra'", ErrInvalidAirQualityPreferences)
+	}
+	preferences.Scale = scale
+
+	if preferences.AlertThreshold < 0 || preferences.AlertThreshold > scale.MaxIndex() {
+		return fmt.Errorf("%w: alert threshold must be between 0 (off) and %d on the %s scale", ErrInvalidAirQualityPreferences, scale.MaxIndex(), scale)
+	}
+
+	return nil
+}
+
+// UpdateAirQualityPreferences changes the air quality settings of one of the
+// subscriber's city subscriptions.
+func UpdateAirQualityPreferences(ctx context.Context, email string, id uint, preferences models.AirQualityPreferences) error {
+	if err := normalizeAirQualityPreferences(&preferences); err != nil {
+		return err
+	}
+
+	if err := dbHandler.weatherServiceRepository.UpdateAirQualityPreferences(ctx, email, id, preferences); err != nil {
+		if errors.Is(err, infrastructure.ErrNotFound) {
+			return ErrSubscriptionNotFound
+		}
+		return errors.New("failed to update air quality preferences")
+	}
+
+	return nil
+}
+
+func ListAirQualityAlertSubscriptions(ctx context.Context) ([]*models.Subscription, error) {
+	subscriptions, err := dbHandler.weatherServiceRepository.ListAirQualityAlertSubscriptions(ctx)
+	if err != nil {
+		return nil, errors.New("failed to list air quality alert subscriptions")
+	}
+
+	return subscriptions, nil
+}
+
+// SetAirQualityAlertTriggered records the subscription's air quality alert
+// state, returning false if it was already in that state.
+func SetAirQualityAlertTriggered(ctx context.Context, id uint, triggered bool) (bool, error) {
+	changed, err := dbHandler.weatherServiceRepository.SetAirQualityAlertTriggered(ctx, id, triggered)
+	if err != nil {
+		return false, errors.New("failed to update air quality alert state")
+	}
+
+	return changed, nil
+}
@@ -0,0 +1,93 @@
+package databasehandler
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	infrastructure "weather_subscription/internal/db/database_repository/infrastracture"
+	models "weather_subscription/internal/db/models"
+)
+
+var ErrInvalidAlertPreferences = errors.New("invalid alert preferences")
+
+// normalizeAlertPreferences validates the minimum severity, defaulting to
+// moderate, and drops blank categories.
+func normalizeAlertPreferences(preferences *models.AlertPreferences) error {
+	if preferences.MinSeverity == "" {
+		preferences.MinSeverity = models.SeverityModerate
+	}
+	severity, ok := models.ParseAlertSeverity(string(preferences.MinSeverity))
+	if !ok {
+		return ErrInvalidAlertPreferences
+	}
+	preferences.MinSeverity = severity
+
+	categories := []string{}
+	for _, category := range preferences.Categories {
+		if category != "" {
+			categories = append(categories, category)
+		}
+	}
+	preferences.Categories = categories
+
+	return nil
+}
+
+// UpdateAlertPreferences changes the weather alert settings of one of the
+// subscriber's city subscriptions.
+func UpdateAlertPreferences(ctx context.Context, email string, id uint, preferences models.AlertPreferences) error {
+	if err := normalizeAlertPreferences(&preferences); err != nil {
+		return err
+	}
+
+	if err := dbHandler.weatherServiceRepository.UpdateAlertPreferences(ctx, email, id, preferences); err != nil {
+		if errors.Is(err, infrastructure.ErrNotFound) {
+			return ErrSubscriptionNotFound
+		}
+		return errors.New("failed to update alert preferences")
+	}
+
+	return nil
+}
+
+func ListAlertSubscriptions(ctx context.Context) ([]*models.Subscription, error) {
+	subscriptions, err := dbHandler.weatherServiceRepository.ListAlertSubscriptions(ctx)
+	if err != nil {
+		return nil, errors.New("failed to list alert subscriptions")
+	}
+
+	return subscriptions, nil
+}
+
+// RecordSentAlert claims the alert for the subscription, returning false if
+// it was already sent.
+func RecordSentAlert(ctx context.Context, subscriptionID uint, alert *models.WeatherAlert) (bool, error) {
+	recorded, err := dbHandler.weatherServiceRepository.RecordSentAlert(ctx, subscriptionID, alert.Headline, alert.Effective, alert.Expires)
+	if err != nil {
+		return false, errors.New("failed to record sent alert")
+	}
+
+	return recorded, nil
+}
+
+// ForgetSentAlert releases an alert claimed by RecordSentAlert whose email
+// could not be sent.
+func ForgetSentAlert(ctx context.Context, subscriptionID uint, alert *models.WeatherAlert) error {
+	if err := dbHandler.weatherServiceRepository.ForgetSentAlert(ctx, subscriptionID, alert.Headline, alert.Effective); err != nil {
+		return errors.New("failed to forget sent alert")
+	}
+
+	return nil
+}
+
+// PurgeExpiredSentAlerts deletes records of alerts that expired before the
+// cutoff; they can no longer be reported again.
+func PurgeExpiredSentAlerts(ctx context.Context, before time.Time) (int64, error) {
+	purged, err := dbHandler.weatherServiceRepository.PurgeExpiredSentAlerts(ctx, before)
+	if err != nil {
+		return 0, errors.New("failed to purge sent alerts")
+	}
+
+	return purged, nil
+}
@@ -2,37 +2,253 @@ package databasehandler
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
+	infrastructure "weather_subscription/internal/db/database_repository/infrastracture"
 	models "weather_subscription/internal/db/models"
+	"weather_subscription/internal/schedule"
 
 	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
 )
 
-func CreateSubscription(ctx context.Context, email, city string, frequency models.SubscriptionFrequency) (*string, error) {
+const (
+	confirmationTTLKey     = "subscription.confirmationTTL"
+	defaultConfirmationTTL = 24 * time.Hour
+)
+
+var (
+	ErrSubscriptionExists   = errors.New("subscription already exists")
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+	ErrTokenNotFound        = errors.New("confirmation token not found")
+	ErrTokenExpired         = errors.New("confirmation token has expired")
+	ErrAlreadyConfirmed     = errors.New("subscription is already confirmed")
+	ErrInvalidSchedule      = errors.New("invalid schedule")
+	ErrInvalidKind          = errors.New("invalid subscription kind")
+	ErrInvalidLanguage      = errors.New("invalid language")
+)
+
+// minScheduleInterval keeps custom schedules from flooding subscribers.
+const minScheduleInterval = time.Hour
+
+// confirmationTTL is how long a confirmation token stays valid.
+func confirmationTTL() time.Duration {
+	if ttl := viper.GetDuration(confirmationTTLKey); ttl > 0 {
+		return ttl
+	}
+
+	return defaultConfirmationTTL
+}
+
+// CreateSubscription adds a city subscription for the subscriber with the
+// subscription's email, creating the subscriber on first use. The
+// subscription is updated with its ID and tokens.
+func CreateSubscription(ctx context.Context, subscription *models.Subscription) (*string, error) {
+
+	switch subscription.Kind {
+	case "":
+		subscription.Kind = models.WeatherKind
+	case models.WeatherKind:
+	case models.MarineKind, models.AstronomyKind:
+		// Marine reports and astronomy digests cover a whole day.
+		if subscription.Frequency == models.Hourly {
+			return nil, fmt.Errorf("%w: %s reports are sent daily or on a custom schedule", ErrInvalidSchedule, subscription.Kind)
+		}
+	default:
+		return nil, fmt.Errorf("%w %q: must be 'weather', 'marine' or 'astronomy'", ErrInvalidKind, subscription.Kind)
+	}
+
+	switch subscription.Frequency {
+	case models.Daily, models.Hourly:
+		subscription.Schedule = ""
+	case models.Custom:
+		if err := validateSchedule(subscription.Schedule); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("invalid frequency: must be 'daily', 'hourly' or 'custom'")
+	}
+	if subscription.DeliveryHour < 0 || subscription.DeliveryHour > 23 {
+		return nil, errors.New("invalid delivery hour: must be between 0 and 23")
+	}
+	if subscription.Timezone == "" {
+		subscription.Timezone = "UTC"
+	}
+	if subscription.Language == "" {
+		subscription.Language = models.DefaultLanguage
+	}
+	language, ok := models.ParseLanguage(subscription.Language)
+	if !ok {
+		return nil, fmt.Errorf("%w %q: must be one of %s", ErrInvalidLanguage, subscription.Language, strings.Join(models.Languages, ", "))
+	}
+	subscription.Language = language
+	channels, err := normalizeChannels(subscription.Channels)
+	if err != nil {
+		return nil, err
+	}
+	subscription.Channels = channels
+	if err := normalizeAlertPreferences(&subscription.Alerts); err != nil {
+		return nil, err
+	}
+	if err := normalizeAirQualityPreferences(&subscription.AirQuality); err != nil {
+		return nil, err
+	}
+	token := uuid.New().String()
+
+	// The subscription and its confirmation email are committed together, so the
+	// email is never lost and never sent for a subscription that was rolled back.
+	tx, err := dbHandler.weatherServiceRepository.BeginTx(ctx)
+	if err != nil {
+		return nil, errors.New("failed to create subscription")
+	}
+	defer dbHandler.weatherServiceRepository.RollbackTx(ctx, tx, log.Logger)
+
+	subscriber, err := dbHandler.weatherServiceRepository.UpsertSubscriber(ctx, tx, subscription.Email)
+	if err != nil {
+		return nil, errors.New("failed to create subscriber")
+	}
+
+	subscription.SubscriberID = subscriber.ID
+	subscription.Token = token
+	subscription.UnsubscribeToken = uuid.New().String()
+	subscription.Confirmed = false
+	subscription.Active = true
+
+	if err := dbHandler.weatherServiceRepository.CreateSubscription(ctx, tx, subscription, confirmationTTL()); err != nil {
+		if errors.Is(err, infrastructure.ErrAlreadyExists) {
+			return nil, ErrSubscriptionExists
+		}
+		return nil, errors.New("failed to create subscription")
+	}
+
+	if err := enqueueConfirmationEmail(ctx, tx, subscription); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, errors.New("failed to create subscription")
+	}
+
+	return &token, nil
+}
+
+// validateSchedule checks that a custom schedule parses and does not fire
+// more often than minScheduleInterval.
+func validateSchedule(expr string) error {
+	spec, err := schedule.Parse(expr)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+
+	now := time.Now().UTC()
+	if spec.Next(now).IsZero() {
+		return fmt.Errorf("%w: %q never fires", ErrInvalidSchedule, expr)
+	}
+	if interval := spec.MinInterval(now, 48); interval > 0 && interval < minScheduleInterval {
+		return fmt.Errorf("%w: %q fires more often than every %s", ErrInvalidSchedule, expr, minScheduleInterval)
+	}
+
+	return nil
+}
 
-	if frequency != models.Daily && frequency != models.Hourly {
-		return nil, errors.New("invalid frequency: must be 'daily' or 'hourly'")
+// ResendConfirmation issues a fresh confirmation token for the pending
+// subscription with the email, kind, city and location of the given one and
+// queues a new confirmation email. It returns ErrRecentlySent if a
+// confirmation email went to the address within emailCooldown.
+func ResendConfirmation(ctx context.Context, subscription *models.Subscription) (*string, error) {
+	recent, err := recentlyEmailed(ctx, models.ConfirmationEmail, subscription.Email)
+	if err != nil {
+		return nil, err
 	}
+	if recent {
+		return nil, ErrRecentlySent
+	}
+
 	token := uuid.New().String()
-	subscription := &models.Subscription{
-		Email:     email,
-		City:      city,
-		Frequency: frequency,
-		Token:     token,
-		Active:    false,
+
+	tx, err := dbHandler.weatherServiceRepository.BeginTx(ctx)
+	if err != nil {
+		return nil, errors.New("failed to renew confirmation token")
+	}
+	defer dbHandler.weatherServiceRepository.RollbackTx(ctx, tx, log.Logger)
+
+	subscription, err = dbHandler.weatherServiceRepository.RenewConfirmationToken(ctx, tx, subscription, token, confirmationTTL())
+	if err != nil {
+		switch {
+		case errors.Is(err, infrastructure.ErrNotFound):
+			return nil, ErrSubscriptionNotFound
+		case errors.Is(err, infrastructure.ErrConflict):
+			return nil, ErrAlreadyConfirmed
+		default:
+			return nil, errors.New("failed to renew confirmation token")
+		}
 	}
 
-	if err := dbHandler.weatherServiceRepository.CreateSubscription(ctx, subscription); err != nil {
-		return nil, errors.New("subscription already exists")
+	if err := enqueueConfirmationEmail(ctx, tx, subscription); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, errors.New("failed to renew confirmation token")
 	}
 
 	return &token, nil
 }
 
-func DeleteSubscription(ctx context.Context, email string) error {
+func enqueueConfirmationEmail(ctx context.Context, tx infrastructure.Tx, subscription *models.Subscription) error {
+	payload, err := json.Marshal(models.ConfirmationEmailPayload{
+		City:     subscription.City,
+		Token:    subscription.Token,
+		Language: subscription.Language,
+	})
+	if err != nil {
+		return errors.New("failed to encode confirmation email")
+	}
+
+	if err := dbHandler.weatherServiceRepository.EnqueueOutboxMessage(ctx, tx, &models.OutboxMessage{
+		Kind:      models.ConfirmationEmail,
+		Recipient: subscription.Email,
+		Payload:   payload,
+	}); err != nil {
+		return errors.New("failed to enqueue confirmation email")
+	}
+
+	return nil
+}
+
+func ListSubscriptions(ctx context.Context, email string) ([]*models.Subscription, error) {
+	subscriptions, err := dbHandler.weatherServiceRepository.ListSubscriptions(ctx, email)
+	if err != nil {
+		return nil, errors.New("failed to list subscriptions")
+	}
+
+	return subscriptions, nil
+}
+
+// RemoveSubscription cancels a single city subscription of the subscriber.
+func RemoveSubscription(ctx context.Context, email string, id uint) error {
+	if err := dbHandler.weatherServiceRepository.RemoveSubscription(ctx, email, id); err != nil {
+		if errors.Is(err, infrastructure.ErrNotFound) {
+			return ErrSubscriptionNotFound
+		}
+		return errors.New("failed to remove subscription")
+	}
+
+	return nil
+}
+
+// Unsubscribe cancels the subscription the unsubscribe token was issued for.
+func Unsubscribe(ctx context.Context, unsubscribeToken string) error {
 
-	if err := dbHandler.weatherServiceRepository.DeleteSubscription(ctx, email); err != nil {
+	if err := dbHandler.weatherServiceRepository.Unsubscribe(ctx, unsubscribeToken); err != nil {
+		if errors.Is(err, infrastructure.ErrNotFound) {
+			return ErrSubscriptionNotFound
+		}
 		return errors.New("failed to delete subscription")
 	}
 
@@ -42,12 +258,31 @@ func DeleteSubscription(ctx context.Context, email string) error {
 func ConfirmSubscription(ctx context.Context, token string) error {
 
 	if err := dbHandler.weatherServiceRepository.ConfirmSubscription(ctx, token); err != nil {
-		return errors.New("failed to confirm subscription")
+		switch {
+		case errors.Is(err, infrastructure.ErrNotFound):
+			return ErrTokenNotFound
+		case errors.Is(err, infrastructure.ErrExpired):
+			return ErrTokenExpired
+		case errors.Is(err, infrastructure.ErrConflict):
+			return ErrAlreadyConfirmed
+		default:
+			return errors.New("failed to confirm subscription")
+		}
 	}
 
 	return nil
 }
 
+// PurgeUnconfirmedSubscriptions deletes subscriptions left unconfirmed for longer than olderThan.
+func PurgeUnconfirmedSubscriptions(ctx context.Context, olderThan time.Duration) (int64, error) {
+	purged, err := dbHandler.weatherServiceRepository.PurgeUnconfirmedSubscriptions(ctx, olderThan)
+	if err != nil {
+		return 0, errors.New("failed to purge unconfirmed subscriptions")
+	}
+
+	return purged, nil
+}
+
 func ListActiveSubscriptions(ctx context.Context) ([]*models.Subscription, error) {
 	subsciptions, err := dbHandler.weatherServiceRepository.ListActiveSubscriptions(ctx)
 	if err != nil {
@@ -0,0 +1,239 @@
+package databasehandler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+
+	infrastructure "weather_subscription/internal/db/database_repository/infrastracture"
+	models "weather_subscription/internal/db/models"
+	"weather_subscription/internal/netguard"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrInvalidChannel     = errors.New("invalid delivery channel")
+	ErrChannelNotFound    = errors.New("delivery channel not found")
+	ErrChannelExists      = errors.New("delivery channel already exists")
+	ErrChannelConfirmed   = errors.New("delivery channel is already confirmed")
+	ErrSubscriberNotFound = errors.New("subscriber not found")
+)
+
+// telegramChat matches a numeric chat id, negative for groups, or a public
+// @channelusername.
+var telegramChat = regexp.MustCompile(`^(-?[0-9]+|@[A-Za-z][A-Za-z0-9_]{4,31})$`)
+
+// normalizeChannels validates the kinds of channels a subscription is
+// delivered to, defaulting to email, and drops duplicates.
+func normalizeChannels(channels []models.ChannelKind) ([]models.ChannelKind, error) {
+	if len(channels) == 0 {
+		return []models.ChannelKind{models.EmailChannel}, nil
+	}
+
+	normalized := make([]models.ChannelKind, 0, len(channels))
+	for _, channel := range channels {
+		kind, ok := models.ParseChannelKind(string(channel))
+		if !ok {
+			return nil, fmt.Errorf("%w %q: must be 'email', 'webhook', 'slack' or 'telegram'", ErrInvalidChannel, channel)
+		}
+		if !containsChannel(normalized, kind) {
+			normalized = append(normalized, kind)
+		}
+	}
+
+	return normalized, nil
+}
+
+func containsChannel(channels []models.ChannelKind, kind models.ChannelKind) bool {
+	for _, channel := range channels {
+		if channel == kind {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validateChannelTarget checks that the target suits the channel's kind.
+func validateChannelTarget(channel *models.DeliveryChannel) error {
+	channel.Target = strings.TrimSpace(channel.Target)
+
+	switch channel.Kind {
+	case models.WebhookChannel, models.SlackChannel:
+		target, err := url.Parse(channel.Target)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			return fmt.Errorf("%w: %s target must be an http or https URL", ErrInvalidChannel, channel.Kind)
+		}
+		// Host names are checked again when connecting, once resolved.
+		host := target.Hostname()
+		if ip := net.ParseIP(host); strings.EqualFold(host, "localhost") || (ip != nil && !netguard.IsPublic(ip)) {
+			return fmt.Errorf("%w: %s target must be a public address", ErrInvalidChannel, channel.Kind)
+		}
+	case models.TelegramChannel:
+		if !telegramChat.MatchString(channel.Target) {
+			return fmt.Errorf("%w: telegram target must be a chat id or an @username", ErrInvalidChannel)
+		}
+	case models.EmailChannel:
+		return fmt.Errorf("%w: the email channel is the subscriber's own address", ErrInvalidChannel)
+	default:
+		return fmt.Errorf("%w %q: must be 'webhook', 'slack' or 'telegram'", ErrInvalidChannel, channel.Kind)
+	}
+
+	return nil
+}
+
+// CreateChannel registers a delivery channel for an existing subscriber and
+// queues the message that confirms it. Webhooks without a secret get a
+// generated one. The channel is updated with its ID, token and secret.
+func CreateChannel(ctx context.Context, email, language string, channel *models.DeliveryChannel) error {
+	kind, _ := models.ParseChannelKind(string(channel.Kind))
+	channel.Kind = kind
+	if err := validateChannelTarget(channel); err != nil {
+		return err
+	}
+	if language == "" {
+		language = models.DefaultLanguage
+	}
+	language, ok := models.ParseLanguage(language)
+	if !ok {
+		return fmt.Errorf("%w %q: must be one of %s", ErrInvalidLanguage, language, strings.Join(models.Languages, ", "))
+	}
+
+	if channel.Kind != models.WebhookChannel {
+		channel.Secret = ""
+	} else if channel.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return errors.New("failed to generate webhook secret")
+		}
+		channel.Secret = hex.EncodeToString(secret)
+	} else if len(channel.Secret) > 64 {
+		return fmt.Errorf("%w: webhook secret must be at most 64 characters", ErrInvalidChannel)
+	}
+	channel.Token = uuid.New().String()
+	channel.Confirmed = false
+
+	// As with subscriptions, the channel and its confirmation are committed
+	// together.
+	tx, err := dbHandler.weatherServiceRepository.BeginTx(ctx)
+	if err != nil {
+		return errors.New("failed to create delivery channel")
+	}
+	defer dbHandler.weatherServiceRepository.RollbackTx(ctx, tx, log.Logger)
+
+	if err := dbHandler.weatherServiceRepository.CreateChannel(ctx, tx, email, channel); err != nil {
+		switch {
+		case errors.Is(err, infrastructure.ErrNotFound):
+			return ErrSubscriberNotFound
+		case errors.Is(err, infrastructure.ErrAlreadyExists):
+			return ErrChannelExists
+		default:
+			return errors.New("failed to create delivery channel")
+		}
+	}
+
+	payload, err := json.Marshal(models.ChannelConfirmationPayload{
+		ChannelID: channel.ID,
+		Token:     channel.Token,
+		Language:  language,
+	})
+	if err != nil {
+		return errors.New("failed to encode channel confirmation")
+	}
+	if err := dbHandler.weatherServiceRepository.EnqueueOutboxMessage(ctx, tx, &models.OutboxMessage{
+		Kind:      models.ChannelConfirmation,
+		Recipient: channel.Target,
+		Payload:   payload,
+	}); err != nil {
+		return errors.New("failed to enqueue channel confirmation")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return errors.New("failed to create delivery channel")
+	}
+
+	return nil
+}
+
+func ListChannels(ctx context.Context, email string) ([]*models.DeliveryChannel, error) {
+	channels, err := dbHandler.weatherServiceRepository.ListChannels(ctx, email)
+	if err != nil {
+		return nil, errors.New("failed to list delivery channels")
+	}
+
+	return channels, nil
+}
+
+func ListConfirmedChannels(ctx context.Context, subscriberID uint) ([]*models.DeliveryChannel, error) {
+	channels, err := dbHandler.weatherServiceRepository.ListConfirmedChannels(ctx, subscriberID)
+	if err != nil {
+		return nil, errors.New("failed to list delivery channels")
+	}
+
+	return channels, nil
+}
+
+func GetChannel(ctx context.Context, id uint) (*models.DeliveryChannel, error) {
+	channel, err := dbHandler.weatherServiceRepository.GetChannel(ctx, id)
+	if err != nil {
+		if errors.Is(err, infrastructure.ErrNotFound) {
+			return nil, ErrChannelNotFound
+		}
+		return nil, errors.New("failed to get delivery channel")
+	}
+
+	return channel, nil
+}
+
+func ConfirmChannel(ctx context.Context, token string) error {
+	if err := dbHandler.weatherServiceRepository.ConfirmChannel(ctx, token); err != nil {
+		switch {
+		case errors.Is(err, infrastructure.ErrNotFound):
+			return ErrTokenNotFound
+		case errors.Is(err, infrastructure.ErrConflict):
+			return ErrChannelConfirmed
+		default:
+			return errors.New("failed to confirm delivery channel")
+		}
+	}
+
+	return nil
+}
+
+func DeleteChannel(ctx context.Context, email string, id uint) error {
+	if err := dbHandler.weatherServiceRepository.DeleteChannel(ctx, email, id); err != nil {
+		if errors.Is(err, infrastructure.ErrNotFound) {
+			return ErrChannelNotFound
+		}
+		return errors.New("failed to delete delivery channel")
+	}
+
+	return nil
+}
+
+// UpdateSubscriptionChannels changes the kinds of channels one of the
+// subscriber's city subscriptions is delivered to.
+func UpdateSubscriptionChannels(ctx context.Context, email string, id uint, channels []models.ChannelKind) ([]models.ChannelKind, error) {
+	channels, err := normalizeChannels(channels)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := dbHandler.weatherServiceRepository.UpdateSubscriptionChannels(ctx, email, id, channels); err != nil {
+		if errors.Is(err, infrastructure.ErrNotFound) {
+			return nil, ErrSubscriptionNotFound
+		}
+		return nil, errors.New("failed to update subscription channels")
+	}
+
+	return channels, nil
+}
@@ -0,0 +1,62 @@
+package databasehandler
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	infrastructure "weather_subscription/internal/db/database_repository/infrastracture"
+	models "weather_subscription/internal/db/models"
+)
+
+// ErrLeaseLost means a delivery job is no longer running under the worker's
+// claim: its lease expired and another worker claimed it.
+var ErrLeaseLost = errors.New("delivery job lease lost")
+
+func EnqueueDeliveryJob(ctx context.Context, subscriptionID uint, scheduledFor time.Time) error {
+	if err := dbHandler.weatherServiceRepository.EnqueueDeliveryJob(ctx, subscriptionID, scheduledFor); err != nil {
+		return errors.New("failed to enqueue delivery job")
+	}
+
+	return nil
+}
+
+func ClaimDeliveryJobs(ctx context.Context, limit int, lease time.Duration) ([]*models.DeliveryJob, error) {
+	jobs, err := dbHandler.weatherServiceRepository.ClaimDeliveryJobs(ctx, limit, lease)
+	if err != nil {
+		return nil, errors.New("failed to claim delivery jobs")
+	}
+
+	return jobs, nil
+}
+
+func ExtendDeliveryJobLeases(ctx context.Context, jobs []*models.DeliveryJob, lease time.Duration) error {
+	if err := dbHandler.weatherServiceRepository.ExtendDeliveryJobLeases(ctx, jobs, lease); err != nil {
+		return errors.New("failed to extend delivery job leases")
+	}
+
+	return nil
+}
+
+func MarkDeliveryJobSent(ctx context.Context, job *models.DeliveryJob) error {
+	return claimedJob(dbHandler.weatherServiceRepository.MarkDeliveryJobSent(ctx, job), "failed to mark delivery job as sent")
+}
+
+func RescheduleDeliveryJob(ctx context.Context, job *models.DeliveryJob, lastError string, delay time.Duration) error {
+	return claimedJob(dbHandler.weatherServiceRepository.RescheduleDeliveryJob(ctx, job, lastError, delay), "failed to reschedule delivery job")
+}
+
+func FailDeliveryJob(ctx context.Context, job *models.DeliveryJob, lastError string) error {
+	return claimedJob(dbHandler.weatherServiceRepository.FailDeliveryJob(ctx, job, lastError), "failed to mark delivery job as failed")
+}
+
+func claimedJob(err error, message string) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, infrastructure.ErrConflict):
+		return ErrLeaseLost
+	default:
+		return errors.New(message)
+	}
+}
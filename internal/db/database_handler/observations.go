@@ -0,0 +1,48 @@
+package databasehandler
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	models "weather_subscription/internal/db/models"
+)
+
+func RecordObservation(ctx context.Context, observation *models.WeatherObservation) error {
+	if err := dbHandler.weatherServiceRepository.RecordObservation(ctx, observation); err != nil {
+		return errors.New("failed to record weather observation")
+	}
+
+	return nil
+}
+
+// DownsampleObservations merges readings observed before the cutoff into
+// hourly rows.
+func DownsampleObservations(ctx context.Context, before time.Time) (int64, error) {
+	downsampled, err := dbHandler.weatherServiceRepository.DownsampleObservations(ctx, before)
+	if err != nil {
+		return 0, errors.New("failed to downsample weather observations")
+	}
+
+	return downsampled, nil
+}
+
+func PurgeObservations(ctx context.Context, before time.Time) (int64, error) {
+	purged, err := dbHandler.weatherServiceRepository.PurgeObservations(ctx, before)
+	if err != nil {
+		return 0, errors.New("failed to purge weather observations")
+	}
+
+	return purged, nil
+}
+
+// DailyObservations aggregates the observations of a city per local day
+// between two dates, both inclusive.
+func DailyObservations(ctx context.Context, cityKey, country string, from, to time.Time) ([]models.DailyObservations, error) {
+	days, err := dbHandler.weatherServiceRepository.DailyObservations(ctx, cityKey, country, from, to)
+	if err != nil {
+		return nil, errors.New("failed to aggregate weather observations")
+	}
+
+	return days, nil
+}
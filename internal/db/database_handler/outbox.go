@@ -0,0 +1,71 @@
+package databasehandler
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	models "weather_subscription/internal/db/models"
+)
+
+// emailCooldown is how long after an email with a token was queued for an
+// address another one of the same kind is held back, so the endpoints that
+// send them cannot be used to flood a mailbox.
+const emailCooldown = 5 * time.Minute
+
+// ErrRecentlySent means an email of the same kind was just sent to the address.
+var ErrRecentlySent = errors.New("an email was sent to this address recently, try again later")
+
+// recentlyEmailed reports whether a message of the kind was queued for the
+// recipient within emailCooldown.
+func recentlyEmailed(ctx context.Context, kind models.OutboxKind, recipient string) (bool, error) {
+	recent, err := dbHandler.weatherServiceRepository.HasRecentOutboxMessage(ctx, kind, recipient, emailCooldown)
+	if err != nil {
+		return false, errors.New("failed to check recent emails")
+	}
+
+	return recent, nil
+}
+
+func ClaimOutboxMessages(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxMessage, error) {
+	messages, err := dbHandler.weatherServiceRepository.ClaimOutboxMessages(ctx, limit, lease)
+	if err != nil {
+		return nil, errors.New("failed to claim outbox messages")
+	}
+
+	return messages, nil
+}
+
+func MarkOutboxMessageSent(ctx context.Context, id int64) error {
+	if err := dbHandler.weatherServiceRepository.MarkOutboxMessageSent(ctx, id); err != nil {
+		return errors.New("failed to mark outbox message as sent")
+	}
+
+	return nil
+}
+
+func RescheduleOutboxMessage(ctx context.Context, id int64, lastError string, delay time.Duration) error {
+	if err := dbHandler.weatherServiceRepository.RescheduleOutboxMessage(ctx, id, lastError, delay); err != nil {
+		return errors.New("failed to reschedule outbox message")
+	}
+
+	return nil
+}
+
+func FailOutboxMessage(ctx context.Context, id int64, lastError string) error {
+	if err := dbHandler.weatherServiceRepository.FailOutboxMessage(ctx, id, lastError); err != nil {
+		return errors.New("failed to mark outbox message as failed")
+	}
+
+	return nil
+}
+
+// PurgeOutboxMessages deletes sent and failed messages older than olderThan.
+func PurgeOutboxMessages(ctx context.Context, olderThan time.Duration) (int64, error) {
+	purged, err := dbHandler.weatherServiceRepository.PurgeOutboxMessages(ctx, olderThan)
+	if err != nil {
+		return 0, errors.New("failed to purge outbox messages")
+	}
+
+	return purged, nil
+}
@@ -0,0 +1,61 @@
+package databasehandler
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	infrastructure "weather_subscription/internal/db/database_repository/infrastracture"
+	models "weather_subscription/internal/db/models"
+	weatherClient "weather_subscription/internal/weatherClient"
+)
+
+// ResponseCache is a weather API response cache backed by the
+// api_response_cache table and shared by all replicas.
+type ResponseCache struct{}
+
+var _ weatherClient.ResponseCache = ResponseCache{}
+
+func NewResponseCache() ResponseCache {
+	return ResponseCache{}
+}
+
+func (ResponseCache) Get(ctx context.Context, key string) (*weatherClient.CachedResponse, error) {
+	cached, err := dbHandler.weatherServiceRepository.GetCachedResponse(ctx, key)
+	if errors.Is(err, infrastructure.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.New("failed to read cached response")
+	}
+
+	return &weatherClient.CachedResponse{
+		StatusCode: cached.StatusCode,
+		Header:     cached.Header,
+		Body:       cached.Body,
+	}, nil
+}
+
+func (ResponseCache) Set(ctx context.Context, key string, response *weatherClient.CachedResponse, ttl time.Duration) error {
+	err := dbHandler.weatherServiceRepository.PutCachedResponse(ctx, &models.CachedAPIResponse{
+		Key:        key,
+		StatusCode: response.StatusCode,
+		Header:     response.Header,
+		Body:       response.Body,
+		ExpiresAt:  time.Now().Add(ttl),
+	})
+	if err != nil {
+		return errors.New("failed to store cached response")
+	}
+
+	return nil
+}
+
+func PurgeExpiredCachedResponses(ctx context.Context) (int64, error) {
+	purged, err := dbHandler.weatherServiceRepository.PurgeExpiredCachedResponses(ctx)
+	if err != nil {
+		return 0, errors.New("failed to purge expired cached responses")
+	}
+
+	return purged, nil
+}
@@ -0,0 +1,81 @@
+package databasehandler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	infrastructure "weather_subscription/internal/db/database_repository/infrastracture"
+	models "weather_subscription/internal/db/models"
+)
+
+// MaxRuleLookahead bounds how far ahead a rule may look, within the
+// forecast the scheduler fetches for rules.
+const MaxRuleLookahead = 48
+
+var (
+	ErrInvalidRule  = errors.New("invalid rule")
+	ErrRuleNotFound = errors.New("rule not found")
+)
+
+// CreateRule validates the rule and attaches it to one of the subscriber's
+// city subscriptions. The rule is updated with its ID.
+func CreateRule(ctx context.Context, email string, rule *models.NotificationRule) error {
+	switch {
+	case !rule.Field.Valid():
+		return fmt.Errorf("%w: unknown field %q", ErrInvalidRule, rule.Field)
+	case !rule.Comparator.Valid():
+		return fmt.Errorf("%w: comparator must be 'gt', 'gte', 'lt' or 'lte'", ErrInvalidRule)
+	case rule.LookaheadHours < 0 || rule.LookaheadHours > MaxRuleLookahead:
+		return fmt.Errorf("%w: lookahead must be between 0 and %d hours", ErrInvalidRule, MaxRuleLookahead)
+	}
+
+	if err := dbHandler.weatherServiceRepository.CreateRule(ctx, email, rule); err != nil {
+		if errors.Is(err, infrastructure.ErrNotFound) {
+			return ErrSubscriptionNotFound
+		}
+		return errors.New("failed to create rule")
+	}
+
+	return nil
+}
+
+func ListRules(ctx context.Context, email string, subscriptionID uint) ([]*models.NotificationRule, error) {
+	rules, err := dbHandler.weatherServiceRepository.ListRules(ctx, email, subscriptionID)
+	if err != nil {
+		return nil, errors.New("failed to list rules")
+	}
+
+	return rules, nil
+}
+
+func DeleteRule(ctx context.Context, email string, subscriptionID, ruleID uint) error {
+	if err := dbHandler.weatherServiceRepository.DeleteRule(ctx, email, subscriptionID, ruleID); err != nil {
+		if errors.Is(err, infrastructure.ErrNotFound) {
+			return ErrRuleNotFound
+		}
+		return errors.New("failed to delete rule")
+	}
+
+	return nil
+}
+
+func ListActiveRules(ctx context.Context) ([]*models.NotificationRule, error) {
+	rules, err := dbHandler.weatherServiceRepository.ListActiveRules(ctx)
+	if err != nil {
+		return nil, errors.New("failed to list rules")
+	}
+
+	return rules, nil
+}
+
+// SetRuleTriggered records the rule's new state, returning false if it was
+// already in that state.
+func SetRuleTriggered(ctx context.Context, id uint, triggered bool) (bool, error) {
+	changed, err := dbHandler.weatherServiceRepository.SetRuleTriggered(ctx, id, triggered)
+	if err != nil {
+		return false, errors.New("failed to update rule state")
+	}
+
+	return changed, nil
+}
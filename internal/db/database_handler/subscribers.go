@@ -0,0 +1,85 @@
+package databasehandler
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	infrastructure "weather_subscription/internal/db/database_repository/infrastracture"
+	models "weather_subscription/internal/db/models"
+)
+
+var ErrUnauthorized = errors.New("invalid or missing management token")
+
+// AuthorizeSubscriber checks the management token of the subscriber with the
+// given email. Unknown addresses are unauthorized as well, so the answer does
+// not tell which addresses are subscribed.
+func AuthorizeSubscriber(ctx context.Context, email, token string) error {
+	if token == "" {
+		return ErrUnauthorized
+	}
+
+	subscriber, err := dbHandler.weatherServiceRepository.GetSubscriber(ctx, email)
+	if err != nil {
+		if errors.Is(err, infrastructure.ErrNotFound) {
+			return ErrUnauthorized
+		}
+		return errors.New("failed to authorize subscriber")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(subscriber.ManagementToken), []byte(token)) != 1 {
+		return ErrUnauthorized
+	}
+
+	return nil
+}
+
+// SendManagementToken queues an email with the subscriber's management token
+// to their address. Nothing is sent to unknown addresses, or again within
+// emailCooldown, without telling the caller.
+func SendManagementToken(ctx context.Context, email, language string) error {
+	if language == "" {
+		language = models.DefaultLanguage
+	}
+	parsed, ok := models.ParseLanguage(language)
+	if !ok {
+		return fmt.Errorf("%w %q: must be one of %s", ErrInvalidLanguage, language, strings.Join(models.Languages, ", "))
+	}
+
+	subscriber, err := dbHandler.weatherServiceRepository.GetSubscriber(ctx, email)
+	if err != nil {
+		if errors.Is(err, infrastructure.ErrNotFound) {
+			return nil
+		}
+		return errors.New("failed to get subscriber")
+	}
+
+	recent, err := recentlyEmailed(ctx, models.ManagementTokenEmail, subscriber.Email)
+	if err != nil {
+		return err
+	}
+	if recent {
+		return nil
+	}
+
+	payload, err := json.Marshal(models.ManagementTokenEmailPayload{
+		Token:    subscriber.ManagementToken,
+		Language: parsed,
+	})
+	if err != nil {
+		return errors.New("failed to encode management token email")
+	}
+
+	if err := dbHandler.weatherServiceRepository.EnqueueOutboxMessage(ctx, nil, &models.OutboxMessage{
+		Kind:      models.ManagementTokenEmail,
+		Recipient: subscriber.Email,
+		Payload:   payload,
+	}); err != nil {
+		return errors.New("failed to enqueue management token email")
+	}
+
+	return nil
+}
@@ -2,19 +2,82 @@ package infrastructure
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/rs/zerolog"
 
 	models "weather_subscription/internal/db/models"
 )
 
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrAlreadyExists = errors.New("already exists")
+	ErrConflict      = errors.New("conflict")
+	ErrExpired       = errors.New("expired")
+)
+
 type WeatherServiceRepository interface {
-	CreateSubscription(ctx context.Context, subscription *models.Subscription) error
-	DeleteSubscription(ctx context.Context, email string) error
+	InfraRepo
+
+	UpsertSubscriber(ctx context.Context, tx Tx, email string) (*models.Subscriber, error)
+	GetSubscriber(ctx context.Context, email string) (*models.Subscriber, error)
+	CreateSubscription(ctx context.Context, tx Tx, subscription *models.Subscription, tokenTTL time.Duration) error
+	ListSubscriptions(ctx context.Context, email string) ([]*models.Subscription, error)
+	RemoveSubscription(ctx context.Context, email string, id uint) error
+	Unsubscribe(ctx context.Context, unsubscribeToken string) error
 	ConfirmSubscription(ctx context.Context, token string) error
+	RenewConfirmationToken(ctx context.Context, tx Tx, subscription *models.Subscription, token string, ttl time.Duration) (*models.Subscription, error)
+	PurgeUnconfirmedSubscriptions(ctx context.Context, olderThan time.Duration) (int64, error)
 	ListActiveSubscriptions(ctx context.Context) ([]*models.Subscription, error)
-	Ping(ctx context.Context) error
-	Close()
+
+	UpdateAlertPreferences(ctx context.Context, email string, id uint, preferences models.AlertPreferences) error
+	ListAlertSubscriptions(ctx context.Context) ([]*models.Subscription, error)
+	RecordSentAlert(ctx context.Context, subscriptionID uint, headline string, effective, expires time.Time) (bool, error)
+	ForgetSentAlert(ctx context.Context, subscriptionID uint, headline string, effective time.Time) error
+	PurgeExpiredSentAlerts(ctx context.Context, before time.Time) (int64, error)
+
+	UpdateAirQualityPreferences(ctx context.Context, email string, id uint, preferences models.AirQualityPreferences) error
+	ListAirQualityAlertSubscriptions(ctx context.Context) ([]*models.Subscription, error)
+	SetAirQualityAlertTriggered(ctx context.Context, id uint, triggered bool) (bool, error)
+
+	CreateRule(ctx context.Context, email string, rule *models.NotificationRule) error
+	ListRules(ctx context.Context, email string, subscriptionID uint) ([]*models.NotificationRule, error)
+	DeleteRule(ctx context.Context, email string, subscriptionID, ruleID uint) error
+	ListActiveRules(ctx context.Context) ([]*models.NotificationRule, error)
+	SetRuleTriggered(ctx context.Context, id uint, triggered bool) (bool, error)
+
+	CreateChannel(ctx context.Context, tx Tx, email string, channel *models.DeliveryChannel) error
+	ListChannels(ctx context.Context, email string) ([]*models.DeliveryChannel, error)
+	ListConfirmedChannels(ctx context.Context, subscriberID uint) ([]*models.DeliveryChannel, error)
+	GetChannel(ctx context.Context, id uint) (*models.DeliveryChannel, error)
+	ConfirmChannel(ctx context.Context, token string) error
+	DeleteChannel(ctx context.Context, email string, id uint) error
+	UpdateSubscriptionChannels(ctx context.Context, email string, id uint, channels []models.ChannelKind) error
+
+	EnqueueDeliveryJob(ctx context.Context, subscriptionID uint, scheduledFor time.Time) error
+	ClaimDeliveryJobs(ctx context.Context, limit int, lease time.Duration) ([]*models.DeliveryJob, error)
+	ExtendDeliveryJobLeases(ctx context.Context, jobs []*models.DeliveryJob, lease time.Duration) error
+	MarkDeliveryJobSent(ctx context.Context, job *models.DeliveryJob) error
+	RescheduleDeliveryJob(ctx context.Context, job *models.DeliveryJob, lastError string, delay time.Duration) error
+	FailDeliveryJob(ctx context.Context, job *models.DeliveryJob, lastError string) error
+
+	EnqueueOutboxMessage(ctx context.Context, tx Tx, message *models.OutboxMessage) error
+	ClaimOutboxMessages(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxMessage, error)
+	MarkOutboxMessageSent(ctx context.Context, id int64) error
+	RescheduleOutboxMessage(ctx context.Context, id int64, lastError string, delay time.Duration) error
+	FailOutboxMessage(ctx context.Context, id int64, lastError string) error
+	PurgeOutboxMessages(ctx context.Context, olderThan time.Duration) (int64, error)
+	HasRecentOutboxMessage(ctx context.Context, kind models.OutboxKind, recipient string, within time.Duration) (bool, error)
+
+	RecordObservation(ctx context.Context, observation *models.WeatherObservation) error
+	DownsampleObservations(ctx context.Context, before time.Time) (int64, error)
+	PurgeObservations(ctx context.Context, before time.Time) (int64, error)
+	DailyObservations(ctx context.Context, cityKey, country string, from, to time.Time) ([]models.DailyObservations, error)
+
+	GetCachedResponse(ctx context.Context, key string) (*models.CachedAPIResponse, error)
+	PutCachedResponse(ctx context.Context, response *models.CachedAPIResponse) error
+	PurgeExpiredCachedResponses(ctx context.Context) (int64, error)
 }
 
 type Tx interface {
@@ -0,0 +1,56 @@
+package postgresql
+
+import (
+	"context"
+
+	infrastructure "weather_subscription/internal/db/database_repository/infrastracture"
+	models "weather_subscription/internal/db/models"
+)
+
+// UpdateAirQualityPreferences changes the air quality settings of an active
+// subscription and re-arms its alert.
+func (p postgresqlWeatherServiceRepository) UpdateAirQualityPreferences(ctx context.Context, email string, id uint, preferences models.AirQualityPreferences) error {
+	query := `
+		UPDATE subscriptions s
+		SET air_quality_enabled = $3, aqi_scale = $4, aqi_alert_threshold = $5, aqi_alert_triggered = false
+		FROM subscribers sub
+		WHERE sub.id = s.subscriber_id AND sub.email = $1 AND s.id = $2 AND s.active = true`
+
+	tag, err := p.repo.pool.Exec(ctx, query, email, id,
+		preferences.Enabled,
+		preferences.Scale,
+		preferences.AlertThreshold,
+	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return infrastructure.ErrNotFound
+	}
+
+	return nil
+}
+
+func (p postgresqlWeatherServiceRepository) ListAirQualityAlertSubscriptions(ctx context.Context) ([]*models.Subscription, error) {
+	query := `SELECT ` + subscriptionColumns + `
+		FROM subscriptions s
+		JOIN subscribers sub ON sub.id = s.subscriber_id
+		WHERE s.active = true AND s.confirmed = true
+			AND s.air_quality_enabled = true AND s.aqi_alert_threshold > 0`
+
+	return p.querySubscriptions(ctx, query)
+}
+
+// SetAirQualityAlertTriggered moves a subscription's air quality alert to the
+// given state, returning false if it was already in that state.
+func (p postgresqlWeatherServiceRepository) SetAirQualityAlertTriggered(ctx context.Context, id uint, triggered bool) (bool, error) {
+	query := `UPDATE subscriptions SET aqi_alert_triggered = $2 WHERE id = $1 AND aqi_alert_triggered <> $2`
+
+	tag, err := p.repo.pool.Exec(ctx, query, id, triggered)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
@@ -0,0 +1,81 @@
+package postgresql
+
+import (
+	"context"
+	"time"
+
+	infrastructure "weather_subscription/internal/db/database_repository/infrastracture"
+	models "weather_subscription/internal/db/models"
+)
+
+func (p postgresqlWeatherServiceRepository) UpdateAlertPreferences(ctx context.Context, email string, id uint, preferences models.AlertPreferences) error {
+	query := `
+		UPDATE subscriptions s
+		SET alerts_enabled = $3, alert_min_severity = $4, alert_categories = $5
+		FROM subscribers sub
+		WHERE sub.id = s.subscriber_id AND sub.email = $1 AND s.id = $2 AND s.active = true`
+
+	tag, err := p.repo.pool.Exec(ctx, query, email, id,
+		preferences.Enabled,
+		preferences.MinSeverity,
+		preferences.Categories,
+	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return infrastructure.ErrNotFound
+	}
+
+	return nil
+}
+
+func (p postgresqlWeatherServiceRepository) ListAlertSubscriptions(ctx context.Context) ([]*models.Subscription, error) {
+	query := `SELECT ` + subscriptionColumns + `
+		FROM subscriptions s
+		JOIN subscribers sub ON sub.id = s.subscriber_id
+		WHERE s.active = true AND s.confirmed = true AND s.alerts_enabled = true`
+
+	return p.querySubscriptions(ctx, query)
+}
+
+// RecordSentAlert claims an alert for the subscription. It returns false if
+// the alert was already recorded, by this or another replica.
+func (p postgresqlWeatherServiceRepository) RecordSentAlert(ctx context.Context, subscriptionID uint, headline string, effective, expires time.Time) (bool, error) {
+	query := `
+		INSERT INTO sent_alerts (subscription_id, headline, effective, expires)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING`
+
+	// Alerts without an expiry are kept until the subscription is removed.
+	var expiresAt *time.Time
+	if !expires.IsZero() {
+		expiresAt = &expires
+	}
+
+	tag, err := p.repo.pool.Exec(ctx, query, subscriptionID, headline, effective, expiresAt)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// ForgetSentAlert releases a claimed alert whose email could not be sent, so
+// the next poll tries again.
+func (p postgresqlWeatherServiceRepository) ForgetSentAlert(ctx context.Context, subscriptionID uint, headline string, effective time.Time) error {
+	query := `DELETE FROM sent_alerts WHERE subscription_id = $1 AND headline = $2 AND effective = $3`
+
+	_, err := p.repo.pool.Exec(ctx, query, subscriptionID, headline, effective)
+	return err
+}
+
+func (p postgresqlWeatherServiceRepository) PurgeExpiredSentAlerts(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := p.repo.pool.Exec(ctx, `DELETE FROM sent_alerts WHERE expires < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
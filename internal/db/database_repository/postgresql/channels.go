@@ -0,0 +1,182 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+
+	infrastructure "weather_subscription/internal/db/database_repository/infrastracture"
+	models "weather_subscription/internal/db/models"
+)
+
+const channelColumns = `c.id, c.subscriber_id, c.kind, c.target, c.secret, c.token,
+	c.confirmed, c.confirmed_at, c.created_at`
+
+func channelFields(channel *models.DeliveryChannel) []any {
+	return []any{
+		&channel.ID,
+		&channel.SubscriberID,
+		&channel.Kind,
+		&channel.Target,
+		&channel.Secret,
+		&channel.Token,
+		&channel.Confirmed,
+		&channel.ConfirmedAt,
+		&channel.CreatedAt,
+	}
+}
+
+// CreateChannel registers a delivery channel for the subscriber with the
+// given email. It returns ErrNotFound if there is no such subscriber and
+// ErrAlreadyExists if they registered the same target before.
+func (p postgresqlWeatherServiceRepository) CreateChannel(ctx context.Context, tx infrastructure.Tx, email string, channel *models.DeliveryChannel) error {
+	return p.repo.withTx(ctx, tx, func(q querier) error {
+		err := q.QueryRow(ctx, `SELECT id FROM subscribers WHERE email = $1`, email).Scan(&channel.SubscriberID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return infrastructure.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO delivery_channels (subscriber_id, kind, target, secret, token)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (subscriber_id, kind, target) DO NOTHING
+			RETURNING id, confirmed, created_at`
+
+		err = q.QueryRow(ctx, query,
+			channel.SubscriberID,
+			channel.Kind,
+			channel.Target,
+			channel.Secret,
+			channel.Token,
+		).Scan(&channel.ID, &channel.Confirmed, &channel.CreatedAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return infrastructure.ErrAlreadyExists
+		}
+
+		return err
+	})
+}
+
+func (p postgresqlWeatherServiceRepository) ListChannels(ctx context.Context, email string) ([]*models.DeliveryChannel, error) {
+	query := `SELECT ` + channelColumns + `
+		FROM delivery_channels c
+		JOIN subscribers sub ON sub.id = c.subscriber_id
+		WHERE sub.email = $1
+		ORDER BY c.id`
+
+	return p.queryChannels(ctx, query, email)
+}
+
+// ListConfirmedChannels returns the channels of the subscriber that may
+// receive messages.
+func (p postgresqlWeatherServiceRepository) ListConfirmedChannels(ctx context.Context, subscriberID uint) ([]*models.DeliveryChannel, error) {
+	query := `SELECT ` + channelColumns + `
+		FROM delivery_channels c
+		WHERE c.subscriber_id = $1 AND c.confirmed = true
+		ORDER BY c.id`
+
+	return p.queryChannels(ctx, query, subscriberID)
+}
+
+func (p postgresqlWeatherServiceRepository) queryChannels(ctx context.Context, query string, args ...any) ([]*models.DeliveryChannel, error) {
+	rows, err := p.repo.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var channels []*models.DeliveryChannel
+	for rows.Next() {
+		var channel models.DeliveryChannel
+		if err := rows.Scan(channelFields(&channel)...); err != nil {
+			return nil, err
+		}
+		channels = append(channels, &channel)
+	}
+
+	return channels, rows.Err()
+}
+
+func (p postgresqlWeatherServiceRepository) GetChannel(ctx context.Context, id uint) (*models.DeliveryChannel, error) {
+	query := `SELECT ` + channelColumns + `
+		FROM delivery_channels c
+		WHERE c.id = $1`
+
+	var channel models.DeliveryChannel
+	err := p.repo.pool.QueryRow(ctx, query, id).Scan(channelFields(&channel)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, infrastructure.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &channel, nil
+}
+
+// ConfirmChannel confirms the channel the token was sent to. It returns
+// ErrConflict if the channel is already confirmed.
+func (p postgresqlWeatherServiceRepository) ConfirmChannel(ctx context.Context, token string) error {
+	return p.repo.withTx(ctx, nil, func(q querier) error {
+		var (
+			id        uint
+			confirmed bool
+		)
+		err := q.QueryRow(ctx, `SELECT id, confirmed FROM delivery_channels WHERE token = $1 FOR UPDATE`, token).Scan(&id, &confirmed)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return infrastructure.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if confirmed {
+			return infrastructure.ErrConflict
+		}
+
+		_, err = q.Exec(ctx, `UPDATE delivery_channels SET confirmed = true, confirmed_at = NOW() WHERE id = $1`, id)
+		return err
+	})
+}
+
+func (p postgresqlWeatherServiceRepository) DeleteChannel(ctx context.Context, email string, id uint) error {
+	query := `
+		DELETE FROM delivery_channels c
+		USING subscribers sub
+		WHERE sub.id = c.subscriber_id AND sub.email = $1 AND c.id = $2`
+
+	tag, err := p.repo.pool.Exec(ctx, query, email, id)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return infrastructure.ErrNotFound
+	}
+
+	return nil
+}
+
+// UpdateSubscriptionChannels sets the kinds of channels one of the
+// subscriber's active subscriptions is delivered to.
+func (p postgresqlWeatherServiceRepository) UpdateSubscriptionChannels(ctx context.Context, email string, id uint, channels []models.ChannelKind) error {
+	query := `
+		UPDATE subscriptions s
+		SET channels = $3
+		FROM subscribers sub
+		WHERE sub.id = s.subscriber_id AND sub.email = $1 AND s.id = $2 AND s.active = true`
+
+	tag, err := p.repo.pool.Exec(ctx, query, email, id, channels)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return infrastructure.ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,181 @@
+package postgresql
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	infrastructure "weather_subscription/internal/db/database_repository/infrastracture"
+	models "weather_subscription/internal/db/models"
+)
+
+// EnqueueDeliveryJob records the delivery scheduled for the subscription and
+// advances its last_scheduled_at. The unique (subscription_id, scheduled_for)
+// key makes planning idempotent, so replicas planning the same occurrence
+// create a single job.
+func (p postgresqlWeatherServiceRepository) EnqueueDeliveryJob(ctx context.Context, subscriptionID uint, scheduledFor time.Time) error {
+	query := `
+		WITH job AS (
+			INSERT INTO delivery_jobs (subscription_id, scheduled_for)
+			VALUES ($1, $2)
+			ON CONFLICT (subscription_id, scheduled_for) DO NOTHING
+		)
+		UPDATE subscriptions
+		SET last_scheduled_at = $2
+		WHERE id = $1 AND (last_scheduled_at IS NULL OR last_scheduled_at < $2)`
+
+	_, err := p.repo.pool.Exec(ctx, query, subscriptionID, scheduledFor)
+	return err
+}
+
+// ClaimDeliveryJobs marks up to limit due jobs as running for lease and
+// returns them with their subscriptions. SKIP LOCKED lets replicas claim
+// disjoint batches; a running job whose lease expired (its worker died) is
+// claimed again. Every claim gets a new claimed_by, which the worker must
+// present to renew the lease or record the outcome.
+func (p postgresqlWeatherServiceRepository) ClaimDeliveryJobs(ctx context.Context, limit int, lease time.Duration) ([]*models.DeliveryJob, error) {
+	query := `
+		WITH claimed AS (
+			UPDATE delivery_jobs
+			SET status = 'running',
+				attempts = attempts + 1,
+				locked_until = NOW() + make_interval(secs => $2),
+				claimed_by = gen_random_uuid()
+			WHERE id IN (
+				SELECT id FROM delivery_jobs
+				WHERE (status = 'pending' AND next_attempt_at <= NOW())
+					OR (status = 'running' AND locked_until < NOW())
+				ORDER BY scheduled_for
+				LIMIT $1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id, subscription_id, scheduled_for, status, attempts, next_attempt_at, last_error, created_at, sent_at,
+				claimed_by, delivered_channels
+		)
+		SELECT j.id, j.subscription_id, j.scheduled_for, j.status, j.attempts, j.next_attempt_at, j.last_error, j.created_at, j.sent_at,
+			j.claimed_by::text, j.delivered_channels,
+		` + subscriptionColumns + `
+		FROM claimed j
+		JOIN subscriptions s ON s.id = j.subscription_id
+		JOIN subscribers sub ON sub.id = s.subscriber_id
+		ORDER BY j.scheduled_for`
+
+	rows, err := p.repo.pool.Query(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*models.DeliveryJob
+	for rows.Next() {
+		job := models.DeliveryJob{Subscription: &models.Subscription{}}
+		fields := append([]any{
+			&job.ID,
+			&job.SubscriptionID,
+			&job.ScheduledFor,
+			&job.Status,
+			&job.Attempts,
+			&job.NextAttemptAt,
+			&job.LastError,
+			&job.CreatedAt,
+			&job.SentAt,
+			&job.ClaimedBy,
+			&job.Delivered,
+		}, subscriptionFields(job.Subscription)...)
+
+		if err := rows.Scan(fields...); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, &job)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// ExtendDeliveryJobLeases pushes back the lease of those jobs that are still
+// running under the given claims, so that they are not claimed again while
+// being worked on.
+func (p postgresqlWeatherServiceRepository) ExtendDeliveryJobLeases(ctx context.Context, jobs []*models.DeliveryJob, lease time.Duration) error {
+	query := `
+		UPDATE delivery_jobs
+		SET locked_until = NOW() + make_interval(secs => $3)
+		WHERE status = 'running'
+			AND (id, claimed_by) IN (SELECT * FROM unnest($1::bigint[], $2::text[]::uuid[]))`
+
+	ids := make([]int64, len(jobs))
+	claims := make([]string, len(jobs))
+	for i, job := range jobs {
+		ids[i] = job.ID
+		claims[i] = job.ClaimedBy
+	}
+
+	_, err := p.repo.pool.Exec(ctx, query, ids, claims, lease.Seconds())
+	return err
+}
+
+// MarkDeliveryJobSent, RescheduleDeliveryJob and FailDeliveryJob only update
+// a job that is still running under the worker's claim, and return
+// ErrConflict otherwise.
+func (p postgresqlWeatherServiceRepository) MarkDeliveryJobSent(ctx context.Context, job *models.DeliveryJob) error {
+	query := `
+		WITH job AS (
+			UPDATE delivery_jobs
+			SET status = 'sent', sent_at = NOW(), locked_until = NULL, last_error = NULL
+			WHERE id = $1 AND status = 'running' AND claimed_by = $2::text::uuid
+			RETURNING subscription_id, sent_at
+		)
+		UPDATE subscriptions s
+		SET last_sent_at = job.sent_at
+		FROM job
+		WHERE s.id = job.subscription_id`
+
+	// The job's subscription always exists, so the outer update touches a
+	// row exactly when the job was updated.
+	tag, err := p.repo.pool.Exec(ctx, query, job.ID, job.ClaimedBy)
+	return claimed(tag, err)
+}
+
+// RescheduleDeliveryJob also stores the channels the job has reached so far.
+func (p postgresqlWeatherServiceRepository) RescheduleDeliveryJob(ctx context.Context, job *models.DeliveryJob, lastError string, delay time.Duration) error {
+	query := `
+		UPDATE delivery_jobs
+		SET status = 'pending', next_attempt_at = NOW() + make_interval(secs => $4), locked_until = NULL, last_error = $3,
+			delivered_channels = $5
+		WHERE id = $1 AND status = 'running' AND claimed_by = $2::text::uuid`
+
+	delivered := job.Delivered
+	if delivered == nil {
+		delivered = []string{}
+	}
+
+	tag, err := p.repo.pool.Exec(ctx, query, job.ID, job.ClaimedBy, lastError, delay.Seconds(), delivered)
+	return claimed(tag, err)
+}
+
+func (p postgresqlWeatherServiceRepository) FailDeliveryJob(ctx context.Context, job *models.DeliveryJob, lastError string) error {
+	query := `
+		UPDATE delivery_jobs
+		SET status = 'failed', locked_until = NULL, last_error = $3
+		WHERE id = $1 AND status = 'running' AND claimed_by = $2::text::uuid`
+
+	tag, err := p.repo.pool.Exec(ctx, query, job.ID, job.ClaimedBy, lastError)
+	return claimed(tag, err)
+}
+
+// claimed turns an update that matched no job into ErrConflict: the lease
+// expired and the job was claimed by another worker.
+func claimed(tag pgconn.CommandTag, err error) error {
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return infrastructure.ErrConflict
+	}
+
+	return nil
+}
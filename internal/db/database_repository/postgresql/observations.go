@@ -0,0 +1,138 @@
+package postgresql
+
+import (
+	"context"
+	"time"
+
+	models "weather_subscription/internal/db/models"
+)
+
+// RecordObservation stores a reading, once: the same reading seen again is
+// ignored.
+func (p postgresqlWeatherServiceRepository) RecordObservation(ctx context.Context, observation *models.WeatherObservation) error {
+	query := `
+		INSERT INTO weather_observations (city_key, city, country, lat, lon, timezone, source, observed_at,
+			temperature, min_temperature, max_temperature, humidity, wind_speed, max_wind_speed, precip_mm, description)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9, $9, $10, $11, $11, $12, $13)
+		ON CONFLICT DO NOTHING`
+
+	_, err := p.repo.pool.Exec(ctx, query,
+		observation.CityKey,
+		observation.City,
+		observation.Country,
+		observation.Lat,
+		observation.Lon,
+		observation.Timezone,
+		observation.Source,
+		observation.ObservedAt,
+		observation.Temperature,
+		observation.Humidity,
+		observation.WindSpeed,
+		observation.PrecipMm,
+		observation.Description,
+	)
+	return err
+}
+
+// DownsampleObservations merges the readings observed before the cutoff into
+// one row per place, source and hour, weighting means by their samples so an
+// hour downsampled twice keeps the right averages, and keeping the hour's
+// extremes. It returns the number of hourly rows written.
+func (p postgresqlWeatherServiceRepository) DownsampleObservations(ctx context.Context, before time.Time) (int64, error) {
+	query := `
+		WITH raw AS (
+			DELETE FROM weather_observations
+			WHERE NOT downsampled AND observed_at < $1
+			RETURNING *
+		)
+		INSERT INTO weather_observations AS o (city_key, city, country, lat, lon, timezone, source, observed_at,
+			temperature, min_temperature, max_temperature, humidity, wind_speed, max_wind_speed, precip_mm, description,
+			samples, downsampled)
+		SELECT city_key, max(city), country, avg(lat), avg(lon), max(timezone), source, date_trunc('hour', observed_at),
+			sum(temperature * samples) / sum(samples), min(min_temperature), max(max_temperature),
+			sum(humidity * samples) / sum(samples), sum(wind_speed * samples) / sum(samples), max(max_wind_speed),
+			sum(precip_mm * samples) / sum(samples), mode() WITHIN GROUP (ORDER BY description),
+			sum(samples), true
+		FROM raw
+		GROUP BY city_key, country, source, date_trunc('hour', observed_at)
+		ON CONFLICT (city_key, country, source, observed_at, downsampled) DO UPDATE
+		SET temperature = (o.temperature * o.samples + EXCLUDED.temperature * EXCLUDED.samples) / (o.samples + EXCLUDED.samples),
+			min_temperature = LEAST(o.min_temperature, EXCLUDED.min_temperature),
+			max_temperature = GREATEST(o.max_temperature, EXCLUDED.max_temperature),
+			humidity = (o.humidity * o.samples + EXCLUDED.humidity * EXCLUDED.samples) / (o.samples + EXCLUDED.samples),
+			wind_speed = (o.wind_speed * o.samples + EXCLUDED.wind_speed * EXCLUDED.samples) / (o.samples + EXCLUDED.samples),
+			max_wind_speed = GREATEST(o.max_wind_speed, EXCLUDED.max_wind_speed),
+			precip_mm = (o.precip_mm * o.samples + EXCLUDED.precip_mm * EXCLUDED.samples) / (o.samples + EXCLUDED.samples),
+			samples = o.samples + EXCLUDED.samples`
+
+	tag, err := p.repo.pool.Exec(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+func (p postgresqlWeatherServiceRepository) PurgeObservations(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := p.repo.pool.Exec(ctx, `DELETE FROM weather_observations WHERE observed_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// DailyObservations aggregates a city's observations per local day, from one
+// date to another (both inclusive), oldest first. An empty country matches
+// places of that name in every country. Sources read the same conditions
+// differently, so each hour of a place is taken from a single source: the one
+// with the most readings that hour.
+func (p postgresqlWeatherServiceRepository) DailyObservations(ctx context.Context, cityKey, country string, from, to time.Time) ([]models.DailyObservations, error) {
+	query := `
+		WITH observations AS (
+			SELECT * FROM weather_observations
+			WHERE city_key = $1 AND ($2 = '' OR lower(country) = lower($2))
+				AND observed_at >= $3::date - INTERVAL '1 day' AND observed_at < $4::date + INTERVAL '2 days'
+				AND (observed_at AT TIME ZONE timezone)::date BETWEEN $3::date AND $4::date
+		), hourly_sources AS (
+			SELECT DISTINCT ON (country, date_trunc('hour', observed_at))
+				country, date_trunc('hour', observed_at) AS hour, source
+			FROM observations
+			GROUP BY country, date_trunc('hour', observed_at), source
+			ORDER BY country, date_trunc('hour', observed_at), sum(samples) DESC, source
+		)
+		SELECT (o.observed_at AT TIME ZONE o.timezone)::date AS day,
+			min(o.min_temperature), max(o.max_temperature),
+			sum(o.temperature * o.samples) / sum(o.samples),
+			sum(o.humidity * o.samples) / sum(o.samples),
+			max(o.max_wind_speed), sum(o.samples)
+		FROM observations o
+		JOIN hourly_sources h ON h.country = o.country AND h.hour = date_trunc('hour', o.observed_at) AND h.source = o.source
+		GROUP BY day
+		ORDER BY day`
+
+	rows, err := p.repo.pool.Query(ctx, query, cityKey, country, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var days []models.DailyObservations
+	for rows.Next() {
+		var day models.DailyObservations
+		if err := rows.Scan(
+			&day.Date,
+			&day.MinTemperature,
+			&day.MaxTemperature,
+			&day.AvgTemperature,
+			&day.AvgHumidity,
+			&day.MaxWindSpeed,
+			&day.Samples,
+		); err != nil {
+			return nil, err
+		}
+		days = append(days, day)
+	}
+
+	return days, rows.Err()
+}
@@ -0,0 +1,143 @@
+package postgresql
+
+import (
+	"context"
+	"time"
+
+	infrastructure "weather_subscription/internal/db/database_repository/infrastracture"
+	models "weather_subscription/internal/db/models"
+)
+
+func (p postgresqlWeatherServiceRepository) EnqueueOutboxMessage(ctx context.Context, tx infrastructure.Tx, message *models.OutboxMessage) error {
+	query := `
+		INSERT INTO outbox (kind, recipient, payload)
+		VALUES ($1, $2, $3)
+		RETURNING id, status, attempts, next_attempt_at, created_at`
+
+	return p.repo.withTx(ctx, tx, func(q querier) error {
+		return q.QueryRow(ctx, query,
+			message.Kind,
+			message.Recipient,
+			message.Payload,
+		).Scan(
+			&message.ID,
+			&message.Status,
+			&message.Attempts,
+			&message.NextAttemptAt,
+			&message.CreatedAt,
+		)
+	})
+}
+
+// ClaimOutboxMessages locks up to limit due messages for lease, so concurrent
+// dispatchers never pick the same message. A message whose lease expires
+// without being marked (e.g. the process crashed) becomes claimable again.
+func (p postgresqlWeatherServiceRepository) ClaimOutboxMessages(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxMessage, error) {
+	query := `
+		UPDATE outbox
+		SET attempts = attempts + 1,
+			locked_until = NOW() + make_interval(secs => $2)
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE status = 'pending'
+				AND next_attempt_at <= NOW()
+				AND (locked_until IS NULL OR locked_until < NOW())
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, kind, recipient, payload, status, attempts, next_attempt_at, last_error, created_at, sent_at`
+
+	rows, err := p.repo.pool.Query(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*models.OutboxMessage
+	for rows.Next() {
+		var message models.OutboxMessage
+		if err := rows.Scan(
+			&message.ID,
+			&message.Kind,
+			&message.Recipient,
+			&message.Payload,
+			&message.Status,
+			&message.Attempts,
+			&message.NextAttemptAt,
+			&message.LastError,
+			&message.CreatedAt,
+			&message.SentAt,
+		); err != nil {
+			return nil, err
+		}
+		messages = append(messages, &message)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// MarkOutboxMessageSent also clears the payload, which holds confirmation
+// and management tokens that must not outlive the delivery.
+func (p postgresqlWeatherServiceRepository) MarkOutboxMessageSent(ctx context.Context, id int64) error {
+	query := `
+		UPDATE outbox
+		SET status = 'sent', sent_at = NOW(), locked_until = NULL, last_error = NULL, payload = '{}'
+		WHERE id = $1`
+
+	_, err := p.repo.pool.Exec(ctx, query, id)
+	return err
+}
+
+func (p postgresqlWeatherServiceRepository) RescheduleOutboxMessage(ctx context.Context, id int64, lastError string, delay time.Duration) error {
+	query := `
+		UPDATE outbox
+		SET next_attempt_at = NOW() + make_interval(secs => $3), locked_until = NULL, last_error = $2
+		WHERE id = $1`
+
+	_, err := p.repo.pool.Exec(ctx, query, id, lastError, delay.Seconds())
+	return err
+}
+
+func (p postgresqlWeatherServiceRepository) FailOutboxMessage(ctx context.Context, id int64, lastError string) error {
+	query := `
+		UPDATE outbox
+		SET status = 'failed', locked_until = NULL, last_error = $2
+		WHERE id = $1`
+
+	_, err := p.repo.pool.Exec(ctx, query, id, lastError)
+	return err
+}
+
+// PurgeOutboxMessages deletes sent and failed messages created more than
+// olderThan ago.
+func (p postgresqlWeatherServiceRepository) PurgeOutboxMessages(ctx context.Context, olderThan time.Duration) (int64, error) {
+	query := `
+		DELETE FROM outbox
+		WHERE status IN ('sent', 'failed') AND created_at < NOW() - make_interval(secs => $1)`
+
+	tag, err := p.repo.pool.Exec(ctx, query, olderThan.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// HasRecentOutboxMessage reports whether a message of the kind was queued for
+// the recipient within the given time.
+func (p postgresqlWeatherServiceRepository) HasRecentOutboxMessage(ctx context.Context, kind models.OutboxKind, recipient string, within time.Duration) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM outbox
+			WHERE kind = $1 AND lower(recipient) = lower($2) AND created_at > NOW() - make_interval(secs => $3)
+		)`
+
+	var recent bool
+	err := p.repo.pool.QueryRow(ctx, query, kind, recipient, within.Seconds()).Scan(&recent)
+	return recent, err
+}
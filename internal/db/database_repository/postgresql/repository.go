@@ -2,10 +2,25 @@ package postgresql
 
 import (
 	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog"
+
 	infrastructure "weather_subscription/internal/db/database_repository/infrastracture"
 	models "weather_subscription/internal/db/models"
 )
 
+// subscriptionColumns must be kept in sync with subscriptionFields.
+const subscriptionColumns = `
+	s.id, s.subscriber_id, sub.email, s.city, s.kind, s.frequency, COALESCE(s.schedule, ''), s.timezone, s.delivery_hour,
+	s.language, s.channels, s.location_id, s.region, s.country, s.lat, s.lon,
+	s.alerts_enabled, s.alert_min_severity, s.alert_categories,
+	s.air_quality_enabled, s.aqi_scale, s.aqi_alert_threshold, s.aqi_alert_triggered,
+	s.token, s.token_expires_at, s.unsubscribe_token,
+	s.confirmed, s.confirmed_at, s.active, s.last_scheduled_at, s.last_sent_at, s.created_at`
+
 type postgresqlWeatherServiceRepository struct {
 	repo *PostgresRepo
 }
@@ -18,40 +33,337 @@ func (p postgresqlWeatherServiceRepository) Ping(ctx context.Context) error {
 	return p.repo.Ping(ctx)
 }
 
-func (p postgresqlWeatherServiceRepository) CreateSubscription(ctx context.Context, subscription *models.Subscription) error {
+func (p postgresqlWeatherServiceRepository) BeginTx(ctx context.Context) (infrastructure.Tx, error) {
+	return p.repo.BeginTx(ctx)
+}
+
+func (p postgresqlWeatherServiceRepository) ExtractOrBeginTx(ctx context.Context, outerTx infrastructure.Tx, beginIfNotExists bool) (infrastructure.Tx, bool, error) {
+	return p.repo.ExtractOrBeginTx(ctx, outerTx, beginIfNotExists)
+}
+
+func (p postgresqlWeatherServiceRepository) RollbackTx(ctx context.Context, tx infrastructure.Tx, logger zerolog.Logger) {
+	p.repo.RollbackTx(ctx, tx, logger)
+}
+
+func (p postgresqlWeatherServiceRepository) UpsertSubscriber(ctx context.Context, tx infrastructure.Tx, email string) (*models.Subscriber, error) {
+	// The no-op update makes RETURNING yield the existing row on conflict.
 	query := `
-		INSERT INTO subscriptions (email, city, frequency, active, token)
-		VALUES ($1, $2, $3, $4, $5)`
+		INSERT INTO subscribers (email)
+		VALUES ($1)
+		ON CONFLICT (email) DO UPDATE SET email = EXCLUDED.email
+		RETURNING id, email, management_token, created_at`
+
+	var subscriber models.Subscriber
+	if err := p.repo.querier(tx).QueryRow(ctx, query, email).Scan(subscriberFields(&subscriber)...); err != nil {
+		return nil, err
+	}
+
+	return &subscriber, nil
+}
+
+func (p postgresqlWeatherServiceRepository) GetSubscriber(ctx context.Context, email string) (*models.Subscriber, error) {
+	query := `SELECT id, email, management_token, created_at FROM subscribers WHERE email = $1`
+
+	var subscriber models.Subscriber
+	err := p.repo.pool.QueryRow(ctx, query, email).Scan(subscriberFields(&subscriber)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, infrastructure.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &subscriber, nil
+}
 
-	_, err := p.repo.pool.Exec(ctx, query,
-		subscription.Email,
+func subscriberFields(subscriber *models.Subscriber) []any {
+	return []any{
+		&subscriber.ID,
+		&subscriber.Email,
+		&subscriber.ManagementToken,
+		&subscriber.CreatedAt,
+	}
+}
+
+// CreateSubscription adds a city to the subscriber. A previously cancelled
+// subscription of the same kind for the same location is reactivated and has
+// to be confirmed again. Locations without an ID are the same when their
+// points round to the same one (see migration 019). A subscription created
+// before locations were resolved counts as the same location when its city
+// name matches.
+func (p postgresqlWeatherServiceRepository) CreateSubscription(ctx context.Context, tx infrastructure.Tx, subscription *models.Subscription, tokenTTL time.Duration) error {
+	// Legacy rows have location_id 0 and would never conflict with the
+	// resolved location, so they are moved to it first.
+	adoptQuery := `
+		UPDATE subscriptions s
+		SET location_id = $4, region = $5, country = $6, lat = $7, lon = $8
+		WHERE s.subscriber_id = $1 AND s.kind = $2 AND lower(s.city) = lower($3)
+			AND s.location_id = 0 AND s.lat IS NULL
+			AND NOT EXISTS (
+				SELECT 1 FROM subscriptions o
+				WHERE o.subscriber_id = s.subscriber_id AND o.kind = s.kind
+					AND lower(o.city) = lower(s.city) AND o.location_id = $4
+			)`
+	query := `
+		INSERT INTO subscriptions (subscriber_id, city, kind, frequency, schedule, timezone, delivery_hour,
+			language, channels, location_id, region, country, lat, lon,
+			alerts_enabled, alert_min_severity, alert_categories,
+			air_quality_enabled, aqi_scale, aqi_alert_threshold,
+			confirmed, active, token, token_expires_at, unsubscribe_token)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18,
+			$19, $20, $21, $22, $23, NOW() + make_interval(secs => $24), $25)
+		ON CONFLICT (subscriber_id, kind, lower(city), location_id, point_key) DO UPDATE
+		SET frequency = EXCLUDED.frequency,
+			schedule = EXCLUDED.schedule,
+			timezone = EXCLUDED.timezone,
+			delivery_hour = EXCLUDED.delivery_hour,
+			language = EXCLUDED.language,
+			channels = EXCLUDED.channels,
+			region = EXCLUDED.region,
+			country = EXCLUDED.country,
+			lat = EXCLUDED.lat,
+			lon = EXCLUDED.lon,
+			alerts_enabled = EXCLUDED.alerts_enabled,
+			alert_min_severity = EXCLUDED.alert_min_severity,
+			alert_categories = EXCLUDED.alert_categories,
+			air_quality_enabled = EXCLUDED.air_quality_enabled,
+			aqi_scale = EXCLUDED.aqi_scale,
+			aqi_alert_threshold = EXCLUDED.aqi_alert_threshold,
+			aqi_alert_triggered = false,
+			last_scheduled_at = NULL,
+			last_sent_at = NULL,
+			confirmed = EXCLUDED.confirmed,
+			confirmed_at = NULL,
+			active = EXCLUDED.active,
+			token = EXCLUDED.token,
+			token_expires_at = EXCLUDED.token_expires_at,
+			unsubscribe_token = EXCLUDED.unsubscribe_token,
+			created_at = CURRENT_TIMESTAMP
+		WHERE subscriptions.active = false
+		RETURNING id, created_at, token_expires_at`
+
+	q := p.repo.querier(tx)
+	if subscription.Place.ID != 0 {
+		if _, err := q.Exec(ctx, adoptQuery,
+			subscription.SubscriberID,
+			subscription.Kind,
+			subscription.City,
+			subscription.Place.ID,
+			subscription.Place.Region,
+			subscription.Place.Country,
+			subscription.Place.Lat,
+			subscription.Place.Lon,
+		); err != nil {
+			return err
+		}
+	}
+
+	err := q.QueryRow(ctx, query,
+		subscription.SubscriberID,
 		subscription.City,
+		subscription.Kind,
 		subscription.Frequency,
+		subscription.Schedule,
+		subscription.Timezone,
+		subscription.DeliveryHour,
+		subscription.Language,
+		subscription.Channels,
+		subscription.Place.ID,
+		subscription.Place.Region,
+		subscription.Place.Country,
+		subscription.Place.Lat,
+		subscription.Place.Lon,
+		subscription.Alerts.Enabled,
+		subscription.Alerts.MinSeverity,
+		subscription.Alerts.Categories,
+		subscription.AirQuality.Enabled,
+		subscription.AirQuality.Scale,
+		subscription.AirQuality.AlertThreshold,
+		subscription.Confirmed,
 		subscription.Active,
 		subscription.Token,
-	)
+		tokenTTL.Seconds(),
+		subscription.UnsubscribeToken,
+	).Scan(&subscription.ID, &subscription.CreatedAt, &subscription.TokenExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return infrastructure.ErrAlreadyExists
+	}
 
 	return err
 }
 
-func (p postgresqlWeatherServiceRepository) DeleteSubscription(ctx context.Context, email string) error {
-	query := `UPDATE subscriptions SET active = false WHERE email = $1 AND active = true`
+func (p postgresqlWeatherServiceRepository) ListSubscriptions(ctx context.Context, email string) ([]*models.Subscription, error) {
+	query := `SELECT ` + subscriptionColumns + `
+		FROM subscriptions s
+		JOIN subscribers sub ON sub.id = s.subscriber_id
+		WHERE sub.email = $1
+		ORDER BY s.id`
 
-	_, err := p.repo.pool.Exec(ctx, query, email)
-	return err
+	return p.querySubscriptions(ctx, query, email)
+}
+
+func (p postgresqlWeatherServiceRepository) RemoveSubscription(ctx context.Context, email string, id uint) error {
+	query := `
+		UPDATE subscriptions s SET active = false
+		FROM subscribers sub
+		WHERE sub.id = s.subscriber_id AND sub.email = $1 AND s.id = $2 AND s.active = true`
+
+	tag, err := p.repo.pool.Exec(ctx, query, email, id)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return infrastructure.ErrNotFound
+	}
+
+	return nil
+}
+
+func (p postgresqlWeatherServiceRepository) Unsubscribe(ctx context.Context, unsubscribeToken string) error {
+	query := `UPDATE subscriptions SET active = false WHERE unsubscribe_token = $1 AND active = true`
+
+	tag, err := p.repo.pool.Exec(ctx, query, unsubscribeToken)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return infrastructure.ErrNotFound
+	}
+
+	return nil
 }
 
+// ConfirmSubscription returns ErrNotFound for an unknown token, ErrConflict if
+// the subscription is already confirmed and ErrExpired if the token expired.
 func (p postgresqlWeatherServiceRepository) ConfirmSubscription(ctx context.Context, token string) error {
-	query := `UPDATE subscriptions SET active = true WHERE token = $1 AND active = false`
+	selectQuery := `
+		SELECT id, confirmed, token_expires_at <= NOW()
+		FROM subscriptions
+		WHERE token = $1
+		FOR UPDATE`
+	updateQuery := `UPDATE subscriptions SET confirmed = true, confirmed_at = NOW(), active = true WHERE id = $1`
 
-	_, err := p.repo.pool.Exec(ctx, query, token)
-	return err
+	return p.repo.withTx(ctx, nil, func(q querier) error {
+		var (
+			id        uint
+			confirmed bool
+			expired   bool
+		)
+		err := q.QueryRow(ctx, selectQuery, token).Scan(&id, &confirmed, &expired)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return infrastructure.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if confirmed {
+			return infrastructure.ErrConflict
+		}
+		if expired {
+			return infrastructure.ErrExpired
+		}
+
+		_, err = q.Exec(ctx, updateQuery, id)
+		return err
+	})
+}
+
+// RenewConfirmationToken replaces the confirmation token of the subscriber's
+// pending subscription of the kind for the location (by its rounded point if
+// it has no ID), or for a city of the same name subscribed to before
+// locations were resolved. It returns
+// ErrNotFound if there is no such active subscription and ErrConflict if it
+// is already confirmed.
+func (p postgresqlWeatherServiceRepository) RenewConfirmationToken(ctx context.Context, tx infrastructure.Tx, subscription *models.Subscription, token string, ttl time.Duration) (*models.Subscription, error) {
+	selectQuery := `SELECT ` + subscriptionColumns + `
+		FROM subscriptions s
+		JOIN subscribers sub ON sub.id = s.subscriber_id
+		WHERE sub.email = $1 AND s.kind = $2 AND lower(s.city) = lower($3) AND s.active = true
+			AND (s.location_id = $4 OR (s.location_id = 0 AND s.lat IS NULL))
+			AND (s.location_id <> 0 OR s.lat IS NULL
+				OR (round(s.lat::numeric, 2) = round($5::float8::numeric, 2) AND round(s.lon::numeric, 2) = round($6::float8::numeric, 2)))
+		ORDER BY s.location_id DESC, s.lat IS NULL
+		LIMIT 1
+		FOR UPDATE OF s`
+	updateQuery := `
+		UPDATE subscriptions
+		SET token = $2, token_expires_at = NOW() + make_interval(secs => $3)
+		WHERE id = $1
+		RETURNING token, token_expires_at`
+
+	var renewed *models.Subscription
+	err := p.repo.withTx(ctx, tx, func(q querier) error {
+		var err error
+		renewed, err = scanSubscription(q.QueryRow(ctx, selectQuery,
+			subscription.Email,
+			subscription.Kind,
+			subscription.City,
+			subscription.Place.ID,
+			subscription.Place.Lat,
+			subscription.Place.Lon,
+		))
+		if errors.Is(err, pgx.ErrNoRows) {
+			return infrastructure.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if renewed.Confirmed {
+			return infrastructure.ErrConflict
+		}
+
+		return q.QueryRow(ctx, updateQuery, renewed.ID, token, ttl.Seconds()).Scan(
+			&renewed.Token,
+			&renewed.TokenExpiresAt,
+		)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return renewed, nil
+}
+
+// PurgeUnconfirmedSubscriptions deletes subscriptions that were never confirmed
+// within olderThan, along with subscribers left without any subscription.
+func (p postgresqlWeatherServiceRepository) PurgeUnconfirmedSubscriptions(ctx context.Context, olderThan time.Duration) (int64, error) {
+	subscriptionsQuery := `
+		DELETE FROM subscriptions
+		WHERE confirmed = false AND created_at < NOW() - make_interval(secs => $1)`
+	subscribersQuery := `
+		DELETE FROM subscribers sub
+		WHERE NOT EXISTS (SELECT 1 FROM subscriptions s WHERE s.subscriber_id = sub.id)`
+
+	var purged int64
+	err := p.repo.withTx(ctx, nil, func(q querier) error {
+		tag, err := q.Exec(ctx, subscriptionsQuery, olderThan.Seconds())
+		if err != nil {
+			return err
+		}
+		purged = tag.RowsAffected()
+
+		_, err = q.Exec(ctx, subscribersQuery)
+		return err
+	})
+
+	return purged, err
 }
 
 func (p postgresqlWeatherServiceRepository) ListActiveSubscriptions(ctx context.Context) ([]*models.Subscription, error) {
-	query := `SELECT * FROM subscriptions WHERE active = true`
+	query := `SELECT ` + subscriptionColumns + `
+		FROM subscriptions s
+		JOIN subscribers sub ON sub.id = s.subscriber_id
+		WHERE s.active = true AND s.confirmed = true`
 
-	rows, err := p.repo.pool.Query(ctx, query)
+	return p.querySubscriptions(ctx, query)
+}
+
+func (p postgresqlWeatherServiceRepository) querySubscriptions(ctx context.Context, query string, args ...any) ([]*models.Subscription, error) {
+	rows, err := p.repo.pool.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -59,19 +371,11 @@ func (p postgresqlWeatherServiceRepository) ListActiveSubscriptions(ctx context.
 
 	var subscriptions []*models.Subscription
 	for rows.Next() {
-		var sub models.Subscription
-		if err := rows.Scan(
-			&sub.ID,
-			&sub.Email,
-			&sub.City,
-			&sub.Frequency,
-			&sub.Token,
-			&sub.Active,
-			&sub.CreatedAt,
-		); err != nil {
+		sub, err := scanSubscription(rows)
+		if err != nil {
 			return nil, err
 		}
-		subscriptions = append(subscriptions, &sub)
+		subscriptions = append(subscriptions, sub)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -81,6 +385,53 @@ func (p postgresqlWeatherServiceRepository) ListActiveSubscriptions(ctx context.
 	return subscriptions, nil
 }
 
+func scanSubscription(row pgx.Row) (*models.Subscription, error) {
+	var sub models.Subscription
+	if err := row.Scan(subscriptionFields(&sub)...); err != nil {
+		return nil, err
+	}
+
+	return &sub, nil
+}
+
+// subscriptionFields returns scan destinations in subscriptionColumns order.
+func subscriptionFields(sub *models.Subscription) []any {
+	return []any{
+		&sub.ID,
+		&sub.SubscriberID,
+		&sub.Email,
+		&sub.City,
+		&sub.Kind,
+		&sub.Frequency,
+		&sub.Schedule,
+		&sub.Timezone,
+		&sub.DeliveryHour,
+		&sub.Language,
+		&sub.Channels,
+		&sub.Place.ID,
+		&sub.Place.Region,
+		&sub.Place.Country,
+		&sub.Place.Lat,
+		&sub.Place.Lon,
+		&sub.Alerts.Enabled,
+		&sub.Alerts.MinSeverity,
+		&sub.Alerts.Categories,
+		&sub.AirQuality.Enabled,
+		&sub.AirQuality.Scale,
+		&sub.AirQuality.AlertThreshold,
+		&sub.AirQuality.AlertTriggered,
+		&sub.Token,
+		&sub.TokenExpiresAt,
+		&sub.UnsubscribeToken,
+		&sub.Confirmed,
+		&sub.ConfirmedAt,
+		&sub.Active,
+		&sub.LastScheduledAt,
+		&sub.LastSentAt,
+		&sub.CreatedAt,
+	}
+}
+
 func NewWeatherServiceRepository(repo *PostgresRepo) infrastructure.WeatherServiceRepository {
 	return &postgresqlWeatherServiceRepository{
 		repo: repo,
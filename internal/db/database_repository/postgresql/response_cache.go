@@ -0,0 +1,65 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+
+	infrastructure "weather_subscription/internal/db/database_repository/infrastracture"
+	models "weather_subscription/internal/db/models"
+)
+
+func (p postgresqlWeatherServiceRepository) GetCachedResponse(ctx context.Context, key string) (*models.CachedAPIResponse, error) {
+	query := `
+		SELECT key, status_code, header, body, expires_at
+		FROM api_response_cache
+		WHERE key = $1 AND expires_at > NOW()`
+
+	var response models.CachedAPIResponse
+	err := p.repo.pool.QueryRow(ctx, query, key).Scan(
+		&response.Key,
+		&response.StatusCode,
+		&response.Header,
+		&response.Body,
+		&response.ExpiresAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, infrastructure.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+func (p postgresqlWeatherServiceRepository) PutCachedResponse(ctx context.Context, response *models.CachedAPIResponse) error {
+	query := `
+		INSERT INTO api_response_cache (key, status_code, header, body, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (key) DO UPDATE
+		SET status_code = EXCLUDED.status_code,
+			header = EXCLUDED.header,
+			body = EXCLUDED.body,
+			expires_at = EXCLUDED.expires_at,
+			created_at = NOW()`
+
+	_, err := p.repo.pool.Exec(ctx, query,
+		response.Key,
+		response.StatusCode,
+		response.Header,
+		response.Body,
+		response.ExpiresAt,
+	)
+	return err
+}
+
+func (p postgresqlWeatherServiceRepository) PurgeExpiredCachedResponses(ctx context.Context) (int64, error) {
+	tag, err := p.repo.pool.Exec(ctx, `DELETE FROM api_response_cache WHERE expires_at <= NOW()`)
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,142 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+
+	infrastructure "weather_subscription/internal/db/database_repository/infrastracture"
+	models "weather_subscription/internal/db/models"
+)
+
+const ruleColumns = `r.id, r.subscription_id, r.field, r.comparator, r.threshold, r.lookahead_hours,
+	r.triggered, r.last_fired_at, r.created_at`
+
+func ruleFields(rule *models.NotificationRule) []any {
+	return []any{
+		&rule.ID,
+		&rule.SubscriptionID,
+		&rule.Field,
+		&rule.Comparator,
+		&rule.Threshold,
+		&rule.LookaheadHours,
+		&rule.Triggered,
+		&rule.LastFiredAt,
+		&rule.CreatedAt,
+	}
+}
+
+// CreateRule attaches a rule to one of the subscriber's active subscriptions.
+func (p postgresqlWeatherServiceRepository) CreateRule(ctx context.Context, email string, rule *models.NotificationRule) error {
+	query := `
+		INSERT INTO notification_rules (subscription_id, field, comparator, threshold, lookahead_hours)
+		SELECT s.id, $3, $4, $5, $6
+		FROM subscriptions s
+		JOIN subscribers sub ON sub.id = s.subscriber_id
+		WHERE sub.email = $1 AND s.id = $2 AND s.active = true
+		RETURNING id, created_at`
+
+	err := p.repo.pool.QueryRow(ctx, query, email, rule.SubscriptionID,
+		rule.Field,
+		rule.Comparator,
+		rule.Threshold,
+		rule.LookaheadHours,
+	).Scan(&rule.ID, &rule.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return infrastructure.ErrNotFound
+	}
+
+	return err
+}
+
+func (p postgresqlWeatherServiceRepository) ListRules(ctx context.Context, email string, subscriptionID uint) ([]*models.NotificationRule, error) {
+	query := `SELECT ` + ruleColumns + `
+		FROM notification_rules r
+		JOIN subscriptions s ON s.id = r.subscription_id
+		JOIN subscribers sub ON sub.id = s.subscriber_id
+		WHERE sub.email = $1 AND s.id = $2
+		ORDER BY r.id`
+
+	rows, err := p.repo.pool.Query(ctx, query, email, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []*models.NotificationRule
+	for rows.Next() {
+		var rule models.NotificationRule
+		if err := rows.Scan(ruleFields(&rule)...); err != nil {
+			return nil, err
+		}
+		rules = append(rules, &rule)
+	}
+
+	return rules, rows.Err()
+}
+
+func (p postgresqlWeatherServiceRepository) DeleteRule(ctx context.Context, email string, subscriptionID, ruleID uint) error {
+	query := `
+		DELETE FROM notification_rules r
+		USING subscriptions s, subscribers sub
+		WHERE s.id = r.subscription_id AND sub.id = s.subscriber_id
+			AND sub.email = $1 AND s.id = $2 AND r.id = $3`
+
+	tag, err := p.repo.pool.Exec(ctx, query, email, subscriptionID, ruleID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return infrastructure.ErrNotFound
+	}
+
+	return nil
+}
+
+// ListActiveRules returns the rules of active, confirmed subscriptions along
+// with their subscription.
+func (p postgresqlWeatherServiceRepository) ListActiveRules(ctx context.Context) ([]*models.NotificationRule, error) {
+	query := `SELECT ` + ruleColumns + `, ` + subscriptionColumns + `
+		FROM notification_rules r
+		JOIN subscriptions s ON s.id = r.subscription_id
+		JOIN subscribers sub ON sub.id = s.subscriber_id
+		WHERE s.active = true AND s.confirmed = true`
+
+	rows, err := p.repo.pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []*models.NotificationRule
+	for rows.Next() {
+		rule := models.NotificationRule{Subscription: &models.Subscription{}}
+		fields := append(ruleFields(&rule), subscriptionFields(rule.Subscription)...)
+		if err := rows.Scan(fields...); err != nil {
+			return nil, err
+		}
+		rules = append(rules, &rule)
+	}
+
+	return rules, rows.Err()
+}
+
+// SetRuleTriggered moves a rule to the given state. It returns false if the
+// rule was already in that state, e.g. because another replica evaluated it
+// first.
+func (p postgresqlWeatherServiceRepository) SetRuleTriggered(ctx context.Context, id uint, triggered bool) (bool, error) {
+	query := `
+		UPDATE notification_rules
+		SET triggered = $2,
+			last_fired_at = CASE WHEN $2 THEN NOW() ELSE last_fired_at END
+		WHERE id = $1 AND triggered <> $2`
+
+	tag, err := p.repo.pool.Exec(ctx, query, id, triggered)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
@@ -0,0 +1,90 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	infrastructure "weather_subscription/internal/db/database_repository/infrastracture"
+)
+
+// querier is the subset of pgxpool.Pool and pgx.Tx used by the repository,
+// so queries can run either standalone or inside a caller's transaction.
+type querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func (p PostgresRepo) BeginTx(ctx context.Context) (infrastructure.Tx, error) {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: '%w'", err)
+	}
+
+	return tx, nil
+}
+
+func (p PostgresRepo) ExtractOrBeginTx(ctx context.Context, outerTx infrastructure.Tx, beginIfNotExists bool) (infrastructure.Tx, bool, error) {
+	if outerTx != nil {
+		return outerTx, false, nil
+	}
+
+	if !beginIfNotExists {
+		return nil, false, nil
+	}
+
+	tx, err := p.BeginTx(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return tx, true, nil
+}
+
+func (p PostgresRepo) RollbackTx(ctx context.Context, tx infrastructure.Tx, logger zerolog.Logger) {
+	if tx == nil {
+		return
+	}
+
+	if err := tx.Rollback(ctx); err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+		logger.Error().Err(err).Msg("failed to rollback transaction")
+	}
+}
+
+// querier returns the transaction when one is given, otherwise the pool.
+func (p PostgresRepo) querier(tx infrastructure.Tx) querier {
+	if pgTx, ok := tx.(pgx.Tx); ok {
+		return pgTx
+	}
+
+	return p.pool
+}
+
+// withTx runs fn inside outerTx, or inside a new transaction that is committed
+// when fn succeeds if the caller did not pass one.
+func (p PostgresRepo) withTx(ctx context.Context, outerTx infrastructure.Tx, fn func(q querier) error) error {
+	tx, shouldCloseTx, err := p.ExtractOrBeginTx(ctx, outerTx, true)
+	if err != nil {
+		return err
+	}
+
+	if shouldCloseTx {
+		defer p.RollbackTx(ctx, tx, log.Logger)
+	}
+
+	if err := fn(p.querier(tx)); err != nil {
+		return err
+	}
+
+	if shouldCloseTx {
+		return tx.Commit(ctx)
+	}
+
+	return nil
+}
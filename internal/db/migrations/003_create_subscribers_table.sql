@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS subscribers (
+    id SERIAL PRIMARY KEY,
+    email VARCHAR(255) NOT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO subscribers (email)
+SELECT DISTINCT email FROM subscriptions
+ON CONFLICT (email) DO NOTHING;
+
+-- Confirmation is tracked separately from "active" so that a subscriber can
+-- unsubscribe from one city without losing the confirmation of the others.
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS subscriber_id INT REFERENCES subscribers(id) ON DELETE CASCADE;
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS confirmed BOOLEAN NOT NULL DEFAULT false;
+
+UPDATE subscriptions s
+SET subscriber_id = sub.id, confirmed = s.active
+FROM subscribers sub
+WHERE sub.email = s.email AND s.subscriber_id IS NULL;
+
+-- Keep only the newest subscription per subscriber and city.
+DELETE FROM subscriptions s
+USING subscriptions newer
+WHERE s.subscriber_id = newer.subscriber_id
+    AND lower(s.city) = lower(newer.city)
+    AND s.id < newer.id;
+
+ALTER TABLE subscriptions ALTER COLUMN subscriber_id SET NOT NULL;
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS email;
+
+CREATE UNIQUE INDEX IF NOT EXISTS subscriptions_subscriber_city_idx ON subscriptions (subscriber_id, lower(city));
+
+GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO postgres;
+GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO postgres;
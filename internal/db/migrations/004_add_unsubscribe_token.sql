@@ -0,0 +1,9 @@
+-- Every subscription gets its own unsubscribe token, which is embedded in the
+-- weather emails instead of letting anyone unsubscribe by email address.
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS unsubscribe_token VARCHAR(255);
+
+UPDATE subscriptions SET unsubscribe_token = gen_random_uuid()::text WHERE unsubscribe_token IS NULL;
+
+ALTER TABLE subscriptions ALTER COLUMN unsubscribe_token SET NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS subscriptions_unsubscribe_token_idx ON subscriptions (unsubscribe_token);
@@ -0,0 +1,9 @@
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS token_expires_at TIMESTAMP;
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS confirmed_at TIMESTAMP;
+
+-- Give pending confirmations the default one-day lifetime.
+UPDATE subscriptions SET token_expires_at = created_at + INTERVAL '24 hours' WHERE token_expires_at IS NULL;
+
+ALTER TABLE subscriptions ALTER COLUMN token_expires_at SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS subscriptions_unconfirmed_idx ON subscriptions (created_at) WHERE confirmed = false;
@@ -0,0 +1,5 @@
+-- Daily updates are delivered at delivery_hour in the subscriber's timezone,
+-- which is resolved from the city (IANA name, e.g. "Europe/Kyiv").
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS delivery_hour SMALLINT NOT NULL DEFAULT 0 CHECK (delivery_hour BETWEEN 0 AND 23);
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS last_sent_at TIMESTAMPTZ;
@@ -0,0 +1,3 @@
+-- Cron-like schedule of subscriptions with the "custom" frequency, evaluated
+-- in the subscription's timezone (e.g. "30 6 * * MON-FRI").
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS schedule VARCHAR(255);
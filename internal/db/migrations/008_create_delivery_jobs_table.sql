@@ -0,0 +1,25 @@
+-- Every scheduled weather update is recorded as a job before it is sent, so a
+-- restart never loses a delivery and replicas can share the work.
+CREATE TABLE IF NOT EXISTS delivery_jobs (
+    id BIGSERIAL PRIMARY KEY,
+    subscription_id INT NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+    scheduled_for TIMESTAMPTZ NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    locked_until TIMESTAMPTZ,
+    last_error TEXT,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    sent_at TIMESTAMPTZ,
+    UNIQUE (subscription_id, scheduled_for)
+);
+
+CREATE INDEX IF NOT EXISTS delivery_jobs_due_idx ON delivery_jobs (next_attempt_at) WHERE status IN ('pending', 'running');
+
+-- The newest occurrence a job was created for; planning resumes from here.
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS last_scheduled_at TIMESTAMPTZ;
+
+UPDATE subscriptions SET last_scheduled_at = last_sent_at WHERE last_scheduled_at IS NULL;
+
+GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO postgres;
+GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO postgres;
@@ -0,0 +1,15 @@
+-- Shared cache of WeatherAPI responses, used when weather_api.cache.backend is
+-- "postgres" so every replica benefits from the others' requests.
+CREATE TABLE IF NOT EXISTS api_response_cache (
+    key TEXT PRIMARY KEY,
+    status_code INT NOT NULL,
+    header JSONB NOT NULL DEFAULT '{}',
+    body BYTEA NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS api_response_cache_expires_idx ON api_response_cache (expires_at);
+
+GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO postgres;
+GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO postgres;
@@ -0,0 +1,19 @@
+-- Opt-in to severe weather alerts per city subscription, filtered by minimum
+-- severity and (optionally) categories.
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS alerts_enabled BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS alert_min_severity VARCHAR(16) NOT NULL DEFAULT 'moderate';
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS alert_categories TEXT[] NOT NULL DEFAULT '{}';
+
+-- Alerts already sent to a subscription, so each alert (headline plus
+-- effective time) is sent once even with several replicas polling.
+CREATE TABLE IF NOT EXISTS sent_alerts (
+    subscription_id INT NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+    headline TEXT NOT NULL,
+    effective TIMESTAMPTZ NOT NULL,
+    expires TIMESTAMPTZ,
+    sent_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (subscription_id, headline, effective)
+);
+
+GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO postgres;
+GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO postgres;
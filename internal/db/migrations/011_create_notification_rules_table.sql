@@ -0,0 +1,20 @@
+-- Conditional notifications: a rule fires when the forecast for its
+-- subscription's city crosses a threshold within the lookahead window.
+-- triggered holds the last evaluated state, so a rule only fires when it
+-- changes from not met to met.
+CREATE TABLE IF NOT EXISTS notification_rules (
+    id SERIAL PRIMARY KEY,
+    subscription_id INT NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+    field VARCHAR(32) NOT NULL,
+    comparator VARCHAR(8) NOT NULL,
+    threshold DOUBLE PRECISION NOT NULL,
+    lookahead_hours INT NOT NULL DEFAULT 0,
+    triggered BOOLEAN NOT NULL DEFAULT false,
+    last_fired_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS notification_rules_subscription_idx ON notification_rules (subscription_id);
+
+GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO postgres;
+GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO postgres;
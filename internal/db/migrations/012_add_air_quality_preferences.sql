@@ -0,0 +1,10 @@
+-- Air quality in updates, on the subscriber's chosen scale, and an optional
+-- alert when the index reaches a threshold. aqi_alert_triggered holds the
+-- alert state so it is only sent when the threshold is crossed.
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS air_quality_enabled BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS aqi_scale VARCHAR(8) NOT NULL DEFAULT 'epa';
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS aqi_alert_threshold INT NOT NULL DEFAULT 0;
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS aqi_alert_triggered BOOLEAN NOT NULL DEFAULT false;
+
+GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO postgres;
+GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO postgres;
@@ -0,0 +1,9 @@
+-- A subscription delivers either weather updates or a marine (sea and surf)
+-- report. A subscriber may have both for the same location.
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS kind VARCHAR(16) NOT NULL DEFAULT 'weather';
+
+DROP INDEX IF EXISTS subscriptions_subscriber_city_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS subscriptions_subscriber_kind_city_idx ON subscriptions (subscriber_id, kind, lower(city));
+
+GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO postgres;
+GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO postgres;
@@ -0,0 +1,16 @@
+-- The canonical location a subscription's city was resolved to. Weather is
+-- fetched by lat/lon, so a city name matching several places cannot drift.
+-- Subscriptions created before resolution keep location_id 0 and NULL
+-- coordinates and are fetched by city name.
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS location_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS region VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS country VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS lat DOUBLE PRECISION;
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS lon DOUBLE PRECISION;
+
+-- Places sharing a name (London, England and London, Ontario) are distinct.
+DROP INDEX IF EXISTS subscriptions_subscriber_kind_city_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS subscriptions_subscriber_kind_location_idx ON subscriptions (subscriber_id, kind, lower(city), location_id);
+
+GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO postgres;
+GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO postgres;
@@ -0,0 +1,37 @@
+-- Current conditions read by the scheduler on every weather fetch, kept for
+-- trend analytics. Readings older than observations.downsampleAfterDays are
+-- merged into one downsampled row per place, source and hour, which keeps the
+-- mean along with the extremes; rows older than observations.retentionDays
+-- are deleted.
+CREATE TABLE IF NOT EXISTS weather_observations (
+    id BIGSERIAL PRIMARY KEY,
+    city_key TEXT NOT NULL,
+    city TEXT NOT NULL,
+    country TEXT NOT NULL DEFAULT '',
+    lat DOUBLE PRECISION,
+    lon DOUBLE PRECISION,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    source VARCHAR(64) NOT NULL,
+    observed_at TIMESTAMPTZ NOT NULL,
+    temperature DOUBLE PRECISION NOT NULL,
+    min_temperature DOUBLE PRECISION NOT NULL,
+    max_temperature DOUBLE PRECISION NOT NULL,
+    humidity DOUBLE PRECISION NOT NULL,
+    wind_speed DOUBLE PRECISION NOT NULL,
+    precip_mm DOUBLE PRECISION NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    samples INT NOT NULL DEFAULT 1,
+    downsampled BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- A reading fetched again (by another replica or from a cached response) is
+-- stored once.
+CREATE UNIQUE INDEX IF NOT EXISTS weather_observations_reading_idx
+    ON weather_observations (city_key, country, source, observed_at, downsampled);
+
+CREATE INDEX IF NOT EXISTS weather_observations_city_idx ON weather_observations (city_key, observed_at);
+CREATE INDEX IF NOT EXISTS weather_observations_downsample_idx ON weather_observations (observed_at) WHERE NOT downsampled;
+
+GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO postgres;
+GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO postgres;
@@ -0,0 +1,6 @@
+-- Language of the subscription's emails, also requested from the weather
+-- source for condition descriptions.
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS language VARCHAR(8) NOT NULL DEFAULT 'en';
+
+GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO postgres;
+GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO postgres;
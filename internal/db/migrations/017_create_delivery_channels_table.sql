@@ -0,0 +1,22 @@
+-- Delivery channels besides the subscriber's email address: signed HTTP
+-- webhooks, Slack-compatible incoming webhooks and Telegram chats. A channel
+-- receives messages once confirmed through the link sent over it, and only
+-- for subscriptions listing its kind in channels.
+CREATE TABLE IF NOT EXISTS delivery_channels (
+    id SERIAL PRIMARY KEY,
+    subscriber_id INT NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE,
+    kind VARCHAR(16) NOT NULL,
+    target TEXT NOT NULL,
+    secret VARCHAR(64) NOT NULL DEFAULT '',
+    token VARCHAR(255) NOT NULL UNIQUE,
+    confirmed BOOLEAN NOT NULL DEFAULT false,
+    confirmed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS delivery_channels_target_idx ON delivery_channels (subscriber_id, kind, target);
+
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS channels TEXT[] NOT NULL DEFAULT '{email}';
+
+GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO postgres;
+GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO postgres;
@@ -0,0 +1,13 @@
+-- Listing and changing a subscriber's subscriptions requires their management
+-- token, emailed to the address on request, rather than just the address.
+ALTER TABLE subscribers ADD COLUMN IF NOT EXISTS management_token VARCHAR(255);
+
+UPDATE subscribers SET management_token = gen_random_uuid()::text WHERE management_token IS NULL;
+
+ALTER TABLE subscribers ALTER COLUMN management_token SET DEFAULT gen_random_uuid()::text;
+ALTER TABLE subscribers ALTER COLUMN management_token SET NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS subscribers_management_token_idx ON subscribers (management_token);
+
+GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO postgres;
+GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO postgres;
@@ -0,0 +1,16 @@
+-- Locations given as coordinates or found from an IP address have no
+-- location_id, so two points near the same named place would collide on
+-- (city, location_id). They are told apart by their point, rounded to about a
+-- kilometre; resolved and legacy subscriptions have an empty key.
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS point_key VARCHAR(64) GENERATED ALWAYS AS (
+	CASE WHEN location_id = 0 AND lat IS NOT NULL AND lon IS NOT NULL
+		THEN round(lat::numeric, 2)::text || ',' || round(lon::numeric, 2)::text
+		ELSE ''
+	END
+) STORED;
+
+DROP INDEX IF EXISTS subscriptions_subscriber_kind_location_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS subscriptions_subscriber_kind_point_idx ON subscriptions (subscriber_id, kind, lower(city), location_id, point_key);
+
+GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO postgres;
+GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO postgres;
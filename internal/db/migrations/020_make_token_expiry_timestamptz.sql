@@ -0,0 +1,6 @@
+-- token_expires_at was a TIMESTAMP without time zone, so its meaning depended
+-- on the session time zone. Existing values were written in UTC.
+ALTER TABLE subscriptions ALTER COLUMN token_expires_at TYPE TIMESTAMPTZ USING token_expires_at AT TIME ZONE 'UTC';
+
+GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO postgres;
+GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO postgres;
@@ -0,0 +1,6 @@
+-- Each claim of a job gets a new identity, so a worker whose lease expired
+-- and was taken over cannot overwrite the outcome recorded by the new owner.
+ALTER TABLE delivery_jobs ADD COLUMN IF NOT EXISTS claimed_by UUID;
+
+GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO postgres;
+GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO postgres;
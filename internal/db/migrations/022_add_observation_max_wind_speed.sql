@@ -0,0 +1,10 @@
+-- Downsampling averages wind_speed over the hour, which hides gusts the
+-- daily maximum should report, so the hour's strongest reading is kept apart.
+ALTER TABLE weather_observations ADD COLUMN IF NOT EXISTS max_wind_speed DOUBLE PRECISION;
+
+UPDATE weather_observations SET max_wind_speed = wind_speed WHERE max_wind_speed IS NULL;
+
+ALTER TABLE weather_observations ALTER COLUMN max_wind_speed SET NOT NULL;
+
+GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO postgres;
+GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO postgres;
@@ -0,0 +1,6 @@
+-- The channels a job's message reached, so that a retry after some channels
+-- failed only sends to the others.
+ALTER TABLE delivery_jobs ADD COLUMN IF NOT EXISTS delivered_channels TEXT[] NOT NULL DEFAULT '{}';
+
+GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO postgres;
+GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO postgres;
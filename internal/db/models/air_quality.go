@@ -0,0 +1,118 @@
+package models
+
+import (
+	"strings"
+
+	weatherProvider "weather_subscription/internal/weatherProvider"
+)
+
+// AQIScale selects the air quality index shown to a subscriber.
+type AQIScale string
+
+const (
+	// AQIScaleEPA is the US EPA index, 1 (good) to 6 (hazardous).
+	AQIScaleEPA AQIScale = "epa"
+	// AQIScaleDEFRA is the UK DEFRA Daily Air Quality Index, 1 (low) to 10
+	// (very high).
+	AQIScaleDEFRA AQIScale = "defra"
+)
+
+func ParseAQIScale(value string) (AQIScale, bool) {
+	scale := AQIScale(strings.ToLower(strings.TrimSpace(value)))
+	return scale, scale == AQIScaleEPA || scale == AQIScaleDEFRA
+}
+
+// MaxIndex is the top of the scale.
+func (s AQIScale) MaxIndex() int {
+	if s == AQIScaleDEFRA {
+		return 10
+	}
+
+	return 6
+}
+
+// AirQualityPreferences configure the air quality section of a city
+// subscription's updates and an optional alert when the index reaches
+// AlertThreshold on the chosen scale.
+type AirQualityPreferences struct {
+	Enabled        bool     `json:"enabled"`
+	Scale          AQIScale `json:"scale"`
+	AlertThreshold int      `json:"alert_threshold,omitempty"` // 0 disables the alert
+	// AlertTriggered is the alert state at the last evaluation; the alert is
+	// sent when the index reaches the threshold and re-armed when it drops.
+	AlertTriggered bool `json:"-"`
+}
+
+// AirQuality is an air quality reading on a subscriber's chosen scale, with
+// pollutant concentrations in μg/m³.
+type AirQuality struct {
+	Scale    AQIScale `json:"scale"`
+	Index    int      `json:"index"`
+	MaxIndex int      `json:"max_index"`
+	Category string   `json:"category"`
+	Advice   string   `json:"advice"`
+	PM25     float64  `json:"pm2_5"`
+	PM10     float64  `json:"pm10"`
+	O3       float64  `json:"o3"`
+	NO2      float64  `json:"no2"`
+	SO2      float64  `json:"so2"`
+	CO       float64  `json:"co"`
+}
+
+var epaBands = []struct{ category, advice string }{
+	{"Good", "Air quality is satisfactory. Enjoy your usual outdoor activities."},
+	{"Moderate", "Unusually sensitive people should consider reducing prolonged or heavy exertion outdoors."},
+	{"Unhealthy for sensitive groups", "Children, older adults and people with heart or lung disease should reduce prolonged or heavy exertion outdoors."},
+	{"Unhealthy", "Everyone should reduce prolonged or heavy exertion outdoors; sensitive groups should avoid it."},
+	{"Very unhealthy", "Everyone should avoid prolonged or heavy exertion outdoors; sensitive groups should stay indoors."},
+	{"Hazardous", "Everyone should avoid all physical activity outdoors."},
+}
+
+// defraBands cover indexes 1-3, 4-6, 7-9 and 10, with the UK government's
+// advice for the general population.
+var defraBands = []struct{ category, advice string }{
+	{"Low", "Enjoy your usual outdoor activities."},
+	{"Moderate", "Enjoy your usual outdoor activities. People with lung or heart problems who experience symptoms should consider reducing strenuous activity, particularly outdoors."},
+	{"High", "Anyone experiencing sore eyes, a cough or a sore throat should consider reducing activity, particularly outdoors. People with lung or heart problems should reduce strenuous exertion."},
+	{"Very high", "Reduce physical exertion, particularly outdoors, especially if you experience symptoms such as a cough or sore throat. People with lung or heart problems and older people should avoid strenuous activity."},
+}
+
+// NewAirQuality picks the index of the scale from the EPA and DEFRA indexes
+// and fills in its category and health advice.
+func NewAirQuality(scale AQIScale, epaIndex, defraIndex int) AirQuality {
+	if scale != AQIScaleDEFRA {
+		scale = AQIScaleEPA
+	}
+
+	reading := AirQuality{Scale: scale, MaxIndex: scale.MaxIndex()}
+	if scale == AQIScaleDEFRA {
+		reading.Index = defraIndex
+		if defraIndex >= 1 && defraIndex <= 10 {
+			band := defraBands[min((defraIndex-1)/3, len(defraBands)-1)]
+			reading.Category, reading.Advice = band.category, band.advice
+		}
+		return reading
+	}
+
+	reading.Index = epaIndex
+	if epaIndex >= 1 && epaIndex <= len(epaBands) {
+		band := epaBands[epaIndex-1]
+		reading.Category, reading.Advice = band.category, band.advice
+	}
+
+	return reading
+}
+
+// AirQualityFromReport converts a source's air quality report to a reading on
+// the scale.
+func AirQualityFromReport(scale AQIScale, report *weatherProvider.AirQuality) AirQuality {
+	reading := NewAirQuality(scale, report.USEPAIndex, report.GBDEFRAIndex)
+	reading.PM25 = report.PM25
+	reading.PM10 = report.PM10
+	reading.O3 = report.O3
+	reading.NO2 = report.NO2
+	reading.SO2 = report.SO2
+	reading.CO = report.CO
+
+	return reading
+}
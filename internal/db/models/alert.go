@@ -0,0 +1,83 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+type AlertSeverity string
+
+const (
+	SeverityMinor    AlertSeverity = "minor"
+	SeverityModerate AlertSeverity = "moderate"
+	SeveritySevere   AlertSeverity = "severe"
+	SeverityExtreme  AlertSeverity = "extreme"
+)
+
+var severityRanks = map[AlertSeverity]int{
+	SeverityMinor:    1,
+	SeverityModerate: 2,
+	SeveritySevere:   3,
+	SeverityExtreme:  4,
+}
+
+// ParseAlertSeverity normalizes a CAP severity ("Severe", "extreme", ...).
+func ParseAlertSeverity(value string) (AlertSeverity, bool) {
+	severity := AlertSeverity(strings.ToLower(strings.TrimSpace(value)))
+	_, ok := severityRanks[severity]
+	return severity, ok
+}
+
+// Rank orders severities from minor (1) to extreme (4). Unknown severities
+// rank as minor.
+func (s AlertSeverity) Rank() int {
+	if rank, ok := severityRanks[AlertSeverity(strings.ToLower(string(s)))]; ok {
+		return rank
+	}
+
+	return severityRanks[SeverityMinor]
+}
+
+// AlertPreferences configure the weather alerts of a city subscription.
+type AlertPreferences struct {
+	Enabled     bool          `json:"enabled"`
+	MinSeverity AlertSeverity `json:"min_severity"`
+	// Categories restrict alerts to those whose category or event contains
+	// one of them (case-insensitive). Empty means every category.
+	Categories []string `json:"categories"`
+}
+
+// Matches reports whether an alert passes the severity and category filters.
+func (p AlertPreferences) Matches(alert *WeatherAlert) bool {
+	if AlertSeverity(alert.Severity).Rank() < p.MinSeverity.Rank() {
+		return false
+	}
+	if len(p.Categories) == 0 {
+		return true
+	}
+
+	category := strings.ToLower(alert.Category)
+	event := strings.ToLower(alert.Event)
+	for _, wanted := range p.Categories {
+		wanted = strings.ToLower(strings.TrimSpace(wanted))
+		if wanted != "" && (strings.Contains(category, wanted) || strings.Contains(event, wanted)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WeatherAlert is a severe weather warning issued for a subscription's city.
+type WeatherAlert struct {
+	Headline    string    `json:"headline"`
+	Event       string    `json:"event"`
+	Severity    string    `json:"severity"`
+	Urgency     string    `json:"urgency"`
+	Category    string    `json:"category"`
+	Areas       string    `json:"areas"`
+	Effective   time.Time `json:"effective"`
+	Expires     time.Time `json:"expires"`
+	Description string    `json:"description"`
+	Instruction string    `json:"instruction"`
+}
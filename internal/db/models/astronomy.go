@@ -0,0 +1,115 @@
+package models
+
+import "time"
+
+// Light windows around sunrise and sunset, approximated for mid-latitudes
+// where the sun takes about 5 minutes to move a degree near the horizon: the
+// blue hour (sun 6° to 4° below the horizon) and the golden hour (4° below to
+// 6° above).
+const (
+	blueHourLength   = 10 * time.Minute
+	goldenHourBefore = 15 * time.Minute // sunrise is at 0.8° below the horizon
+	goldenHourAfter  = 35 * time.Minute
+)
+
+// AstronomyForecast is the photographers' digest sent to an astronomy
+// subscriber for one day and the following night.
+type AstronomyForecast struct {
+	Location string    `json:"location"`
+	Date     time.Time `json:"date"`
+	Source   string    `json:"source"`
+
+	Sunrise           time.Time  `json:"sunrise"`
+	Sunset            time.Time  `json:"sunset"`
+	MorningBlueHour   TimeWindow `json:"morning_blue_hour"`
+	MorningGoldenHour TimeWindow `json:"morning_golden_hour"`
+	EveningGoldenHour TimeWindow `json:"evening_golden_hour"`
+	EveningBlueHour   TimeWindow `json:"evening_blue_hour"`
+
+	Moonrise         string `json:"moonrise,omitempty"`
+	Moonset          string `json:"moonset,omitempty"`
+	MoonPhase        string `json:"moon_phase"`
+	MoonIllumination int    `json:"moon_illumination"`
+
+	// Night runs from the end of the evening blue hour to the start of the
+	// next morning's.
+	Night      TimeWindow        `json:"night"`
+	NightHours []CloudForecast   `json:"night_hours"`
+	Stargazing StargazingVerdict `json:"stargazing"`
+}
+
+type TimeWindow struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// CloudForecast is the forecast cloud cover, in percent, of an hour.
+type CloudForecast struct {
+	Time       time.Time `json:"time"`
+	CloudCover int       `json:"cloud_cover"`
+}
+
+type StargazingRating string
+
+const (
+	StargazingExcellent StargazingRating = "excellent"
+	StargazingGood      StargazingRating = "good"
+	StargazingFair      StargazingRating = "fair"
+	StargazingPoor      StargazingRating = "poor"
+	StargazingUnknown   StargazingRating = "unknown"
+)
+
+type StargazingVerdict struct {
+	Rating StargazingRating `json:"rating"`
+	Reason string           `json:"reason"`
+	// AverageCloudCover is the mean cloud cover over the night in percent.
+	AverageCloudCover int `json:"average_cloud_cover"`
+	// ClearestHour is the night hour with the least cloud.
+	ClearestHour *time.Time `json:"clearest_hour,omitempty"`
+}
+
+// LightWindows returns the blue and golden hours of a day from its sunrise
+// and sunset.
+func LightWindows(sunrise, sunset time.Time) (morningBlue, morningGolden, eveningGolden, eveningBlue TimeWindow) {
+	morningGolden = TimeWindow{Start: sunrise.Add(-goldenHourBefore), End: sunrise.Add(goldenHourAfter)}
+	morningBlue = TimeWindow{Start: morningGolden.Start.Add(-blueHourLength), End: morningGolden.Start}
+	eveningGolden = TimeWindow{Start: sunset.Add(-goldenHourAfter), End: sunset.Add(goldenHourBefore)}
+	eveningBlue = TimeWindow{Start: eveningGolden.End, End: eveningGolden.End.Add(blueHourLength)}
+
+	return morningBlue, morningGolden, eveningGolden, eveningBlue
+}
+
+// Stargazing rates the night from the hourly cloud cover and the moon's
+// illumination: clear skies come first, and a bright moon hides faint stars.
+func Stargazing(hours []CloudForecast, moonIllumination int) StargazingVerdict {
+	if len(hours) == 0 {
+		return StargazingVerdict{Rating: StargazingUnknown, Reason: "There is no cloud forecast for tonight."}
+	}
+
+	total := 0
+	clearest := hours[0]
+	for _, hour := range hours {
+		total += hour.CloudCover
+		if hour.CloudCover < clearest.CloudCover {
+			clearest = hour
+		}
+	}
+
+	verdict := StargazingVerdict{
+		AverageCloudCover: total / len(hours),
+		ClearestHour:      &clearest.Time,
+	}
+
+	switch {
+	case verdict.AverageCloudCover <= 20 && moonIllumination <= 30:
+		verdict.Rating, verdict.Reason = StargazingExcellent, "Clear and dark skies."
+	case verdict.AverageCloudCover <= 20:
+		verdict.Rating, verdict.Reason = StargazingGood, "Clear skies, but the bright moon washes out faint stars."
+	case verdict.AverageCloudCover <= 50:
+		verdict.Rating, verdict.Reason = StargazingFair, "Partly cloudy; look for gaps in the clouds."
+	default:
+		verdict.Rating, verdict.Reason = StargazingPoor, "Mostly cloudy; the stars will be hidden."
+	}
+
+	return verdict
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ChannelKind is a way of delivering a subscription's messages.
+type ChannelKind string
+
+const (
+	// EmailChannel is the subscriber's own address, confirmed together with
+	// the subscription.
+	EmailChannel ChannelKind = "email"
+	// WebhookChannel posts JSON signed with HMAC-SHA256 to a URL.
+	WebhookChannel ChannelKind = "webhook"
+	// SlackChannel posts to a Slack-compatible incoming webhook.
+	SlackChannel ChannelKind = "slack"
+	// TelegramChannel sends to a Telegram chat through the Bot API.
+	TelegramChannel ChannelKind = "telegram"
+)
+
+var ChannelKinds = []ChannelKind{EmailChannel, WebhookChannel, SlackChannel, TelegramChannel}
+
+func ParseChannelKind(value string) (ChannelKind, bool) {
+	kind := ChannelKind(strings.ToLower(strings.TrimSpace(value)))
+	switch kind {
+	case EmailChannel, WebhookChannel, SlackChannel, TelegramChannel:
+		return kind, true
+	default:
+		return kind, false
+	}
+}
+
+// DeliveryChannel is a destination a subscriber registered besides their
+// email address. It receives messages once confirmed, for the subscriptions
+// whose Channels list its kind.
+type DeliveryChannel struct {
+	ID           uint        `json:"id"`
+	SubscriberID uint        `json:"subscriber_id"`
+	Kind         ChannelKind `json:"kind"`
+	// Target is the webhook URL, or the Telegram chat id. Webhook and Slack
+	// URLs are secrets, so only TargetHint is shown.
+	Target string `json:"-"`
+	// Secret signs webhook requests.
+	Secret      string     `json:"-"`
+	Token       string     `json:"-"`
+	Confirmed   bool       `json:"confirmed"`
+	ConfirmedAt *time.Time `json:"confirmed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// MarshalJSON adds the TargetHint as "target_hint".
+func (c DeliveryChannel) MarshalJSON() ([]byte, error) {
+	type channel DeliveryChannel
+	return json.Marshal(struct {
+		channel
+		TargetHint string `json:"target_hint"`
+	}{channel(c), c.TargetHint()})
+}
+
+// TargetHint tells the subscriber's channels apart without revealing their
+// URLs: the scheme and host of a webhook or Slack URL, or the Telegram chat.
+func (c DeliveryChannel) TargetHint() string {
+	if c.Kind == TelegramChannel {
+		return c.Target
+	}
+
+	target, err := url.Parse(c.Target)
+	if err != nil || target.Host == "" {
+		return ""
+	}
+
+	return target.Scheme + "://" + target.Host + "/…"
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+type DeliveryJobStatus string
+
+const (
+	DeliveryJobPending DeliveryJobStatus = "pending"
+	DeliveryJobRunning DeliveryJobStatus = "running"
+	DeliveryJobSent    DeliveryJobStatus = "sent"
+	DeliveryJobFailed  DeliveryJobStatus = "failed"
+)
+
+// DeliveryJob is one scheduled weather update for a subscription.
+type DeliveryJob struct {
+	ID             int64             `json:"id"`
+	SubscriptionID uint              `json:"subscription_id"`
+	ScheduledFor   time.Time         `json:"scheduled_for"`
+	Status         DeliveryJobStatus `json:"status"`
+	Attempts       int               `json:"attempts"`
+	NextAttemptAt  time.Time         `json:"next_attempt_at"`
+	LastError      *string           `json:"last_error,omitempty"`
+	CreatedAt      time.Time         `json:"created_at"`
+	SentAt         *time.Time        `json:"sent_at,omitempty"`
+	ClaimedBy      string            `json:"-"`                  // identity of the current claim
+	Delivered      []string          `json:"delivered_channels"` // channels reached by earlier attempts
+
+	// Subscription is loaded together with the job when it is claimed.
+	Subscription *Subscription `json:"-"`
+}
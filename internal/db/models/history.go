@@ -0,0 +1,56 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// sameTemperature is the largest difference, in °C, still described as
+// about the same.
+const sameTemperature = 0.5
+
+// WeatherHistory puts a daily digest next to the same date last year and the
+// week before it. Deltas compare average temperatures and are nil when that
+// part of the history is missing.
+type WeatherHistory struct {
+	LastYear      *PastDay  `json:"last_year,omitempty"`
+	Week          []PastDay `json:"week,omitempty"`
+	LastYearDelta *float64  `json:"last_year_delta,omitempty"`
+	WeekAvg       *float64  `json:"week_avg_temperature,omitempty"`
+	WeekDelta     *float64  `json:"week_delta,omitempty"`
+}
+
+// PastDay is the observed weather of a past day.
+type PastDay struct {
+	Date           time.Time `json:"date"`
+	MinTemperature float64   `json:"min_temperature"`
+	MaxTemperature float64   `json:"max_temperature"`
+	AvgTemperature float64   `json:"avg_temperature"`
+	TotalPrecipMm  float64   `json:"total_precip_mm"`
+	Description    string    `json:"description"`
+}
+
+// TemperatureDelta phrases a temperature difference against a reference,
+// rounded to whole degrees.
+func TemperatureDelta(delta float64, than string) string {
+	rounded := RoundDelta(delta)
+	switch {
+	case rounded > 0:
+		return fmt.Sprintf("%.0f°C warmer than %s", rounded, than)
+	case rounded < 0:
+		return fmt.Sprintf("%.0f°C colder than %s", -rounded, than)
+	default:
+		return fmt.Sprintf("about as warm as %s", than)
+	}
+}
+
+// RoundDelta rounds a temperature difference to whole degrees, or to zero
+// when it is about the same.
+func RoundDelta(delta float64) float64 {
+	if math.Abs(delta) < sameTemperature {
+		return 0
+	}
+
+	return math.Round(delta)
+}
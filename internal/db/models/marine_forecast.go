@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// MarineForecast is the sea and surf report sent to a marine subscriber for
+// one day.
+type MarineForecast struct {
+	Location string    `json:"location"`
+	Date     time.Time `json:"date"`
+	Sunrise  string    `json:"sunrise,omitempty"`
+	Sunset   string    `json:"sunset,omitempty"`
+	Source   string    `json:"source"`
+	// HasWind and HasWaterTemp report whether the source provides wind and
+	// water temperature; without them those fields of the hours are 0.
+	HasWind      bool `json:"has_wind"`
+	HasWaterTemp bool `json:"has_water_temp"`
+
+	Tides []TideForecast       `json:"tides,omitempty"`
+	Hours []MarineHourForecast `json:"hours"`
+}
+
+type TideForecast struct {
+	Time    time.Time `json:"time"`
+	HeightM float64   `json:"height_m"`
+	Type    string    `json:"type"`
+}
+
+type MarineHourForecast struct {
+	Time         time.Time `json:"time"`
+	WaveHeightM  float64   `json:"wave_height_m"`
+	SwellHeightM float64   `json:"swell_height_m"`
+	SwellCompass string    `json:"swell_compass"`
+	SwellPeriodS float64   `json:"swell_period_s"`
+	WindKph      float64   `json:"wind_kph,omitempty"`
+	WindCompass  string    `json:"wind_compass,omitempty"`
+	WaterTempC   float64   `json:"water_temp_c,omitempty"`
+	// Tide marks the high or low tide falling within this hour, if any.
+	Tide string `json:"tide,omitempty"`
+}
@@ -0,0 +1,147 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// WeatherObservation is a reading of the current conditions stored for trend
+// analytics. A downsampled observation averages Samples readings of an hour;
+// MinTemperature, MaxTemperature and MaxWindSpeed keep their extremes.
+type WeatherObservation struct {
+	ID             int64     `json:"id"`
+	CityKey        string    `json:"-"`
+	City           string    `json:"city"`
+	Country        string    `json:"country"`
+	Lat            *float64  `json:"lat,omitempty"`
+	Lon            *float64  `json:"lon,omitempty"`
+	Timezone       string    `json:"timezone"`
+	Source         string    `json:"source"`
+	ObservedAt     time.Time `json:"observed_at"`
+	Temperature    float64   `json:"temperature"`
+	MinTemperature float64   `json:"min_temperature"`
+	MaxTemperature float64   `json:"max_temperature"`
+	Humidity       float64   `json:"humidity"`
+	WindSpeed      float64   `json:"wind_speed"`
+	MaxWindSpeed   float64   `json:"max_wind_speed"`
+	PrecipMm       float64   `json:"precip_mm"`
+	Description    string    `json:"description"`
+	Samples        int       `json:"samples"`
+	Downsampled    bool      `json:"downsampled"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// DailyObservations aggregates a city's observations over one local day.
+type DailyObservations struct {
+	Date           time.Time `json:"date"`
+	MinTemperature float64   `json:"min_temperature"`
+	MaxTemperature float64   `json:"max_temperature"`
+	AvgTemperature float64   `json:"avg_temperature"`
+	AvgHumidity    float64   `json:"avg_humidity"`
+	MaxWindSpeed   float64   `json:"max_wind_speed"`
+	Samples        int       `json:"samples"`
+}
+
+// RollingAverage is the mean daily temperature over the window of days
+// ending on Date. Days counts the days with observations in the window.
+type RollingAverage struct {
+	Date           time.Time `json:"date"`
+	AvgTemperature float64   `json:"avg_temperature"`
+	RollingAverage float64   `json:"rolling_average"`
+	Days           int       `json:"days"`
+}
+
+// TemperatureAnomaly is a day whose mean temperature departs from the
+// preceding days by at least the requested number of standard deviations.
+type TemperatureAnomaly struct {
+	Date           time.Time `json:"date"`
+	AvgTemperature float64   `json:"avg_temperature"`
+	Baseline       float64   `json:"baseline"`
+	Deviation      float64   `json:"deviation"`
+	ZScore         float64   `json:"z_score"`
+}
+
+// minBaselineDays is the fewest preceding days an anomaly is judged against.
+const minBaselineDays = 3
+
+// RollingAverages averages the daily means over window days, counting only
+// the days with observations. days must be sorted by date.
+func RollingAverages(days []DailyObservations, window int) []RollingAverage {
+	averages := make([]RollingAverage, 0, len(days))
+	for i, day := range days {
+		total, count := 0.0, 0
+		for _, previous := range days[:i+1] {
+			if previous.Date.After(day.Date.AddDate(0, 0, -window)) {
+				total += previous.AvgTemperature
+				count++
+			}
+		}
+
+		averages = append(averages, RollingAverage{
+			Date:           day.Date,
+			AvgTemperature: day.AvgTemperature,
+			RollingAverage: roundTenth(total / float64(count)),
+			Days:           count,
+		})
+	}
+
+	return averages
+}
+
+// Anomalies compares each day's mean with the mean and standard deviation of
+// the window days before it and returns the days at least threshold standard
+// deviations away. days must be sorted by date.
+func Anomalies(days []DailyObservations, window int, threshold float64) []TemperatureAnomaly {
+	anomalies := []TemperatureAnomaly{}
+	for i, day := range days {
+		var baseline []float64
+		for _, previous := range days[:i] {
+			if !previous.Date.Before(day.Date.AddDate(0, 0, -window)) {
+				baseline = append(baseline, previous.AvgTemperature)
+			}
+		}
+		if len(baseline) < minBaselineDays {
+			continue
+		}
+
+		mean, stddev := meanStddev(baseline)
+		if stddev == 0 {
+			continue
+		}
+
+		deviation := day.AvgTemperature - mean
+		zScore := deviation / stddev
+		if math.Abs(zScore) < threshold {
+			continue
+		}
+
+		anomalies = append(anomalies, TemperatureAnomaly{
+			Date:           day.Date,
+			AvgTemperature: day.AvgTemperature,
+			Baseline:       roundTenth(mean),
+			Deviation:      roundTenth(deviation),
+			ZScore:         math.Round(zScore*100) / 100,
+		})
+	}
+
+	return anomalies
+}
+
+func meanStddev(values []float64) (float64, float64) {
+	total := 0.0
+	for _, value := range values {
+		total += value
+	}
+	mean := total / float64(len(values))
+
+	variance := 0.0
+	for _, value := range values {
+		variance += (value - mean) * (value - mean)
+	}
+
+	return mean, math.Sqrt(variance / float64(len(values)))
+}
+
+func roundTenth(value float64) float64 {
+	return math.Round(value*10) / 10
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type OutboxKind string
+
+const (
+	ConfirmationEmail    OutboxKind = "confirmation_email"
+	ChannelConfirmation  OutboxKind = "channel_confirmation"
+	ManagementTokenEmail OutboxKind = "management_token_email"
+)
+
+type OutboxStatus string
+
+const (
+	OutboxPending OutboxStatus = "pending"
+	OutboxSent    OutboxStatus = "sent"
+	OutboxFailed  OutboxStatus = "failed"
+)
+
+type OutboxMessage struct {
+	ID            int64           `json:"id"`
+	Kind          OutboxKind      `json:"kind"`
+	Recipient     string          `json:"recipient"`
+	Payload       json.RawMessage `json:"payload"`
+	Status        OutboxStatus    `json:"status"`
+	Attempts      int             `json:"attempts"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	LastError     *string         `json:"last_error,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	SentAt        *time.Time      `json:"sent_at,omitempty"`
+}
+
+// ConfirmationEmailPayload is stored in the outbox for ConfirmationEmail messages.
+type ConfirmationEmailPayload struct {
+	City     string `json:"city"`
+	Token    string `json:"token"`
+	Language string `json:"language,omitempty"`
+}
+
+// ManagementTokenEmailPayload is stored in the outbox for
+// ManagementTokenEmail messages.
+type ManagementTokenEmailPayload struct {
+	Token    string `json:"token"`
+	Language string `json:"language,omitempty"`
+}
+
+// ChannelConfirmationPayload is stored in the outbox for ChannelConfirmation
+// messages.
+type ChannelConfirmationPayload struct {
+	ChannelID uint   `json:"channel_id"`
+	Token     string `json:"token"`
+	Language  string `json:"language,omitempty"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// CachedAPIResponse is a weather API response stored in the shared cache.
+type CachedAPIResponse struct {
+	Key        string              `json:"key"`
+	StatusCode int                 `json:"status_code"`
+	Header     map[string][]string `json:"header"`
+	Body       []byte              `json:"body"`
+	ExpiresAt  time.Time           `json:"expires_at"`
+}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// RuleField is the forecast value a rule watches. Hourly fields are checked
+// for every hour in the lookahead window (or the current conditions when the
+// window is zero), daily fields for every day the window touches.
+type RuleField string
+
+const (
+	RuleTemperature       RuleField = "temperature_c"
+	RuleFeelsLike         RuleField = "feels_like_c"
+	RuleWindSpeed         RuleField = "wind_kph"
+	RuleGustSpeed         RuleField = "gust_kph"
+	RuleHumidity          RuleField = "humidity"
+	RulePrecipitation     RuleField = "precip_mm"
+	RuleChanceOfRain      RuleField = "chance_of_rain"
+	RuleChanceOfSnow      RuleField = "chance_of_snow"
+	RuleDailyMaxTemp      RuleField = "daily_max_temp_c"
+	RuleDailyMinTemp      RuleField = "daily_min_temp_c"
+	RuleDailyPrecip       RuleField = "daily_total_precip_mm"
+	RuleDailyChanceOfRain RuleField = "daily_chance_of_rain"
+	RuleDailyChanceOfSnow RuleField = "daily_chance_of_snow"
+	RuleDailyUV           RuleField = "daily_uv"
+)
+
+var ruleFields = map[RuleField]struct {
+	label string
+	unit  string
+	daily bool
+}{
+	RuleTemperature:       {"Temperature", "°C", false},
+	RuleFeelsLike:         {"Feels-like temperature", "°C", false},
+	RuleWindSpeed:         {"Wind speed", " km/h", false},
+	RuleGustSpeed:         {"Wind gusts", " km/h", false},
+	RuleHumidity:          {"Humidity", "%", false},
+	RulePrecipitation:     {"Precipitation", " mm", false},
+	RuleChanceOfRain:      {"Chance of rain", "%", false},
+	RuleChanceOfSnow:      {"Chance of snow", "%", false},
+	RuleDailyMaxTemp:      {"Daily high", "°C", true},
+	RuleDailyMinTemp:      {"Daily low", "°C", true},
+	RuleDailyPrecip:       {"Daily precipitation", " mm", true},
+	RuleDailyChanceOfRain: {"Daily chance of rain", "%", true},
+	RuleDailyChanceOfSnow: {"Daily chance of snow", "%", true},
+	RuleDailyUV:           {"UV index", "", true},
+}
+
+func (f RuleField) Valid() bool {
+	_, ok := ruleFields[f]
+	return ok
+}
+
+// Daily reports whether the field is a per-day value.
+func (f RuleField) Daily() bool {
+	return ruleFields[f].daily
+}
+
+// Unit is the unit values of the field are shown with, e.g. " km/h".
+func (f RuleField) Unit() string {
+	return ruleFields[f].unit
+}
+
+type RuleComparator string
+
+const (
+	RuleAbove   RuleComparator = "gt"
+	RuleAtLeast RuleComparator = "gte"
+	RuleBelow   RuleComparator = "lt"
+	RuleAtMost  RuleComparator = "lte"
+)
+
+var ruleComparators = map[RuleComparator]string{
+	RuleAbove:   "above",
+	RuleAtLeast: "at least",
+	RuleBelow:   "below",
+	RuleAtMost:  "at most",
+}
+
+func (c RuleComparator) Valid() bool {
+	_, ok := ruleComparators[c]
+	return ok
+}
+
+// Compare reports whether value satisfies the comparator against threshold.
+func (c RuleComparator) Compare(value, threshold float64) bool {
+	switch c {
+	case RuleAbove:
+		return value > threshold
+	case RuleAtLeast:
+		return value >= threshold
+	case RuleBelow:
+		return value < threshold
+	case RuleAtMost:
+		return value <= threshold
+	default:
+		return false
+	}
+}
+
+// NotificationRule notifies the subscriber when the forecast for the
+// subscription's city meets a condition within the next LookaheadHours.
+type NotificationRule struct {
+	ID             uint           `json:"id"`
+	SubscriptionID uint           `json:"subscription_id"`
+	Field          RuleField      `json:"field"`
+	Comparator     RuleComparator `json:"comparator"`
+	Threshold      float64        `json:"threshold"`
+	LookaheadHours int            `json:"lookahead_hours"`
+	// Triggered is the state at the last evaluation; the rule fires when it
+	// turns true and re-arms when the condition stops being met.
+	Triggered   bool       `json:"triggered"`
+	LastFiredAt *time.Time `json:"last_fired_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+
+	// Subscription is loaded together with the rule for evaluation.
+	Subscription *Subscription `json:"-"`
+}
+
+// Describe renders the condition, e.g. "Wind gusts above 60 km/h".
+func (r *NotificationRule) Describe() string {
+	field := ruleFields[r.Field]
+	return fmt.Sprintf("%s %s %g%s", field.label, ruleComparators[r.Comparator], r.Threshold, field.unit)
+}
+
+// FormatValue renders a value of the rule's field with its unit.
+func (r *NotificationRule) FormatValue(value float64) string {
+	return fmt.Sprintf("%g%s", math.Round(value*10)/10, ruleFields[r.Field].unit)
+}
+
+// RuleMatch is the forecast value that made a rule fire.
+type RuleMatch struct {
+	Value float64 `json:"value"`
+	// At is the hour, or the day for daily fields, the value applies to.
+	At time.Time `json:"at"`
+}
@@ -1,6 +1,9 @@
 package models
 
 import (
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -9,14 +12,96 @@ type SubscriptionFrequency string
 const (
 	Daily  SubscriptionFrequency = "daily"
 	Hourly SubscriptionFrequency = "hourly"
+	Custom SubscriptionFrequency = "custom" // driven by Subscription.Schedule
 )
 
+// SubscriptionKind is what a subscription delivers for its location.
+type SubscriptionKind string
+
+const (
+	WeatherKind SubscriptionKind = "weather"
+	MarineKind  SubscriptionKind = "marine" // sea and surf report for a coastal location
+	// AstronomyKind is a digest of golden and blue hours, the moon and the
+	// night's stargazing conditions.
+	AstronomyKind SubscriptionKind = "astronomy"
+)
+
+type Subscriber struct {
+	ID    uint   `json:"id"`
+	Email string `json:"email"`
+	// ManagementToken authorizes listing and changing the subscriber's
+	// subscriptions. It is only ever sent to the subscriber's address.
+	ManagementToken string    `json:"-"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
 type Subscription struct {
-	ID        uint                  `json:"id"`
-	Email     string                `json:"email"`
-	City      string                `json:"city"`
-	Frequency SubscriptionFrequency `json:"frequency"` // daily, hourly
-	Token     string                `json:"token"`
-	Active    bool                  `json:"active"`
-	CreatedAt time.Time             `json:"created_at"`
+	ID               uint                  `json:"id"`
+	SubscriberID     uint                  `json:"subscriber_id"`
+	Email            string                `json:"email"`
+	City             string                `json:"city"`
+	Kind             SubscriptionKind      `json:"kind"`
+	Frequency        SubscriptionFrequency `json:"frequency"`          // daily, hourly, custom
+	Schedule         string                `json:"schedule,omitempty"` // cron expression for custom frequency
+	Timezone         string                `json:"timezone"`           // IANA name, e.g. Europe/Kyiv
+	DeliveryHour     int                   `json:"delivery_hour"`      // local hour of daily updates
+	Language         string                `json:"language"`           // language of the emails, e.g. de
+	Channels         []ChannelKind         `json:"channels"`           // kinds of channels messages are delivered to
+	Place            Place                 `json:"location"`
+	Alerts           AlertPreferences      `json:"alerts"`
+	AirQuality       AirQualityPreferences `json:"air_quality"`
+	Token            string                `json:"-"`
+	TokenExpiresAt   time.Time             `json:"-"`
+	UnsubscribeToken string                `json:"-"`
+	Confirmed        bool                  `json:"confirmed"`
+	ConfirmedAt      *time.Time            `json:"confirmed_at,omitempty"`
+	Active           bool                  `json:"active"`
+	LastScheduledAt  *time.Time            `json:"-"`
+	LastSentAt       *time.Time            `json:"last_sent_at,omitempty"`
+	CreatedAt        time.Time             `json:"created_at"`
+}
+
+// Languages emails are written in; DefaultLanguage is used for
+// subscriptions that do not choose one.
+var Languages = []string{"en", "de", "es", "fr", "uk"}
+
+const DefaultLanguage = "en"
+
+// ParseLanguage normalizes a language code and reports whether emails can be
+// written in it.
+func ParseLanguage(value string) (string, bool) {
+	language := strings.ToLower(strings.TrimSpace(value))
+	return language, slices.Contains(Languages, language)
+}
+
+// Place is the canonical location the subscription's City was resolved to;
+// City holds its name and Timezone its timezone. Subscriptions created before
+// locations were resolved have no ID or coordinates.
+type Place struct {
+	ID      int64    `json:"id,omitempty"`
+	Region  string   `json:"region,omitempty"`
+	Country string   `json:"country,omitempty"`
+	Lat     *float64 `json:"lat,omitempty"`
+	Lon     *float64 `json:"lon,omitempty"`
+}
+
+// LocationQuery is what the weather of the subscription is fetched for: the
+// coordinates of its location, or the city name if they are unknown.
+func (s *Subscription) LocationQuery() string {
+	if s.Place.Lat == nil || s.Place.Lon == nil {
+		return s.City
+	}
+
+	return strconv.FormatFloat(*s.Place.Lat, 'f', 4, 64) + "," + strconv.FormatFloat(*s.Place.Lon, 'f', 4, 64)
+}
+
+// Location returns the subscriber's timezone, falling back to UTC when it is
+// unknown to the tz database.
+func (s *Subscription) Location() *time.Location {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+
+	return loc
 }
@@ -2,12 +2,48 @@ package models
 
 import "time"
 
+// WeatherForecast is the weather sent to a subscriber: the current conditions
+// and, for daily digests, the forecast for the rest of the day.
 type WeatherForecast struct {
 	City        string    `json:"city"`
 	Temperature float64   `json:"temperature"`
 	Humidity    int       `json:"humidity"`
 	WindSpeed   float64   `json:"wind_speed"`
 	Description string    `json:"description"`
+	Condition   string    `json:"condition,omitempty"`
+	Source      string    `json:"source"`
 	ForecastFor time.Time `json:"forecast_for"`
 	CreatedAt   time.Time `json:"created_at"`
+
+	Day   *DailyForecast   `json:"day,omitempty"`
+	Hours []HourlyForecast `json:"hours,omitempty"`
+
+	AirQuality *AirQuality `json:"air_quality,omitempty"`
+
+	History *WeatherHistory `json:"history,omitempty"`
+}
+
+type DailyForecast struct {
+	MinTemperature float64 `json:"min_temperature"`
+	MaxTemperature float64 `json:"max_temperature"`
+	AvgTemperature float64 `json:"avg_temperature"`
+	MaxWindSpeed   float64 `json:"max_wind_speed"`
+	TotalPrecipMm  float64 `json:"total_precip_mm"`
+	ChanceOfRain   int     `json:"chance_of_rain"`
+	ChanceOfSnow   int     `json:"chance_of_snow"`
+	UV             float64 `json:"uv"`
+	Description    string  `json:"description"`
+	Condition      string  `json:"condition,omitempty"`
+	Sunrise        string  `json:"sunrise"`
+	Sunset         string  `json:"sunset"`
+}
+
+type HourlyForecast struct {
+	Time         time.Time `json:"time"`
+	Temperature  float64   `json:"temperature"`
+	Description  string    `json:"description"`
+	Condition    string    `json:"condition,omitempty"`
+	ChanceOfRain int       `json:"chance_of_rain"`
+	ChanceOfSnow int       `json:"chance_of_snow"`
+	WindSpeed    float64   `json:"wind_speed"`
 }
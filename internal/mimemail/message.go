@@ -0,0 +1,223 @@
+// Package mimemail builds email messages: RFC 5322 headers with RFC 2047
+// encoded words for non-ASCII subjects, and a multipart/alternative body with
+// plain-text and HTML parts. Images referenced from the HTML as
+// "cid:<content id>" are attached inline, wrapping the alternatives in
+// multipart/related.
+//
+// The output only depends on the message, so the same message always
+// produces the same bytes: boundaries are derived from the content and extra
+// headers are written in sorted order. Callers choose the Date and the
+// Message-ID.
+package mimemail
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+)
+
+// base64LineLength is the longest line of a base64 body (RFC 2045).
+const base64LineLength = 76
+
+// Message is an email with a plain-text and an optional HTML body.
+type Message struct {
+	From    string
+	To      []string
+	Subject string
+	Date    time.Time
+	// MessageID is the unique id of the message, without angle brackets,
+	// e.g. "1234.5678@example.com".
+	MessageID string
+	// Headers are written after the standard ones, sorted by name.
+	Headers map[string]string
+
+	Text string
+	HTML string
+	// Inline holds the images the HTML shows, referenced as cid:<ContentID>.
+	Inline []Inline
+}
+
+// Inline is an image embedded in the message.
+type Inline struct {
+	ContentID   string
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Bytes renders the message with CRLF line endings, ready for SMTP.
+func (m *Message) Bytes() ([]byte, error) {
+	var b bytes.Buffer
+	if _, err := m.WriteTo(&b); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// WriteTo writes the rendered message to w.
+func (m *Message) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+
+	header(&b, "From", m.From)
+	header(&b, "To", strings.Join(m.To, ", "))
+	header(&b, "Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header(&b, "Date", m.Date.Format(time.RFC1123Z))
+	if m.MessageID != "" {
+		header(&b, "Message-ID", "<"+m.MessageID+">")
+	}
+	header(&b, "MIME-Version", "1.0")
+
+	names := make([]string, 0, len(m.Headers))
+	for name := range m.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		header(&b, name, m.Headers[name])
+	}
+
+	if err := m.writeBody(&b); err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(b.Bytes())
+	return int64(n), err
+}
+
+// writeBody writes the Content-Type header and the body: a single text part,
+// the alternatives, or the alternatives related to their inline images.
+func (m *Message) writeBody(b *bytes.Buffer) error {
+	if m.HTML == "" {
+		header(b, "Content-Type", `text/plain; charset="utf-8"`)
+		header(b, "Content-Transfer-Encoding", "quoted-printable")
+		b.WriteString("\r\n")
+		return writeQuotedPrintable(b, m.Text)
+	}
+
+	boundary := m.boundary()
+	if len(m.Inline) == 0 {
+		header(b, "Content-Type", fmt.Sprintf("multipart/alternative; boundary=%q", boundary+"alt"))
+		b.WriteString("\r\n")
+		return m.writeAlternatives(b, boundary+"alt")
+	}
+
+	header(b, "Content-Type", fmt.Sprintf("multipart/related; type=\"multipart/alternative\"; boundary=%q", boundary+"rel"))
+	b.WriteString("\r\n")
+
+	related := multipart.NewWriter(b)
+	if err := related.SetBoundary(boundary + "rel"); err != nil {
+		return err
+	}
+
+	part, err := related.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {fmt.Sprintf("multipart/alternative; boundary=%q", boundary+"alt")},
+	})
+	if err != nil {
+		return err
+	}
+	var alternatives bytes.Buffer
+	if err := m.writeAlternatives(&alternatives, boundary+"alt"); err != nil {
+		return err
+	}
+	if _, err := part.Write(alternatives.Bytes()); err != nil {
+		return err
+	}
+
+	for _, image := range m.Inline {
+		part, err := related.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType(image.ContentType, map[string]string{"name": image.Filename})},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-ID":                {"<" + image.ContentID + ">"},
+			"Content-Disposition":       {mime.FormatMediaType("inline", map[string]string{"filename": image.Filename})},
+		})
+		if err != nil {
+			return err
+		}
+		if err := writeBase64(part, image.Data); err != nil {
+			return err
+		}
+	}
+
+	return related.Close()
+}
+
+func (m *Message) writeAlternatives(w io.Writer, boundary string) error {
+	alternative := multipart.NewWriter(w)
+	if err := alternative.SetBoundary(boundary); err != nil {
+		return err
+	}
+
+	for _, body := range []struct{ contentType, content string }{
+		{`text/plain; charset="utf-8"`, m.Text},
+		{`text/html; charset="utf-8"`, m.HTML},
+	} {
+		part, err := alternative.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {body.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return err
+		}
+		if err := writeQuotedPrintable(part, body.content); err != nil {
+			return err
+		}
+	}
+
+	return alternative.Close()
+}
+
+// boundary is derived from the content. It starts with "=_", which can occur
+// neither in quoted-printable nor in base64 text, so it never collides with
+// a body.
+func (m *Message) boundary() string {
+	hash := sha256.New()
+	io.WriteString(hash, m.Text)
+	io.WriteString(hash, m.HTML)
+	for _, image := range m.Inline {
+		io.WriteString(hash, image.ContentID)
+		hash.Write(image.Data)
+	}
+
+	return "=_" + hex.EncodeToString(hash.Sum(nil))[:32]
+}
+
+func header(b *bytes.Buffer, name, value string) {
+	// Header values must not break out of their line.
+	value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+	fmt.Fprintf(b, "%s: %s\r\n", name, value)
+}
+
+func writeQuotedPrintable(w io.Writer, text string) error {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	qp := quotedprintable.NewWriter(w)
+	if _, err := io.WriteString(qp, text); err != nil {
+		return err
+	}
+
+	return qp.Close()
+}
+
+func writeBase64(w io.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 0 {
+		line := encoded[:min(len(encoded), base64LineLength)]
+		encoded = encoded[len(line):]
+		if _, err := io.WriteString(w, line+"\r\n"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
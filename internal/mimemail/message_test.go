@@ -0,0 +1,97 @@
+package mimemail
+
+import (
+	"bytes"
+	"flag"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// pixel is a 1x1 transparent PNG.
+var pixel = []byte{
+	0x89, 0x50, 0x4e, 0x47, 0x0d, 0x0a, 0x1a, 0x0a, 0x00, 0x00, 0x00, 0x0d,
+	0x49, 0x48, 0x44, 0x52, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01,
+	0x08, 0x06, 0x00, 0x00, 0x00, 0x1f, 0x15, 0xc4, 0x89, 0x00, 0x00, 0x00,
+	0x0d, 0x49, 0x44, 0x41, 0x54, 0x78, 0x9c, 0x63, 0x60, 0x00, 0x02, 0x00,
+	0x00, 0x05, 0x00, 0x01, 0x7a, 0x5e, 0xab, 0x3f, 0x00, 0x00, 0x00, 0x00,
+	0x49, 0x45, 0x4e, 0x44, 0xae, 0x42, 0x60, 0x82,
+}
+
+func testMessage() Message {
+	return Message{
+		From:      "Weather Updates <weather@example.com>",
+		To:        []string{"subscriber@example.com"},
+		Subject:   "Weather update for Kyiv: 21°C",
+		Date:      time.Date(2024, time.May, 1, 8, 0, 0, 0, time.UTC),
+		MessageID: "1714550400.42@example.com",
+		Headers: map[string]string{
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+			"List-Unsubscribe":      "<https://weather.example.com/api/unsubscribe/token>",
+		},
+		Text: "Kyiv: 21°C, partly cloudy.\n\nUnsubscribe: https://weather.example.com/api/unsubscribe/token",
+	}
+}
+
+func TestMessageBytes(t *testing.T) {
+	alternative := testMessage()
+	alternative.HTML = `<h2>Kyiv</h2><p>21°C, partly cloudy.</p>`
+
+	related := testMessage()
+	related.HTML = `<h2>Kyiv</h2><p><img src="cid:partly-cloudy" alt="Partly cloudy"> 21°C</p>`
+	related.Inline = []Inline{{
+		ContentID:   "partly-cloudy",
+		Filename:    "partly-cloudy.png",
+		ContentType: "image/png",
+		Data:        pixel,
+	}}
+
+	tests := []struct {
+		name    string
+		message Message
+	}{
+		{"text", testMessage()},
+		{"alternative", alternative},
+		{"related", related},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.message.Bytes()
+			if err != nil {
+				t.Fatalf("Bytes() error = %v", err)
+			}
+
+			golden := filepath.Join("testdata", tt.name+".golden")
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("Bytes() = \n%s\nwant\n%s", got, want)
+			}
+
+			parsed, err := mail.ReadMessage(bytes.NewReader(got))
+			if err != nil {
+				t.Fatalf("mail.ReadMessage() error = %v", err)
+			}
+			subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+			if err != nil {
+				t.Fatalf("decoding the subject: %v", err)
+			}
+			if subject != tt.message.Subject {
+				t.Errorf("decoded subject = %q, want %q", subject, tt.message.Subject)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package mimemail
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var (
+	spaces       = regexp.MustCompile(`[ \t\r\n]+`)
+	doubleSpaces = regexp.MustCompile(` {2,}`)
+	lineSpaces   = regexp.MustCompile(` *\n *`)
+	blankLines   = regexp.MustCompile(`\n{3,}`)
+	blockClosers = map[string]bool{"p": true, "div": true, "ul": true, "ol": true, "table": true, "h1": true, "h2": true, "h3": true, "h4": true}
+)
+
+// PlainText renders HTML as readable plain text for the text/plain
+// alternative: blocks become paragraphs, list items dashes, table rows lines
+// with cells separated by " | ", and links show their target in parentheses.
+// Images show their alt text.
+func PlainText(markup string) string {
+	var (
+		b         strings.Builder
+		tokenizer = html.NewTokenizer(strings.NewReader(markup))
+		skip      int
+		href      string
+		linkStart int
+		firstCell bool
+	)
+
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			text := lineSpaces.ReplaceAllString(doubleSpaces.ReplaceAllString(b.String(), " "), "\n")
+			return strings.TrimSpace(blankLines.ReplaceAllString(text, "\n\n"))
+
+		case html.TextToken:
+			if skip == 0 {
+				b.WriteString(spaces.ReplaceAllString(string(tokenizer.Text()), " "))
+			}
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			switch token.Data {
+			case "style", "script", "head":
+				skip++
+			case "br":
+				b.WriteString("\n")
+			case "p", "div", "h1", "h2", "h3", "h4", "ul", "ol", "table":
+				b.WriteString("\n\n")
+			case "li":
+				b.WriteString("\n- ")
+			case "tr":
+				b.WriteString("\n")
+				firstCell = true
+			case "td", "th":
+				if !firstCell {
+					b.WriteString(" | ")
+				}
+				firstCell = false
+			case "a":
+				href, linkStart = attribute(token, "href"), b.Len()
+			case "img":
+				b.WriteString(attribute(token, "alt"))
+			}
+
+		case html.EndTagToken:
+			token := tokenizer.Token()
+			switch {
+			case token.Data == "style" || token.Data == "script" || token.Data == "head":
+				skip = max(skip-1, 0)
+			case blockClosers[token.Data]:
+				b.WriteString("\n\n")
+			case token.Data == "a" && href != "":
+				if text := strings.TrimSpace(b.String()[linkStart:]); text != href {
+					b.WriteString(" (" + href + ")")
+				}
+				href = ""
+			}
+		}
+	}
+}
+
+func attribute(token html.Token, name string) string {
+	for _, attr := range token.Attr {
+		if attr.Key == name {
+			return attr.Val
+		}
+	}
+
+	return ""
+}
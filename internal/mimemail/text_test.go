@@ -0,0 +1,45 @@
+package mimemail
+
+import "testing"
+
+func TestPlainText(t *testing.T) {
+	tests := []struct {
+		name   string
+		markup string
+		want   string
+	}{
+		{
+			name:   "paragraphs",
+			markup: "<h2>Kyiv</h2>\n<p>Partly   cloudy,\n21°C.</p><p>Light wind.</p>",
+			want:   "Kyiv\n\nPartly cloudy, 21°C.\n\nLight wind.",
+		},
+		{
+			name:   "list",
+			markup: "<p>Today:</p><ul><li>Rain</li><li>Wind</li></ul>",
+			want:   "Today:\n\n- Rain\n- Wind",
+		},
+		{
+			name:   "table",
+			markup: "<table><tr><th>Time</th><th>Temp</th></tr><tr><td>09:00</td><td>18°C</td></tr></table>",
+			want:   "Time | Temp\n09:00 | 18°C",
+		},
+		{
+			name:   "links",
+			markup: `<p><a href="https://example.com/u">Unsubscribe</a> or <a href="https://example.com">https://example.com</a></p>`,
+			want:   "Unsubscribe (https://example.com/u) or https://example.com",
+		},
+		{
+			name:   "images and skipped elements",
+			markup: `<head><style>p { color: red; }</style></head><p><img src="cid:sun" alt="Sunny"> 25°C<br>Dry</p><script>alert(1)</script>`,
+			want:   "Sunny 25°C\nDry",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PlainText(tt.markup); got != tt.want {
+				t.Errorf("PlainText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package netguard
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "8.8.8.8", want: true},
+		{ip: "1.1.1.1", want: true},
+		{ip: "100.63.255.255", want: true},
+		{ip: "100.128.0.0", want: true},
+		{ip: "198.17.255.255", want: true},
+		{ip: "198.20.0.0", want: true},
+		{ip: "223.255.255.255", want: true},
+		{ip: "2606:4700:4700::1111", want: true},
+		{ip: "2a00:1450:4001::200e", want: true},
+		{ip: "::ffff:8.8.8.8", want: true},
+
+		{ip: "0.0.0.0", want: false},
+		{ip: "0.1.2.3", want: false},
+		{ip: "10.0.0.1", want: false},
+		{ip: "100.64.0.1", want: false},
+		{ip: "100.127.255.254", want: false},
+		{ip: "127.0.0.1", want: false},
+		{ip: "169.254.169.254", want: false},
+		{ip: "172.16.0.1", want: false},
+		{ip: "172.31.255.255", want: false},
+		{ip: "192.0.0.8", want: false},
+		{ip: "192.0.2.1", want: false},
+		{ip: "192.88.99.1", want: false},
+		{ip: "192.168.1.1", want: false},
+		{ip: "198.18.0.1", want: false},
+		{ip: "198.19.255.255", want: false},
+		{ip: "198.51.100.7", want: false},
+		{ip: "203.0.113.9", want: false},
+		{ip: "224.0.0.1", want: false},
+		{ip: "240.0.0.1", want: false},
+		{ip: "255.255.255.255", want: false},
+		{ip: "::", want: false},
+		{ip: "::1", want: false},
+		{ip: "::ffff:127.0.0.1", want: false},
+		{ip: "::ffff:10.1.2.3", want: false},
+		{ip: "64:ff9b::a00:1", want: false},
+		{ip: "64:ff9b:1::1", want: false},
+		{ip: "100::1", want: false},
+		{ip: "2001::1", want: false},
+		{ip: "2001:db8::1", want: false},
+		{ip: "2002:a00:1::1", want: false},
+		{ip: "fc00::1", want: false},
+		{ip: "fd12:3456::1", want: false},
+		{ip: "fe80::1", want: false},
+		{ip: "ff02::1", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			ip := net.ParseIP(tt.ip)
+			if ip == nil {
+				t.Fatalf("ParseIP(%q) failed", tt.ip)
+			}
+			if got := IsPublic(ip); got != tt.want {
+				t.Errorf("IsPublic(%s) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsPublicInvalid(t *testing.T) {
+	for _, ip := range []net.IP{nil, {}, {1, 2, 3}} {
+		if IsPublic(ip) {
+			t.Errorf("IsPublic(%v) = true, want false", ip)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+// Package schedule parses and evaluates the cron-like expressions used for
+// custom subscription schedules.
+//
+// An expression has the five standard cron fields:
+//
+//	minute hour day-of-month month day-of-week
+//
+// Each field accepts "*", single values, ranges ("8-20"), lists ("1,15")
+// and steps ("*/3", "8-20/3"). Months and weekdays also accept three-letter
+// names ("JAN", "MON-FRI"); Sunday is 0 or 7. As in classic cron, when both
+// day-of-month and day-of-week are restricted a day matching either fires.
+// The descriptors @hourly, @daily, @weekly and @monthly are supported too.
+//
+// Examples:
+//
+//	30 6 * * MON-FRI   weekdays at 06:30
+//	0 8-20/3 * * *     every 3 hours between 08:00 and 20:00
+//	0 17 * * FRI       Fridays at 17:00
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression.
+type Schedule struct {
+	expr   string
+	minute bits
+	hour   bits
+	dom    bits
+	month  bits
+	dow    bits
+	anyDom bool
+	anyDow bool
+}
+
+// bits is a set of allowed values, one bit per value.
+type bits uint64
+
+func (b bits) has(v int) bool {
+	return b&(1<<uint(v)) != 0
+}
+
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowField = field{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var descriptors = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// Parse parses a cron expression.
+func Parse(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	spec := expr
+	if d, ok := descriptors[strings.ToLower(spec)]; ok {
+		spec = d
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: expected 5 fields, got %d", expr, len(fields))
+	}
+
+	s := &Schedule{expr: expr}
+	var err error
+	if s.minute, err = minuteField.parse(fields[0]); err != nil {
+		return nil, err
+	}
+	if s.hour, err = hourField.parse(fields[1]); err != nil {
+		return nil, err
+	}
+	if s.dom, err = domField.parse(fields[2]); err != nil {
+		return nil, err
+	}
+	if s.month, err = monthField.parse(fields[3]); err != nil {
+		return nil, err
+	}
+	if s.dow, err = dowField.parse(fields[4]); err != nil {
+		return nil, err
+	}
+
+	// Sunday may be written as 7.
+	if s.dow.has(7) {
+		s.dow |= 1
+	}
+	s.anyDom = fields[2] == "*"
+	s.anyDow = fields[4] == "*"
+
+	return s, nil
+}
+
+func (f field) parse(expr string) (bits, error) {
+	var set bits
+	for _, part := range strings.Split(expr, ",") {
+		b, err := f.parsePart(part)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s %q: %w", f.name, expr, err)
+		}
+		set |= b
+	}
+
+	return set, nil
+}
+
+func (f field) parsePart(part string) (bits, error) {
+	rangePart, stepPart, hasStep := strings.Cut(part, "/")
+
+	step := 1
+	if hasStep {
+		var err error
+		if step, err = strconv.Atoi(stepPart); err != nil || step <= 0 {
+			return 0, fmt.Errorf("invalid step %q", stepPart)
+		}
+	}
+
+	var lo, hi int
+	switch {
+	case rangePart == "*":
+		lo, hi = f.min, f.max
+	case strings.Contains(rangePart, "-"):
+		from, to, _ := strings.Cut(rangePart, "-")
+		var err error
+		if lo, err = f.value(from); err != nil {
+			return 0, err
+		}
+		if hi, err = f.value(to); err != nil {
+			return 0, err
+		}
+		if lo > hi {
+			return 0, fmt.Errorf("range %q is reversed", rangePart)
+		}
+	default:
+		var err error
+		if lo, err = f.value(rangePart); err != nil {
+			return 0, err
+		}
+		hi = lo
+		// "5/15" means "from 5 to the end, every 15".
+		if hasStep {
+			hi = f.max
+		}
+	}
+
+	var set bits
+	for v := lo; v <= hi; v += step {
+		set |= 1 << uint(v)
+	}
+
+	return set, nil
+}
+
+func (f field) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("value %d out of range [%d, %d]", v, f.min, f.max)
+	}
+
+	return v, nil
+}
+
+// String returns the expression the schedule was parsed from.
+func (s *Schedule) String() string {
+	return s.expr
+}
+
+// Next returns the first time strictly after t that matches the schedule,
+// evaluated in t's location, or the zero time if there is none within five
+// years. Times skipped by a DST spring-forward transition never match, and a
+// wall-clock time repeated by a fall-back transition matches only once.
+func (s *Schedule) Next(t time.Time) time.Time {
+	after := wallClock(t)
+	for {
+		next := s.next(t)
+		if next.IsZero() || wallClock(next).After(after) {
+			return next
+		}
+		t = next
+	}
+}
+
+func (s *Schedule) next(t time.Time) time.Time {
+	loc := t.Location()
+
+	// Start at the next whole minute. Advancing by absolute durations (rather
+	// than rebuilding wall-clock times) keeps ambiguous fall-back times moving
+	// forward.
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	yearLimit := t.Year() + 5
+
+wrap:
+	if t.Year() > yearLimit {
+		return time.Time{}
+	}
+
+	for !s.month.has(int(t.Month())) {
+		t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		if t.Month() == time.January {
+			goto wrap
+		}
+	}
+
+	for !s.dayMatches(t) {
+		t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		if t.Day() == 1 {
+			goto wrap
+		}
+	}
+
+	for !s.hour.has(t.Hour()) {
+		t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+		if t.Hour() == 0 {
+			goto wrap
+		}
+	}
+
+	for !s.minute.has(t.Minute()) {
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto wrap
+		}
+	}
+
+	return t
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom.has(t.Day())
+	dowMatch := s.dow.has(int(t.Weekday()))
+
+	if s.anyDom || s.anyDow {
+		return domMatch && dowMatch
+	}
+
+	return domMatch || dowMatch
+}
+
+// MinInterval returns the shortest gap between the next n firings after t.
+func (s *Schedule) MinInterval(t time.Time, n int) time.Duration {
+	var shortest time.Duration
+	prev := s.Next(t)
+	for i := 1; i < n && !prev.IsZero(); i++ {
+		next := s.Next(prev)
+		if next.IsZero() {
+			break
+		}
+		if gap := next.Sub(prev); shortest == 0 || gap < shortest {
+			shortest = gap
+		}
+		prev = next
+	}
+
+	return shortest
+}
+
+// wallClock drops the location, so times can be compared by their local
+// reading regardless of the UTC offset in effect.
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
@@ -0,0 +1,197 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		tz   string // evaluated in UTC when empty
+		from time.Time
+		want time.Time
+	}{
+		{
+			name: "weekday range",
+			expr: "30 6 * * MON-FRI",
+			from: utc(2026, time.October, 16, 7, 0), // Friday
+			want: utc(2026, time.October, 19, 6, 30),
+		},
+		{
+			name: "stepped range",
+			expr: "0 8-20/3 * * *",
+			from: utc(2026, time.October, 18, 9, 0),
+			want: utc(2026, time.October, 18, 11, 0),
+		},
+		{
+			name: "stepped range ends at its bound",
+			expr: "0 8-20/3 * * *",
+			from: utc(2026, time.October, 18, 20, 0),
+			want: utc(2026, time.October, 19, 8, 0),
+		},
+		{
+			name: "step over the whole field",
+			expr: "*/15 * * * *",
+			from: utc(2026, time.October, 18, 10, 7),
+			want: utc(2026, time.October, 18, 10, 15),
+		},
+		{
+			name: "step from a start value",
+			expr: "5/20 * * * *",
+			from: utc(2026, time.October, 18, 10, 26),
+			want: utc(2026, time.October, 18, 10, 45),
+		},
+		{
+			name: "list",
+			expr: "0 9 1,15 * *",
+			from: utc(2026, time.October, 2, 0, 0),
+			want: utc(2026, time.October, 15, 9, 0),
+		},
+		{
+			name: "strictly after",
+			expr: "0 9 * * *",
+			from: utc(2026, time.October, 18, 9, 0),
+			want: utc(2026, time.October, 19, 9, 0),
+		},
+		{
+			name: "sunday as 7",
+			expr: "0 12 * * 7",
+			from: utc(2026, time.October, 17, 0, 0), // Saturday
+			want: utc(2026, time.October, 18, 12, 0),
+		},
+		{
+			name: "day of month or day of week",
+			expr: "0 0 13 * FRI",
+			from: utc(2026, time.October, 1, 0, 0), // Thursday
+			want: utc(2026, time.October, 2, 0, 0),
+		},
+		{
+			name: "month name wraps the year",
+			expr: "0 0 1 jan *",
+			from: utc(2026, time.October, 18, 0, 0),
+			want: utc(2027, time.January, 1, 0, 0),
+		},
+		{
+			name: "descriptor",
+			expr: "@weekly",
+			from: utc(2026, time.October, 14, 12, 0), // Wednesday
+			want: utc(2026, time.October, 18, 0, 0),
+		},
+		{
+			name: "never fires",
+			expr: "0 0 31 FEB *",
+			from: utc(2026, time.October, 18, 0, 0),
+			want: time.Time{},
+		},
+		{
+			name: "spring-forward gap is skipped",
+			expr: "30 2 * * *",
+			tz:   "America/New_York",
+			from: utc(2026, time.March, 8, 5, 0),  // 00:00 EST
+			want: utc(2026, time.March, 9, 6, 30), // 02:30 EDT
+		},
+		{
+			name: "fall-back repeat fires once",
+			expr: "30 1 * * *",
+			tz:   "America/New_York",
+			from: utc(2026, time.November, 1, 5, 30), // 01:30 EDT
+			want: utc(2026, time.November, 2, 6, 30), // 01:30 EST the next day
+		},
+		{
+			name: "hourly across fall-back",
+			expr: "0 * * * *",
+			tz:   "America/New_York",
+			from: utc(2026, time.November, 1, 5, 0), // 01:00 EDT
+			want: utc(2026, time.November, 1, 7, 0), // 02:00 EST
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+
+			from := tt.from
+			if tt.tz != "" {
+				from = from.In(loadLocation(t, tt.tz))
+			}
+			if got := spec.Next(from); !got.Equal(tt.want) {
+				t.Errorf("Next(%s) = %s, want %s", from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"1,,2 * * * *",
+		"a * * * *",
+		"* * * FOO *",
+		"@yearly",
+	}
+
+	for _, expr := range tests {
+		t.Run(expr, func(t *testing.T) {
+			if _, err := Parse(expr); err == nil {
+				t.Errorf("Parse(%q) succeeded, want an error", expr)
+			}
+		})
+	}
+}
+
+func TestMinInterval(t *testing.T) {
+	tests := []struct {
+		expr string
+		want time.Duration
+	}{
+		{expr: "*/5 * * * *", want: 5 * time.Minute},
+		{expr: "0 8-20/3 * * *", want: 3 * time.Hour},
+		{expr: "0 9,10 * * *", want: time.Hour},
+		{expr: "@daily", want: 24 * time.Hour},
+	}
+
+	from := utc(2026, time.October, 18, 0, 0)
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			spec, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			if got := spec.MinInterval(from, 48); got != tt.want {
+				t.Errorf("MinInterval = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func utc(year int, month time.Month, day, hour, min int) time.Time {
+	return time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+}
+
+func loadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("LoadLocation(%q): %v", name, err)
+	}
+
+	return loc
+}
@@ -0,0 +1,146 @@
+package alerts
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"time"
+
+	databasehandler "weather_subscription/internal/db/database_handler"
+	"weather_subscription/internal/db/models"
+	"weather_subscription/internal/services/notifier"
+	weatherProvider "weather_subscription/internal/weatherProvider"
+)
+
+const defaultPollInterval = 15 * time.Minute
+
+// Exposed on /debug/vars.
+var (
+	alertsSent         = expvar.NewInt("alerts_sent")
+	alertSendErrors    = expvar.NewInt("alerts_send_errors")
+	alertFetchErrors   = expvar.NewInt("alerts_fetch_errors")
+	alertLocationsSeen = expvar.NewInt("alerts_locations_polled")
+)
+
+// Poller checks the cities of subscriptions with alerts enabled and sends
+// every new alert that passes the subscription's filters. Each alert is sent
+// once per subscription, keyed by headline and effective time; the key is
+// recorded before sending, so concurrent replicas do not send it twice.
+type Poller struct {
+	provider weatherProvider.WeatherProvider
+	notifier notifier.Notifier
+	interval time.Duration
+}
+
+func NewPoller(provider weatherProvider.WeatherProvider, notifier notifier.Notifier, interval time.Duration) *Poller {
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+
+	return &Poller{
+		provider: provider,
+		notifier: notifier,
+		interval: interval,
+	}
+}
+
+func (p *Poller) Start(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.poll(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll fetches alerts once per location and notifies its subscriptions.
+func (p *Poller) poll(ctx context.Context, now time.Time) {
+	subscriptions, err := databasehandler.ListAlertSubscriptions(ctx)
+	if err != nil {
+		log.Printf("Error fetching alert subscriptions: %v", err)
+		return
+	}
+
+	byLocation := make(map[string][]*models.Subscription)
+	var locations []string
+	for _, sub := range subscriptions {
+		key := weatherProvider.LocationKey(sub.LocationQuery())
+		if _, ok := byLocation[key]; !ok {
+			locations = append(locations, sub.LocationQuery())
+		}
+		byLocation[key] = append(byLocation[key], sub)
+	}
+
+	for _, city := range locations {
+		if ctx.Err() != nil {
+			return
+		}
+
+		report, err := p.provider.Fetch(ctx, weatherProvider.Query{Location: city, Days: 1, Alerts: true})
+		alertLocationsSeen.Add(1)
+		if err != nil {
+			alertFetchErrors.Add(1)
+			log.Printf("Error fetching weather alerts for %s: %v", city, err)
+			continue
+		}
+
+		for _, alert := range report.Alerts {
+			if !alert.Expires.IsZero() && alert.Expires.Before(now) {
+				continue
+			}
+
+			weatherAlert := convertAlert(alert)
+			for _, sub := range byLocation[weatherProvider.LocationKey(city)] {
+				if sub.Alerts.Matches(weatherAlert) {
+					p.notify(ctx, sub, weatherAlert)
+				}
+			}
+		}
+	}
+}
+
+// notify claims the alert for the subscription and sends it, releasing the
+// claim if sending fails so that the next poll retries.
+func (p *Poller) notify(ctx context.Context, sub *models.Subscription, alert *models.WeatherAlert) {
+	recorded, err := databasehandler.RecordSentAlert(ctx, sub.ID, alert)
+	if err != nil {
+		log.Printf("Error recording alert %q for subscription %d: %v", alert.Headline, sub.ID, err)
+		return
+	}
+	if !recorded {
+		return
+	}
+
+	if err := p.notifier.SendWeatherAlert(ctx, sub, alert); err != nil {
+		alertSendErrors.Add(1)
+		log.Printf("Error sending alert %q to %s: %v", alert.Headline, sub.Email, err)
+
+		if err := databasehandler.ForgetSentAlert(ctx, sub.ID, alert); err != nil {
+			log.Printf("Error releasing alert %q for subscription %d: %v", alert.Headline, sub.ID, err)
+		}
+		return
+	}
+
+	alertsSent.Add(1)
+}
+
+func convertAlert(alert weatherProvider.Alert) *models.WeatherAlert {
+	return &models.WeatherAlert{
+		Headline:    alert.Headline,
+		Event:       alert.Event,
+		Severity:    alert.Severity,
+		Urgency:     alert.Urgency,
+		Category:    alert.Category,
+		Areas:       alert.Areas,
+		Effective:   alert.Effective,
+		Expires:     alert.Expires,
+		Description: alert.Description,
+		Instruction: alert.Instruction,
+	}
+}
@@ -0,0 +1,116 @@
+package cleanup
+
+import (
+	"context"
+	"log"
+	"time"
+
+	databasehandler "weather_subscription/internal/db/database_handler"
+)
+
+const (
+	defaultPurgeAfter    = 7 * 24 * time.Hour
+	defaultPurgeInterval = 1 * time.Hour
+	// Weather observations are kept at full resolution for
+	// defaultDownsampleAfter, then hourly until defaultObservationRetention.
+	defaultDownsampleAfter      = 7 * 24 * time.Hour
+	defaultObservationRetention = 365 * 24 * time.Hour
+	// sentAlertRetention keeps sent alerts a while past expiry, in case a
+	// source keeps reporting an alert after its expiry time.
+	sentAlertRetention = 7 * 24 * time.Hour
+)
+
+// Purger periodically deletes subscriptions that were never confirmed,
+// delivered or failed outbox messages, expired weather API responses from the
+// shared cache and records of sent weather alerts that have expired. It also
+// applies the retention policy of the weather observation archive: old
+// readings are downsampled to hourly rows and eventually deleted.
+type Purger struct {
+	purgeAfter           time.Duration
+	interval             time.Duration
+	downsampleAfter      time.Duration
+	observationRetention time.Duration
+}
+
+func NewPurger(purgeAfter, interval, downsampleAfter, observationRetention time.Duration) *Purger {
+	if purgeAfter <= 0 {
+		purgeAfter = defaultPurgeAfter
+	}
+	if interval <= 0 {
+		interval = defaultPurgeInterval
+	}
+	if downsampleAfter <= 0 {
+		downsampleAfter = defaultDownsampleAfter
+	}
+	if observationRetention <= 0 {
+		observationRetention = defaultObservationRetention
+	}
+
+	return &Purger{
+		purgeAfter:           purgeAfter,
+		interval:             interval,
+		downsampleAfter:      downsampleAfter,
+		observationRetention: observationRetention,
+	}
+}
+
+func (p *Purger) Start(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.purge(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purge runs every step even if an earlier one fails: they are independent,
+// and one broken table should not stop the others from being cleaned up.
+func (p *Purger) purge(ctx context.Context) {
+	purged, err := databasehandler.PurgeUnconfirmedSubscriptions(ctx, p.purgeAfter)
+	if err != nil {
+		log.Printf("Error purging unconfirmed subscriptions: %v", err)
+	} else if purged > 0 {
+		log.Printf("Purged %d unconfirmed subscriptions older than %s", purged, p.purgeAfter)
+	}
+
+	messages, err := databasehandler.PurgeOutboxMessages(ctx, p.purgeAfter)
+	if err != nil {
+		log.Printf("Error purging outbox messages: %v", err)
+	} else if messages > 0 {
+		log.Printf("Purged %d sent or failed outbox messages older than %s", messages, p.purgeAfter)
+	}
+
+	expired, err := databasehandler.PurgeExpiredCachedResponses(ctx)
+	if err != nil {
+		log.Printf("Error purging expired cached responses: %v", err)
+	} else if expired > 0 {
+		log.Printf("Purged %d expired cached weather API responses", expired)
+	}
+
+	alerts, err := databasehandler.PurgeExpiredSentAlerts(ctx, time.Now().Add(-sentAlertRetention))
+	if err != nil {
+		log.Printf("Error purging sent alerts: %v", err)
+	} else if alerts > 0 {
+		log.Printf("Purged %d expired sent weather alerts", alerts)
+	}
+
+	downsampled, err := databasehandler.DownsampleObservations(ctx, time.Now().Add(-p.downsampleAfter))
+	if err != nil {
+		log.Printf("Error downsampling weather observations: %v", err)
+	} else if downsampled > 0 {
+		log.Printf("Downsampled weather observations older than %s into %d hourly rows", p.downsampleAfter, downsampled)
+	}
+
+	observations, err := databasehandler.PurgeObservations(ctx, time.Now().Add(-p.observationRetention))
+	if err != nil {
+		log.Printf("Error purging weather observations: %v", err)
+	} else if observations > 0 {
+		log.Printf("Purged %d weather observations older than %s", observations, p.observationRetention)
+	}
+}
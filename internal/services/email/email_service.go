@@ -3,10 +3,16 @@ package email
 import (
 	"context"
 	"fmt"
+	"net/mail"
 	"net/smtp"
 	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
 
 	models "weather_subscription/internal/db/models"
+	"weather_subscription/internal/mimemail"
 )
 
 type EmailService struct {
@@ -15,71 +21,321 @@ type EmailService struct {
 	smtpHost string
 	smtpPort string
 	isLocal  bool
+	// baseURL is the public address of the API that links in emails point
+	// to, e.g. https://weather.example.com.
+	baseURL string
+	bundles map[string]*bundle
 }
 
-func NewEmailService(from, password, smtpHost, smtpPort string) *EmailService {
+// NewEmailService loads the email templates and language bundles, embedded
+// ones overridden by those in templatesDir when it is set.
+func NewEmailService(from, password, smtpHost, smtpPort, baseURL, templatesDir string) (*EmailService, error) {
 	// Check if we're in local environment
 	isLocal := os.Getenv("ENV") == "local" || os.Getenv("ENV") == "development"
 
+	bundles, err := loadBundles(templatesDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load email templates: %w", err)
+	}
+
 	return &EmailService{
 		from:     from,
 		password: password,
 		smtpHost: smtpHost,
 		smtpPort: smtpPort,
 		isLocal:  isLocal,
-	}
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		bundles:  bundles,
+	}, nil
 }
 
-func (s *EmailService) SendConfirmationEmail(to, token string) error {
-	subject := "Confirm Your Weather Subscription"
-	body := fmt.Sprintf(`
-		Hello!
+// emailData is what the templates render. Subscription emails carry the
+// subscription, its timezone and unsubscribe link; the rest depends on the
+// email.
+type emailData struct {
+	City           string
+	Subscription   *models.Subscription
+	Location       *time.Location
+	ConfirmURL     string
+	UnsubscribeURL string
+	Token          string // management token
+
+	Forecast   *models.WeatherForecast
+	Alert      *models.WeatherAlert
+	Event      string
+	Rule       *models.NotificationRule
+	Match      models.RuleMatch
+	At         time.Time // Match.At in the subscriber's timezone
+	AirQuality *models.AirQuality
+	Marine     *models.MarineForecast
+	Astronomy  *models.AstronomyForecast
+}
 
-		Thank you for subscribing to our weather service. To confirm your subscription, please click the link below:
+func (s *EmailService) SendConfirmationEmail(to, city, token, language string) error {
+	data := emailData{
+		City:       city,
+		ConfirmURL: fmt.Sprintf("%s/api/confirm/%s", s.baseURL, token),
+	}
 
-		http://localhost:8080/api/confirm/%s
+	subject, body, err := s.render(language, "confirmation", data)
+	if err != nil {
+		return err
+	}
 
-		If you did not request this subscription, please ignore this email.
+	err = s.sendEmail(to, subject, body, nil)
+	if err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
 
-		Best regards,
-		Weather Subscription Team
-	`, token)
+	return nil
+}
 
-	err := s.sendEmail(to, subject, body)
+// SendManagementTokenEmail sends the subscriber the token that authorizes
+// managing their subscriptions.
+func (s *EmailService) SendManagementTokenEmail(to, token, language string) error {
+	subject, body, err := s.render(language, "management_token", emailData{Token: token})
 	if err != nil {
+		return err
+	}
+
+	if err := s.sendEmail(to, subject, body, nil); err != nil {
 		return fmt.Errorf("failed to send email: %w", err)
 	}
 
 	return nil
 }
 
-func (s *EmailService) SendWeatherUpdate(ctx context.Context, email string, forecast *models.WeatherForecast) error {
-	subject := fmt.Sprintf("Weather Update for %s", forecast.City)
-	body := fmt.Sprintf(`
-		<h2>Weather Update for %s</h2>
-		<p>Current weather conditions:</p>
-		<ul>
-			<li>Temperature: %.1f°C</li>
-			<li>Conditions: %s</li>
-			<li>Humidity: %d%%</li>
-			<li>Wind Speed: %.1f km/h</li>
-		</ul>
-		<p>Stay dry and have a great day!</p>
-	`, forecast.City, forecast.Temperature, forecast.Description, forecast.Humidity, forecast.WindSpeed)
+// Message is a notification rendered in the subscription's language, ready
+// to be delivered over any channel: email sends its HTML, chat channels its
+// subject and plain text, and webhooks its data as JSON.
+type Message struct {
+	// Event names the notification, e.g. weather_alert.
+	Event        string
+	Subscription *models.Subscription
+	Subject      string
+	HTML         string
+	Text         string
+	// UnsubscribeURL cancels the subscription; empty for channel
+	// confirmations.
+	UnsubscribeURL string
+	// Data is what the notification is about, e.g. the forecast.
+	Data any
+}
+
+// WeatherUpdate renders the forecast for the subscriber.
+func (s *EmailService) WeatherUpdate(subscription *models.Subscription, forecast *models.WeatherForecast) (*Message, error) {
+	data := s.subscriptionData(subscription)
+	data.Forecast = forecast
+
+	return s.subscriptionMessage(subscription, "weather_update", data, forecast)
+}
+
+// WeatherAlert renders a weather alert issued for the subscription's city.
+func (s *EmailService) WeatherAlert(subscription *models.Subscription, alert *models.WeatherAlert) (*Message, error) {
+	data := s.subscriptionData(subscription)
+	data.Alert = alert
+	data.Event = alert.Event
+	if data.Event == "" {
+		data.Event = alert.Headline
+	}
+
+	return s.subscriptionMessage(subscription, "weather_alert", data, alert)
+}
+
+// RuleNotification renders the news that one of the subscriber's
+// conditional rules has started to match the forecast.
+func (s *EmailService) RuleNotification(subscription *models.Subscription, rule *models.NotificationRule, match models.RuleMatch) (*Message, error) {
+	data := s.subscriptionData(subscription)
+	data.Rule = rule
+	data.Match = match
+	data.At = match.At.In(data.Location)
+
+	return s.subscriptionMessage(subscription, "rule_notification", data, map[string]any{
+		"rule":  rule,
+		"match": match,
+	})
+}
+
+// AirQualityAlert renders the news that the air quality index of the
+// subscription's city reached the subscriber's alert threshold.
+func (s *EmailService) AirQualityAlert(subscription *models.Subscription, airQuality *models.AirQuality) (*Message, error) {
+	data := s.subscriptionData(subscription)
+	data.AirQuality = airQuality
+
+	return s.subscriptionMessage(subscription, "air_quality_alert", data, airQuality)
+}
+
+// MarineReport renders the day's sea and surf report for a coastal
+// location: the tides followed by the hour-by-hour swell table.
+func (s *EmailService) MarineReport(subscription *models.Subscription, forecast *models.MarineForecast) (*Message, error) {
+	data := s.subscriptionData(subscription)
+	data.Marine = forecast
+
+	return s.subscriptionMessage(subscription, "marine_report", data, forecast)
+}
+
+// AstronomyDigest renders the photographers' digest: the day's golden and
+// blue hours, the moon, and whether tonight is good for stargazing.
+func (s *EmailService) AstronomyDigest(subscription *models.Subscription, forecast *models.AstronomyForecast) (*Message, error) {
+	data := s.subscriptionData(subscription)
+	data.Astronomy = forecast
+
+	return s.subscriptionMessage(subscription, "astronomy_digest", data, forecast)
+}
+
+// ChannelConfirmation renders the message sent over a newly registered
+// delivery channel with the link that confirms it.
+func (s *EmailService) ChannelConfirmation(token, language string) (*Message, error) {
+	confirmURL := fmt.Sprintf("%s/api/channels/confirm/%s", s.baseURL, token)
+
+	return s.message(language, "channel_confirmation", emailData{ConfirmURL: confirmURL}, map[string]string{
+		"confirm_url": confirmURL,
+	})
+}
+
+// SendWeatherUpdate emails the forecast to the subscriber. Every update
+// carries the subscription's unsubscribe link, both in the body and as RFC
+// 8058 one-click List-Unsubscribe headers for mail clients.
+func (s *EmailService) SendWeatherUpdate(ctx context.Context, subscription *models.Subscription, forecast *models.WeatherForecast) error {
+	message, err := s.WeatherUpdate(subscription, forecast)
+	if err != nil {
+		return err
+	}
+
+	return s.Send(ctx, subscription.Email, message)
+}
+
+// SendWeatherAlert emails a weather alert as soon as it is seen.
+func (s *EmailService) SendWeatherAlert(ctx context.Context, subscription *models.Subscription, alert *models.WeatherAlert) error {
+	message, err := s.WeatherAlert(subscription, alert)
+	if err != nil {
+		return err
+	}
 
-	return s.sendEmail(email, subject, body)
+	return s.Send(ctx, subscription.Email, message)
 }
 
-func (s *EmailService) sendEmail(to, subject, body string) error {
+// SendRuleNotification emails a rule notification.
+func (s *EmailService) SendRuleNotification(ctx context.Context, subscription *models.Subscription, rule *models.NotificationRule, match models.RuleMatch) error {
+	message, err := s.RuleNotification(subscription, rule, match)
+	if err != nil {
+		return err
+	}
+
+	return s.Send(ctx, subscription.Email, message)
+}
+
+// SendAirQualityAlert emails an air quality alert.
+func (s *EmailService) SendAirQualityAlert(ctx context.Context, subscription *models.Subscription, airQuality *models.AirQuality) error {
+	message, err := s.AirQualityAlert(subscription, airQuality)
+	if err != nil {
+		return err
+	}
+
+	return s.Send(ctx, subscription.Email, message)
+}
+
+// SendMarineReport emails the day's marine report.
+func (s *EmailService) SendMarineReport(ctx context.Context, subscription *models.Subscription, forecast *models.MarineForecast) error {
+	message, err := s.MarineReport(subscription, forecast)
+	if err != nil {
+		return err
+	}
+
+	return s.Send(ctx, subscription.Email, message)
+}
+
+// SendAstronomyDigest emails the day's astronomy digest.
+func (s *EmailService) SendAstronomyDigest(ctx context.Context, subscription *models.Subscription, forecast *models.AstronomyForecast) error {
+	message, err := s.AstronomyDigest(subscription, forecast)
+	if err != nil {
+		return err
+	}
+
+	return s.Send(ctx, subscription.Email, message)
+}
+
+// Send emails a rendered message. Subscription messages carry the one-click
+// List-Unsubscribe headers.
+func (s *EmailService) Send(ctx context.Context, to string, message *Message) error {
+	var headers map[string]string
+	if message.UnsubscribeURL != "" {
+		headers = map[string]string{
+			"List-Unsubscribe":      fmt.Sprintf("<%s>", message.UnsubscribeURL),
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		}
+	}
+
+	return s.sendEmail(to, message.Subject, message.HTML, headers)
+}
+
+func (s *EmailService) subscriptionData(subscription *models.Subscription) emailData {
+	return emailData{
+		City:           subscription.City,
+		Subscription:   subscription,
+		Location:       subscription.Location(),
+		UnsubscribeURL: s.UnsubscribeURL(subscription.UnsubscribeToken),
+	}
+}
+
+// subscriptionMessage renders a message in the subscription's language.
+func (s *EmailService) subscriptionMessage(subscription *models.Subscription, name string, data emailData, payload any) (*Message, error) {
+	message, err := s.message(subscription.Language, name, data, payload)
+	if err != nil {
+		return nil, err
+	}
+	message.Subscription = subscription
+	message.UnsubscribeURL = data.UnsubscribeURL
+
+	return message, nil
+}
+
+func (s *EmailService) message(language, name string, data emailData, payload any) (*Message, error) {
+	subject, body, err := s.render(language, name, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		Event:   name,
+		Subject: subject,
+		HTML:    body,
+		Text:    mimemail.PlainText(body),
+		Data:    payload,
+	}, nil
+}
+
+// UnsubscribeURL is the link that cancels the subscription owning the token.
+func (s *EmailService) UnsubscribeURL(unsubscribeToken string) string {
+	return fmt.Sprintf("%s/api/unsubscribe/%s", s.baseURL, unsubscribeToken)
+}
+
+// sendEmail sends an HTML body along with its plain-text rendering, and
+// embeds the condition icons it shows.
+func (s *EmailService) sendEmail(to, subject, body string, headers map[string]string) error {
 	addr := fmt.Sprintf("%s:%s", s.smtpHost, s.smtpPort)
-	message := fmt.Sprintf("Subject: %s\r\n\r\n%s", subject, body)
 
-	var err error
+	message := &mimemail.Message{
+		From:      (&mail.Address{Address: s.from}).String(),
+		To:        []string{to},
+		Subject:   subject,
+		Date:      time.Now(),
+		MessageID: messageID(s.from),
+		Headers:   headers,
+		Text:      mimemail.PlainText(body),
+		HTML:      body,
+		Inline:    inlineIcons(body),
+	}
+	data, err := message.Bytes()
+	if err != nil {
+		return fmt.Errorf("failed to build email: %w", err)
+	}
+
 	if s.isLocal {
-		err = smtp.SendMail(addr, nil, s.from, []string{to}, []byte(message))
+		err = smtp.SendMail(addr, nil, s.from, []string{to}, data)
 	} else {
 		auth := smtp.PlainAuth("", s.from, s.password, s.smtpHost)
-		err = smtp.SendMail(addr, auth, s.from, []string{to}, []byte(message))
+		err = smtp.SendMail(addr, auth, s.from, []string{to}, data)
 	}
 
 	if err != nil {
@@ -88,3 +344,13 @@ func (s *EmailService) sendEmail(to, subject, body string) error {
 
 	return nil
 }
+
+// messageID returns a unique Message-ID in the sender's domain.
+func messageID(from string) string {
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 && at < len(from)-1 {
+		domain = from[at+1:]
+	}
+
+	return uuid.NewString() + "@" + domain
+}
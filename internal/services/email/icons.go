@@ -0,0 +1,70 @@
+package email
+
+import (
+	"embed"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"weather_subscription/internal/mimemail"
+)
+
+//go:embed icons/*.png
+var icons embed.FS
+
+// conditionIcons maps weather conditions (weatherprovider.Condition) to their
+// icons. Conditions are classified from the source's condition codes, so the
+// icon does not depend on the language of the description.
+var conditionIcons = map[string]string{
+	"storm":         "storm",
+	"snow":          "snow",
+	"rain":          "rain",
+	"fog":           "fog",
+	"partly_cloudy": "partly-cloudy",
+	"cloudy":        "cloudy",
+	"clear":         "sunny",
+}
+
+var iconReference = regexp.MustCompile(`cid:icon-([a-z-]+)`)
+
+// conditionIcon returns an inline image for the condition, or nothing for a
+// condition without an icon.
+func conditionIcon(condition string) string {
+	icon, ok := conditionIcons[condition]
+	if !ok {
+		return ""
+	}
+
+	return fmt.Sprintf(`<img src="cid:icon-%s" alt="" width="32" height="32" style="vertical-align:middle">`, icon)
+}
+
+// inlineIcons returns the icons referenced by the body, to embed in the
+// message.
+func inlineIcons(body string) []mimemail.Inline {
+	seen := make(map[string]bool)
+	for _, match := range iconReference.FindAllStringSubmatch(body, -1) {
+		seen[match[1]] = true
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var images []mimemail.Inline
+	for _, name := range names {
+		data, err := icons.ReadFile("icons/" + name + ".png")
+		if err != nil {
+			continue
+		}
+		images = append(images, mimemail.Inline{
+			ContentID:   "icon-" + name,
+			Filename:    name + ".png",
+			ContentType: "image/png",
+			Data:        data,
+		})
+	}
+
+	return images
+}
@@ -0,0 +1,247 @@
+package email
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	models "weather_subscription/internal/db/models"
+)
+
+// The default templates and language bundles. A templates directory, when
+// configured, mirrors this layout: its templates replace the embedded ones
+// with the same name and its strings those with the same key.
+//
+//go:embed templates/*.html templates/*.txt locales/*.json
+var embedded embed.FS
+
+// subjectsFile holds a {{define}} block with the subject of every email.
+const subjectsFile = "subjects.txt"
+
+// bundle is everything an email is rendered with in one language.
+type bundle struct {
+	html     *htmltemplate.Template
+	subjects *texttemplate.Template
+}
+
+// loadBundles parses the templates once and binds a copy of them to each
+// language's strings. Strings missing from a bundle fall back to English.
+func loadBundles(dir string) (map[string]*bundle, error) {
+	pages, err := readFiles(dir, "templates", ".html")
+	if err != nil {
+		return nil, err
+	}
+	subjects, err := readFiles(dir, "templates", ".txt")
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := subjects[subjectsFile]; !ok {
+		return nil, fmt.Errorf("missing templates/%s", subjectsFile)
+	}
+	// Placeholders, so the templates parse; each language binds its own.
+	placeholders := translator(nil, nil)
+	htmlRoot := htmltemplate.New("").Funcs(placeholders).Funcs(htmltemplate.FuncMap{"icon": icon})
+	for name, content := range pages {
+		if _, err := htmlRoot.New(name).Parse(content); err != nil {
+			return nil, fmt.Errorf("failed to parse templates/%s: %w", name, err)
+		}
+	}
+	textRoot := texttemplate.New("").Funcs(placeholders)
+	if _, err := textRoot.New(subjectsFile).Parse(subjects[subjectsFile]); err != nil {
+		return nil, fmt.Errorf("failed to parse templates/%s: %w", subjectsFile, err)
+	}
+
+	fallback, err := readLocale(dir, models.DefaultLanguage)
+	if err != nil {
+		return nil, err
+	}
+
+	bundles := make(map[string]*bundle, len(models.Languages))
+	for _, language := range models.Languages {
+		messages := fallback
+		if language != models.DefaultLanguage {
+			if messages, err = readLocale(dir, language); err != nil {
+				return nil, err
+			}
+		}
+		funcs := translator(messages, fallback)
+
+		html, err := htmlRoot.Clone()
+		if err != nil {
+			return nil, err
+		}
+		text, err := textRoot.Clone()
+		if err != nil {
+			return nil, err
+		}
+		bundles[language] = &bundle{
+			html:     html.Funcs(funcs),
+			subjects: text.Funcs(funcs),
+		}
+	}
+
+	return bundles, nil
+}
+
+// readFiles reads the files of a directory with the given extension, from
+// the embedded defaults and then from the override directory, if any.
+func readFiles(dir, subdir, ext string) (map[string]string, error) {
+	files := make(map[string]string)
+	for _, source := range sources(dir) {
+		names, err := fs.Glob(source, path.Join(subdir, "*"+ext))
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			data, err := fs.ReadFile(source, name)
+			if err != nil {
+				return nil, err
+			}
+			files[path.Base(name)] = string(data)
+		}
+	}
+
+	return files, nil
+}
+
+// readLocale reads the strings of a language, the override directory's
+// on top of the embedded ones.
+func readLocale(dir, language string) (map[string]string, error) {
+	name := path.Join("locales", language+".json")
+	messages := make(map[string]string)
+	found := false
+	for _, source := range sources(dir) {
+		data, err := fs.ReadFile(source, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		found = true
+	}
+	if !found {
+		return nil, fmt.Errorf("missing %s", name)
+	}
+
+	return messages, nil
+}
+
+func sources(dir string) []fs.FS {
+	if dir == "" {
+		return []fs.FS{embedded}
+	}
+
+	return []fs.FS{embedded, os.DirFS(dir)}
+}
+
+// translator returns the template functions that depend on the language.
+func translator(messages, fallback map[string]string) map[string]any {
+	t := func(key string, args ...any) string {
+		format, ok := messages[key]
+		if !ok {
+			if format, ok = fallback[key]; !ok {
+				return key
+			}
+		}
+		if len(args) == 0 {
+			return format
+		}
+
+		// Optional values, like the history's deltas, are pointers.
+		for i, arg := range args {
+			if value := reflect.ValueOf(arg); value.Kind() == reflect.Pointer && !value.IsNil() {
+				args[i] = value.Elem().Interface()
+			}
+		}
+
+		return fmt.Sprintf(format, args...)
+	}
+
+	// date renders e.g. "Monday, Jan 2" and shortDate "Mon Jan 2", in the
+	// order and with the names of the language.
+	weekday := func(day time.Time) string {
+		return t("weekday.short." + strconv.Itoa(int(day.Weekday())))
+	}
+	date := func(day time.Time) string {
+		return t("date.long", t("weekday."+strconv.Itoa(int(day.Weekday()))), day.Day(), t("month.short."+strconv.Itoa(int(day.Month()))))
+	}
+	shortDate := func(day time.Time) string {
+		return t("date.short", weekday(day), day.Day(), t("month.short."+strconv.Itoa(int(day.Month()))))
+	}
+
+	return map[string]any{
+		"t":         t,
+		"date":      date,
+		"shortDate": shortDate,
+		"weekday":   weekday,
+		"clock":     clock,
+		"window": func(window models.TimeWindow) string {
+			return clock(window.Start) + "–" + clock(window.End)
+		},
+		// alertTime renders an alert boundary in the subscriber's timezone.
+		"alertTime": func(at time.Time, location *time.Location) string {
+			if at.IsZero() {
+				return t("alert.further_notice")
+			}
+			at = at.In(location)
+			return shortDate(at) + " " + clock(at) + " " + at.Format("MST")
+		},
+		// delta phrases a temperature difference against a reference, e.g.
+		// "4°C warmer than last year".
+		"delta": func(delta float64, than string) string {
+			rounded := models.RoundDelta(delta)
+			switch {
+			case rounded > 0:
+				return t("history.warmer", rounded, t(than))
+			case rounded < 0:
+				return t("history.colder", -rounded, t(than))
+			default:
+				return t("history.same", rounded, t(than))
+			}
+		},
+		"upper": strings.ToUpper,
+	}
+}
+
+func clock(t time.Time) string {
+	return t.Format("15:04")
+}
+
+func icon(condition string) htmltemplate.HTML {
+	return htmltemplate.HTML(conditionIcon(condition))
+}
+
+// render executes an email's subject and body in the language's bundle, or
+// in the default language when the language is unknown.
+func (s *EmailService) render(language, name string, data any) (string, string, error) {
+	bundle, ok := s.bundles[language]
+	if !ok {
+		bundle = s.bundles[models.DefaultLanguage]
+	}
+
+	var subject strings.Builder
+	if err := bundle.subjects.ExecuteTemplate(&subject, name, data); err != nil {
+		return "", "", fmt.Errorf("failed to render %s subject: %w", name, err)
+	}
+
+	var body strings.Builder
+	if err := bundle.html.ExecuteTemplate(&body, name+".html", data); err != nil {
+		return "", "", fmt.Errorf("failed to render %s email: %w", name, err)
+	}
+
+	return strings.TrimSpace(subject.String()), body.String(), nil
+}
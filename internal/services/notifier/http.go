@@ -0,0 +1,107 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"weather_subscription/internal/netguard"
+)
+
+const (
+	DefaultTimeout = 10 * time.Second
+	// maxResponseSize bounds how much of a response is read for errors.
+	maxResponseSize = 64 << 10
+)
+
+var errNotPublic = errors.New("not a public address")
+
+// NewHTTPClient returns a client for the channels. Redirects are not
+// followed: a 3xx response is an error like any other non-2xx one.
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// NewPublicHTTPClient returns a client for URLs subscribers registered, like
+// webhooks and Slack. It only connects to public addresses, checked after
+// DNS resolution so a host name cannot point it into the service's own
+// network. Proxies from the environment are not used, since the proxy would
+// make the connection instead.
+func NewPublicHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   publicOnly,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	client := NewHTTPClient(timeout)
+	client.Transport = transport
+	return client
+}
+
+// publicOnly refuses connections to addresses that are not public.
+func publicOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if !netguard.IsPublic(net.ParseIP(host)) {
+		return fmt.Errorf("%s is %w", host, errNotPublic)
+	}
+
+	return nil
+}
+
+// postJSON posts a JSON body and returns the response body. Responses
+// other than 2xx are errors. Errors leave out the URL, which for incoming
+// webhooks and bots is itself a secret.
+func postJSON(ctx context.Context, client *http.Client, target string, body []byte, headers map[string]string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.New("invalid URL")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	response, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return response, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	return response, nil
+}
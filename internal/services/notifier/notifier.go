@@ -0,0 +1,272 @@
+// Package notifier delivers subscription messages over the channels a
+// subscriber chose: their email address, signed HTTP webhooks,
+// Slack-compatible incoming webhooks and Telegram chats.
+package notifier
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"slices"
+
+	databasehandler "weather_subscription/internal/db/database_handler"
+	"weather_subscription/internal/db/models"
+	"weather_subscription/internal/services/email"
+)
+
+// Exposed on /debug/vars, by channel kind.
+var (
+	deliveries     = expvar.NewMap("notifier_deliveries")
+	deliveryErrors = expvar.NewMap("notifier_delivery_errors")
+)
+
+// Notifier sends the messages of a subscription. *email.EmailService
+// implements it for email only; Fanout for every channel of the subscription.
+type Notifier interface {
+	SendWeatherUpdate(ctx context.Context, subscription *models.Subscription, forecast *models.WeatherForecast) error
+	SendWeatherAlert(ctx context.Context, subscription *models.Subscription, alert *models.WeatherAlert) error
+	SendRuleNotification(ctx context.Context, subscription *models.Subscription, rule *models.NotificationRule, match models.RuleMatch) error
+	SendAirQualityAlert(ctx context.Context, subscription *models.Subscription, airQuality *models.AirQuality) error
+	SendMarineReport(ctx context.Context, subscription *models.Subscription, forecast *models.MarineForecast) error
+	SendAstronomyDigest(ctx context.Context, subscription *models.Subscription, forecast *models.AstronomyForecast) error
+}
+
+// Channel delivers a rendered message to one destination of its kind.
+type Channel interface {
+	Deliver(ctx context.Context, target *models.DeliveryChannel, message *email.Message) error
+}
+
+// Email delivers messages to the target's email address.
+type Email struct {
+	service *email.EmailService
+}
+
+func NewEmail(service *email.EmailService) *Email {
+	return &Email{service: service}
+}
+
+func (e *Email) Deliver(ctx context.Context, target *models.DeliveryChannel, message *email.Message) error {
+	return e.service.Send(ctx, target.Target, message)
+}
+
+var _ Notifier = (*email.EmailService)(nil)
+
+// Fanout renders each message once, in the subscription's language, and
+// delivers it to every confirmed channel whose kind the subscription lists.
+type Fanout struct {
+	email    *email.EmailService
+	channels map[models.ChannelKind]Channel
+}
+
+// NewFanout returns a Fanout delivering to email; other kinds of channels
+// are added with Register.
+func NewFanout(emailService *email.EmailService) *Fanout {
+	return &Fanout{
+		email: emailService,
+		channels: map[models.ChannelKind]Channel{
+			models.EmailChannel: NewEmail(emailService),
+		},
+	}
+}
+
+func (f *Fanout) Register(kind models.ChannelKind, channel Channel) {
+	f.channels[kind] = channel
+}
+
+// Supports reports whether channels of the kind can be delivered to.
+func (f *Fanout) Supports(kind models.ChannelKind) bool {
+	_, ok := f.channels[kind]
+	return ok
+}
+
+func (f *Fanout) SendWeatherUpdate(ctx context.Context, subscription *models.Subscription, forecast *models.WeatherForecast) error {
+	message, err := f.email.WeatherUpdate(subscription, forecast)
+	if err != nil {
+		return err
+	}
+
+	return f.deliver(ctx, message)
+}
+
+func (f *Fanout) SendWeatherAlert(ctx context.Context, subscription *models.Subscription, alert *models.WeatherAlert) error {
+	message, err := f.email.WeatherAlert(subscription, alert)
+	if err != nil {
+		return err
+	}
+
+	return f.deliver(ctx, message)
+}
+
+func (f *Fanout) SendRuleNotification(ctx context.Context, subscription *models.Subscription, rule *models.NotificationRule, match models.RuleMatch) error {
+	message, err := f.email.RuleNotification(subscription, rule, match)
+	if err != nil {
+		return err
+	}
+
+	return f.deliver(ctx, message)
+}
+
+func (f *Fanout) SendAirQualityAlert(ctx context.Context, subscription *models.Subscription, airQuality *models.AirQuality) error {
+	message, err := f.email.AirQualityAlert(subscription, airQuality)
+	if err != nil {
+		return err
+	}
+
+	return f.deliver(ctx, message)
+}
+
+func (f *Fanout) SendMarineReport(ctx context.Context, subscription *models.Subscription, forecast *models.MarineForecast) error {
+	message, err := f.email.MarineReport(subscription, forecast)
+	if err != nil {
+		return err
+	}
+
+	return f.deliver(ctx, message)
+}
+
+func (f *Fanout) SendAstronomyDigest(ctx context.Context, subscription *models.Subscription, forecast *models.AstronomyForecast) error {
+	message, err := f.email.AstronomyDigest(subscription, forecast)
+	if err != nil {
+		return err
+	}
+
+	return f.deliver(ctx, message)
+}
+
+// SendChannelConfirmation sends the confirmation link over a newly
+// registered channel. Channels deleted in the meantime are skipped.
+func (f *Fanout) SendChannelConfirmation(ctx context.Context, channelID uint, token, language string) error {
+	target, err := databasehandler.GetChannel(ctx, channelID)
+	if errors.Is(err, databasehandler.ErrChannelNotFound) {
+		log.Printf("Skipping confirmation of delivery channel %d: channel was deleted", channelID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	channel, ok := f.channels[target.Kind]
+	if !ok {
+		return fmt.Errorf("%s channels are not configured", target.Kind)
+	}
+
+	message, err := f.email.ChannelConfirmation(token, language)
+	if err != nil {
+		return err
+	}
+
+	return channel.Deliver(ctx, target, message)
+}
+
+type deliveredKey struct{}
+
+// WithDelivered returns a context under which Fanout skips the channels
+// listed in delivered and adds the ones it delivers to. With it, a message
+// that failed on some channels is reported as failed and can be sent again
+// to just those.
+func WithDelivered(ctx context.Context, delivered *[]string) context.Context {
+	return context.WithValue(ctx, deliveredKey{}, delivered)
+}
+
+// channelKey identifies a target in the list kept by WithDelivered.
+func channelKey(target *models.DeliveryChannel) string {
+	if target.Kind == models.EmailChannel {
+		return string(target.Kind)
+	}
+
+	return fmt.Sprintf("%s:%d", target.Kind, target.ID)
+}
+
+// deliver sends a rendered subscription message to the subscription's
+// channels.
+func (f *Fanout) deliver(ctx context.Context, message *email.Message) error {
+	targets, err := f.targets(ctx, message.Subscription)
+	if err != nil {
+		return err
+	}
+
+	delivered, _ := ctx.Value(deliveredKey{}).(*[]string)
+
+	var errs []error
+	attempted := 0
+	for _, target := range targets {
+		key := channelKey(target)
+		if delivered != nil && slices.Contains(*delivered, key) {
+			continue
+		}
+
+		attempted++
+		if err := f.channels[target.Kind].Deliver(ctx, target, message); err != nil {
+			deliveryErrors.Add(string(target.Kind), 1)
+			errs = append(errs, fmt.Errorf("%s channel: %w", target.Kind, err))
+			continue
+		}
+		deliveries.Add(string(target.Kind), 1)
+		if delivered != nil {
+			*delivered = append(*delivered, key)
+		}
+	}
+
+	// Without a record of the delivered channels, a message counts as sent
+	// once any channel got it: failing it would retry the channels that
+	// succeeded as well.
+	switch {
+	case len(errs) == 0:
+	case delivered != nil || len(errs) == attempted:
+		return errors.Join(errs...)
+	default:
+		log.Printf("Error delivering %s for subscription %d to some channels: %v", message.Event, message.Subscription.ID, errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// targets resolves the kinds of channels the subscription lists to the
+// subscriber's channels. Email stands for the subscriber's address, confirmed
+// along with the subscription. When no listed channel can be delivered to,
+// e.g. because none is confirmed yet, the message falls back to email rather
+// than being dropped.
+func (f *Fanout) targets(ctx context.Context, subscription *models.Subscription) ([]*models.DeliveryChannel, error) {
+	emailTarget := &models.DeliveryChannel{
+		SubscriberID: subscription.SubscriberID,
+		Kind:         models.EmailChannel,
+		Target:       subscription.Email,
+		Confirmed:    true,
+	}
+
+	var registered []*models.DeliveryChannel
+	for _, kind := range subscription.Channels {
+		if kind != models.EmailChannel {
+			channels, err := databasehandler.ListConfirmedChannels(ctx, subscription.SubscriberID)
+			if err != nil {
+				return nil, err
+			}
+			registered = channels
+			break
+		}
+	}
+
+	var targets []*models.DeliveryChannel
+	for _, kind := range subscription.Channels {
+		if !f.Supports(kind) {
+			continue
+		}
+		if kind == models.EmailChannel {
+			targets = append(targets, emailTarget)
+			continue
+		}
+		for _, channel := range registered {
+			if channel.Kind == kind {
+				targets = append(targets, channel)
+			}
+		}
+	}
+
+	if len(targets) == 0 {
+		targets = append(targets, emailTarget)
+	}
+
+	return targets, nil
+}
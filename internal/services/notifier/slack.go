@@ -0,0 +1,38 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"weather_subscription/internal/db/models"
+	"weather_subscription/internal/services/email"
+)
+
+// slackEscaper escapes the characters Slack's mrkdwn reserves for links and
+// mentions.
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// Slack posts messages to a Slack-compatible incoming webhook URL, which
+// Mattermost, Rocket.Chat and others accept as well.
+type Slack struct {
+	client *http.Client
+}
+
+func NewSlack(client *http.Client) *Slack {
+	return &Slack{client: client}
+}
+
+func (s *Slack) Deliver(ctx context.Context, target *models.DeliveryChannel, message *email.Message) error {
+	body, err := json.Marshal(map[string]string{
+		"text": "*" + slackEscaper.Replace(message.Subject) + "*\n\n" + slackEscaper.Replace(message.Text),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode slack message: %w", err)
+	}
+
+	_, err = postJSON(ctx, s.client, target.Target, body, nil)
+	return err
+}
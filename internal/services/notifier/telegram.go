@@ -0,0 +1,83 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"weather_subscription/internal/db/models"
+	"weather_subscription/internal/services/email"
+)
+
+const (
+	DefaultTelegramBaseURL = "https://api.telegram.org"
+	// telegramMaxLength is the longest text sendMessage accepts, in
+	// characters.
+	telegramMaxLength = 4096
+)
+
+// Telegram sends messages to chats through the Bot API. The base URL can
+// point to a local Bot API server or a stub instead of api.telegram.org.
+type Telegram struct {
+	client   *http.Client
+	baseURL  string
+	botToken string
+}
+
+func NewTelegram(client *http.Client, baseURL, botToken string) *Telegram {
+	if baseURL == "" {
+		baseURL = DefaultTelegramBaseURL
+	}
+
+	return &Telegram{
+		client:   client,
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		botToken: botToken,
+	}
+}
+
+// telegramResponse is the envelope of every Bot API response.
+type telegramResponse struct {
+	OK          bool   `json:"ok"`
+	Description string `json:"description"`
+}
+
+func (t *Telegram) Deliver(ctx context.Context, target *models.DeliveryChannel, message *email.Message) error {
+	body, err := json.Marshal(map[string]any{
+		"chat_id":                  target.Target,
+		"text":                     truncate(message.Subject+"\n\n"+message.Text, telegramMaxLength),
+		"disable_web_page_preview": true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode telegram message: %w", err)
+	}
+
+	data, err := postJSON(ctx, t.client, t.baseURL+"/bot"+t.botToken+"/sendMessage", body, nil)
+
+	var response telegramResponse
+	if data != nil && json.Unmarshal(data, &response) == nil && !response.OK && response.Description != "" {
+		return fmt.Errorf("telegram: %s", response.Description)
+	}
+	if err != nil {
+		return err
+	}
+	if !response.OK {
+		return errors.New("telegram: request was not accepted")
+	}
+
+	return nil
+}
+
+// truncate shortens text to at most limit characters, ending it with an
+// ellipsis when cut.
+func truncate(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+
+	return string(runes[:limit-1]) + "…"
+}
@@ -0,0 +1,87 @@
+package notifier
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"weather_subscription/internal/db/models"
+	"weather_subscription/internal/services/email"
+)
+
+const (
+	EventHeader     = "X-Weather-Event"
+	SignatureHeader = "X-Weather-Signature"
+)
+
+// Webhook posts messages as JSON to the target URL. Each request is signed
+// with the channel's secret: the signature header holds "sha256=" followed
+// by the hex HMAC-SHA256 of the body, so receivers can check that it came
+// from us.
+type Webhook struct {
+	client *http.Client
+}
+
+func NewWebhook(client *http.Client) *Webhook {
+	return &Webhook{client: client}
+}
+
+type webhookPayload struct {
+	Event        string               `json:"event"`
+	Subscription *webhookSubscription `json:"subscription,omitempty"`
+	Subject      string               `json:"subject"`
+	Text         string               `json:"text"`
+	Data         any                  `json:"data,omitempty"`
+	SentAt       time.Time            `json:"sent_at"`
+}
+
+type webhookSubscription struct {
+	ID             uint                         `json:"id"`
+	City           string                       `json:"city"`
+	Kind           models.SubscriptionKind      `json:"kind"`
+	Frequency      models.SubscriptionFrequency `json:"frequency"`
+	UnsubscribeURL string                       `json:"unsubscribe_url"`
+}
+
+func (w *Webhook) Deliver(ctx context.Context, target *models.DeliveryChannel, message *email.Message) error {
+	payload := webhookPayload{
+		Event:   message.Event,
+		Subject: message.Subject,
+		Text:    message.Text,
+		Data:    message.Data,
+		SentAt:  time.Now().UTC(),
+	}
+	if sub := message.Subscription; sub != nil {
+		payload.Subscription = &webhookSubscription{
+			ID:             sub.ID,
+			City:           sub.City,
+			Kind:           sub.Kind,
+			Frequency:      sub.Frequency,
+			UnsubscribeURL: message.UnsubscribeURL,
+		}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	_, err = postJSON(ctx, w.client, target.Target, body, map[string]string{
+		EventHeader:     message.Event,
+		SignatureHeader: Sign(target.Secret, body),
+	})
+	return err
+}
+
+// Sign returns the signature header value of a webhook body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
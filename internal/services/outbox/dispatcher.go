@@ -0,0 +1,133 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"weather_subscription/internal/backoff"
+	databasehandler "weather_subscription/internal/db/database_handler"
+	"weather_subscription/internal/db/models"
+	"weather_subscription/internal/services/email"
+	"weather_subscription/internal/services/notifier"
+)
+
+const (
+	defaultPollInterval = 5 * time.Second
+	defaultMaxAttempts  = 8
+	batchSize           = 50
+	baseBackoff         = 30 * time.Second
+	maxBackoff          = 1 * time.Hour
+	// claimLease is how long a claimed message stays invisible to other dispatchers.
+	claimLease = 2 * time.Minute
+)
+
+// Dispatcher drains the outbox table, delivering each message at least once
+// and retrying failures with exponential backoff.
+type Dispatcher struct {
+	emailService *email.EmailService
+	fanout       *notifier.Fanout
+	pollInterval time.Duration
+	maxAttempts  int
+}
+
+func NewDispatcher(emailService *email.EmailService, fanout *notifier.Fanout, pollInterval time.Duration, maxAttempts int) *Dispatcher {
+	if pollInterval <= 0 {
+		pollInterval = defaultPollInterval
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+
+	return &Dispatcher{
+		emailService: emailService,
+		fanout:       fanout,
+		pollInterval: pollInterval,
+		maxAttempts:  maxAttempts,
+	}
+}
+
+func (d *Dispatcher) Start(ctx context.Context) {
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.drain(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// drain keeps claiming batches until the outbox has nothing due.
+func (d *Dispatcher) drain(ctx context.Context) {
+	for {
+		messages, err := databasehandler.ClaimOutboxMessages(ctx, batchSize, claimLease)
+		if err != nil {
+			log.Printf("Error claiming outbox messages: %v", err)
+			return
+		}
+
+		for _, message := range messages {
+			d.process(ctx, message)
+		}
+
+		if len(messages) < batchSize {
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) process(ctx context.Context, message *models.OutboxMessage) {
+	err := d.dispatch(ctx, message)
+	if err == nil {
+		if err := databasehandler.MarkOutboxMessageSent(ctx, message.ID); err != nil {
+			log.Printf("Error marking outbox message %d as sent: %v", message.ID, err)
+		}
+		return
+	}
+
+	if message.Attempts >= d.maxAttempts {
+		log.Printf("Giving up on outbox message %d after %d attempts: %v", message.ID, message.Attempts, err)
+		if err := databasehandler.FailOutboxMessage(ctx, message.ID, err.Error()); err != nil {
+			log.Printf("Error marking outbox message %d as failed: %v", message.ID, err)
+		}
+		return
+	}
+
+	delay := backoff.Exponential(message.Attempts, baseBackoff, maxBackoff)
+	log.Printf("Error dispatching outbox message %d (attempt %d), retrying in %s: %v", message.ID, message.Attempts, delay, err)
+	if err := databasehandler.RescheduleOutboxMessage(ctx, message.ID, err.Error(), delay); err != nil {
+		log.Printf("Error rescheduling outbox message %d: %v", message.ID, err)
+	}
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, message *models.OutboxMessage) error {
+	switch message.Kind {
+	case models.ConfirmationEmail:
+		var payload models.ConfirmationEmailPayload
+		if err := json.Unmarshal(message.Payload, &payload); err != nil {
+			return fmt.Errorf("invalid payload: %w", err)
+		}
+		return d.emailService.SendConfirmationEmail(message.Recipient, payload.City, payload.Token, payload.Language)
+	case models.ManagementTokenEmail:
+		var payload models.ManagementTokenEmailPayload
+		if err := json.Unmarshal(message.Payload, &payload); err != nil {
+			return fmt.Errorf("invalid payload: %w", err)
+		}
+		return d.emailService.SendManagementTokenEmail(message.Recipient, payload.Token, payload.Language)
+	case models.ChannelConfirmation:
+		var payload models.ChannelConfirmationPayload
+		if err := json.Unmarshal(message.Payload, &payload); err != nil {
+			return fmt.Errorf("invalid payload: %w", err)
+		}
+		return d.fanout.SendChannelConfirmation(ctx, payload.ChannelID, payload.Token, payload.Language)
+	default:
+		return fmt.Errorf("unknown outbox message kind %q", message.Kind)
+	}
+}
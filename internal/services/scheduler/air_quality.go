@@ -0,0 +1,53 @@
+package scheduler
+
+import (
+	"context"
+	"expvar"
+	"log"
+
+	databasehandler "weather_subscription/internal/db/database_handler"
+	"weather_subscription/internal/db/models"
+)
+
+// Exposed on /debug/vars.
+var airQualityAlertsSent = expvar.NewInt("scheduler_air_quality_alerts_sent")
+
+// checkAirQuality alerts subscribers whose air quality index reached their
+// threshold and re-arms the alert once it drops below again.
+func (s *WeatherScheduler) checkAirQuality(ctx context.Context, subscriptions []*models.Subscription, readings map[string]reading) {
+	for _, sub := range subscriptions {
+		reading := readings[queryKey(sub)]
+		if reading.err != nil || reading.report.AirQuality == nil {
+			continue
+		}
+
+		airQuality := models.AirQualityFromReport(sub.AirQuality.Scale, reading.report.AirQuality)
+		if airQuality.Index == 0 {
+			continue
+		}
+		reached := airQuality.Index >= sub.AirQuality.AlertThreshold
+
+		if reached == sub.AirQuality.AlertTriggered {
+			continue
+		}
+
+		changed, err := databasehandler.SetAirQualityAlertTriggered(ctx, sub.ID, reached)
+		if err != nil {
+			log.Printf("Error updating air quality alert of subscription %d: %v", sub.ID, err)
+			continue
+		}
+		if !changed || !reached {
+			continue
+		}
+
+		if err := s.notifier.SendAirQualityAlert(ctx, sub, &airQuality); err != nil {
+			log.Printf("Error sending air quality alert to %s: %v", sub.Email, err)
+			if _, err := databasehandler.SetAirQualityAlertTriggered(ctx, sub.ID, false); err != nil {
+				log.Printf("Error releasing air quality alert of subscription %d: %v", sub.ID, err)
+			}
+			continue
+		}
+
+		airQualityAlertsSent.Add(1)
+	}
+}
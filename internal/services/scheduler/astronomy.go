@@ -0,0 +1,100 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"weather_subscription/internal/db/models"
+	weatherProvider "weather_subscription/internal/weatherProvider"
+)
+
+// astronomyForecastDays covers tonight up to tomorrow's sunrise.
+const astronomyForecastDays = 2
+
+// Without a sunrise or sunset (polar day or night) the night is taken to run
+// between these local hours.
+const (
+	defaultNightStart = 22
+	defaultNightEnd   = 5
+)
+
+func (s *WeatherScheduler) sendAstronomyDigest(ctx context.Context, subscription *models.Subscription, report *weatherProvider.Report) error {
+	forecast, err := astronomyForecast(report)
+	if err != nil {
+		return err
+	}
+	forecast.Location = subscription.City
+
+	if err := s.notifier.SendAstronomyDigest(ctx, subscription, forecast); err != nil {
+		return fmt.Errorf("failed to send astronomy digest to %s: %w", subscription.Email, err)
+	}
+
+	return nil
+}
+
+// astronomyForecast builds today's light windows and moon from the daily
+// forecast, and rates tonight for stargazing from the hourly cloud cover.
+func astronomyForecast(report *weatherProvider.Report) (*models.AstronomyForecast, error) {
+	if len(report.Daily) == 0 {
+		return nil, fmt.Errorf("no daily forecast for %s", report.Location.Name)
+	}
+
+	today := report.Daily[0]
+	forecast := &models.AstronomyForecast{
+		Location:         report.Location.Name,
+		Date:             today.Date,
+		Source:           weatherProvider.Attribution(report),
+		Moonrise:         today.Moonrise,
+		Moonset:          today.Moonset,
+		MoonPhase:        today.MoonPhase,
+		MoonIllumination: today.MoonIllumination,
+	}
+
+	sunrise, hasSunrise := clockOn(today.Date, today.Sunrise)
+	sunset, hasSunset := clockOn(today.Date, today.Sunset)
+
+	tomorrow := today.Date.AddDate(0, 0, 1)
+	forecast.Night = models.TimeWindow{
+		Start: today.Date.Add(defaultNightStart * time.Hour),
+		End:   tomorrow.Add(defaultNightEnd * time.Hour),
+	}
+
+	if hasSunrise && hasSunset {
+		forecast.Sunrise, forecast.Sunset = sunrise, sunset
+		forecast.MorningBlueHour, forecast.MorningGoldenHour, forecast.EveningGoldenHour, forecast.EveningBlueHour =
+			models.LightWindows(sunrise, sunset)
+
+		// The night ends where tomorrow's blue hour begins.
+		nextSunrise := sunrise.AddDate(0, 0, 1)
+		if len(report.Daily) > 1 {
+			if next, ok := clockOn(report.Daily[1].Date, report.Daily[1].Sunrise); ok {
+				nextSunrise = next
+			}
+		}
+		nextBlueHour, _, _, _ := models.LightWindows(nextSunrise, nextSunrise)
+		forecast.Night = models.TimeWindow{Start: forecast.EveningBlueHour.End, End: nextBlueHour.Start}
+	}
+
+	from := forecast.Night.Start.Truncate(time.Hour)
+	for _, hour := range report.Hourly {
+		if hour.Time.Before(from) || !hour.Time.Before(forecast.Night.End) {
+			continue
+		}
+		forecast.NightHours = append(forecast.NightHours, models.CloudForecast{Time: hour.Time, CloudCover: hour.CloudCover})
+	}
+	forecast.Stargazing = models.Stargazing(forecast.NightHours, forecast.MoonIllumination)
+
+	return forecast, nil
+}
+
+// clockOn places a clock time such as "06:45 AM" on the given day, in the
+// day's timezone.
+func clockOn(day time.Time, clock string) (time.Time, bool) {
+	t, err := time.Parse("03:04 PM", clock)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), 0, 0, day.Location()), true
+}
@@ -0,0 +1,51 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+
+	"weather_subscription/internal/db/models"
+	weatherProvider "weather_subscription/internal/weatherProvider"
+)
+
+// weatherHistory compares today's forecast for a location with its past
+// weather for daily digests. It is best effort: without history the digest is
+// sent without the comparison.
+func (s *WeatherScheduler) weatherHistory(ctx context.Context, location string, report *weatherProvider.Report) *models.WeatherHistory {
+	historyProvider, ok := s.provider.(weatherProvider.HistoryProvider)
+	if !ok || len(report.Daily) == 0 {
+		return nil
+	}
+
+	comparison, err := weatherProvider.Compare(ctx, historyProvider, location, report.Daily[0])
+	if err != nil {
+		log.Printf("Error fetching weather history for %s: %v", location, err)
+		return nil
+	}
+
+	history := &models.WeatherHistory{
+		LastYearDelta: comparison.LastYearDelta,
+		WeekAvg:       comparison.WeekAvgTempC,
+		WeekDelta:     comparison.WeekDelta,
+	}
+	if comparison.LastYear != nil {
+		lastYear := pastDay(*comparison.LastYear)
+		history.LastYear = &lastYear
+	}
+	for _, day := range comparison.Week {
+		history.Week = append(history.Week, pastDay(day))
+	}
+
+	return history
+}
+
+func pastDay(day weatherProvider.Day) models.PastDay {
+	return models.PastDay{
+		Date:           day.Date,
+		MinTemperature: day.MinTempC,
+		MaxTemperature: day.MaxTempC,
+		AvgTemperature: day.AvgTempC,
+		TotalPrecipMm:  day.TotalPrecipMm,
+		Description:    day.Description,
+	}
+}
@@ -0,0 +1,150 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"weather_subscription/internal/db/models"
+	weatherProvider "weather_subscription/internal/weatherProvider"
+)
+
+var errMarineUnsupported = errors.New("weather provider has no marine forecasts")
+
+// processMarine fetches the marine forecast once per location and sends the
+// report to every marine job for that location.
+func (s *WeatherScheduler) processMarine(ctx context.Context, jobs []*models.DeliveryJob) {
+	if len(jobs) == 0 {
+		return
+	}
+
+	marine, ok := s.provider.(weatherProvider.MarineProvider)
+	if !ok {
+		for _, job := range jobs {
+			s.finish(ctx, job, errMarineUnsupported)
+		}
+		return
+	}
+
+	reports := make(map[string]*weatherProvider.MarineReport)
+	errs := make(map[string]error)
+	for _, job := range jobs {
+		key := weatherProvider.LocationKey(job.Subscription.LocationQuery())
+		if _, fetched := reports[key]; !fetched {
+			reports[key], errs[key] = s.fetchMarine(ctx, marine, job.Subscription.LocationQuery())
+		} else {
+			weatherFetchesSaved.Add(1)
+		}
+
+		if errs[key] != nil {
+			s.finish(ctx, job, errs[key])
+			continue
+		}
+		s.finish(ctx, job, s.sendMarineReport(jobContext(ctx, job), job.Subscription, reports[key]))
+	}
+}
+
+func (s *WeatherScheduler) fetchMarine(ctx context.Context, marine weatherProvider.MarineProvider, city string) (*weatherProvider.MarineReport, error) {
+	weatherFetches.Add(1)
+
+	report, err := marine.Marine(ctx, weatherProvider.Query{Location: city, Days: 1})
+	if err != nil {
+		weatherFetchErrors.Add(1)
+		return nil, fmt.Errorf("failed to fetch marine forecast for %s: %w", city, err)
+	}
+	if len(report.Days) == 0 {
+		weatherFetchErrors.Add(1)
+		return nil, fmt.Errorf("incomplete marine data for %s", city)
+	}
+
+	return report, nil
+}
+
+func (s *WeatherScheduler) sendMarineReport(ctx context.Context, subscription *models.Subscription, report *weatherProvider.MarineReport) error {
+	forecast := marineForecast(report, time.Now())
+	forecast.Location = subscription.City
+
+	if err := s.notifier.SendMarineReport(ctx, subscription, forecast); err != nil {
+		return fmt.Errorf("failed to send marine report to %s: %w", subscription.Email, err)
+	}
+
+	return nil
+}
+
+// marineForecast builds today's report from now on, marking each hour with
+// the tide turning within it or whether the tide is rising or falling.
+func marineForecast(report *weatherProvider.MarineReport, now time.Time) *models.MarineForecast {
+	today := report.Days[0]
+	forecast := &models.MarineForecast{
+		Location: report.Location.Name,
+		Date:     today.Date,
+		Sunrise:  today.Sunrise,
+		Sunset:   today.Sunset,
+		Source:   weatherProvider.MarineAttribution(report),
+	}
+
+	for _, tide := range today.Tides {
+		forecast.Tides = append(forecast.Tides, models.TideForecast{
+			Time:    tide.Time,
+			HeightM: tide.HeightM,
+			Type:    tide.Type,
+		})
+	}
+
+	from := now.Truncate(time.Hour)
+	for _, hour := range today.Hours {
+		if hour.Time.Before(from) {
+			continue
+		}
+
+		forecast.Hours = append(forecast.Hours, models.MarineHourForecast{
+			Time:         hour.Time,
+			WaveHeightM:  hour.WaveHeightM,
+			SwellHeightM: hour.SwellHeightM,
+			SwellCompass: hour.SwellCompass,
+			SwellPeriodS: hour.SwellPeriodS,
+			WindKph:      hour.WindKph,
+			WindCompass:  hour.WindCompass,
+			WaterTempC:   hour.WaterTempC,
+			Tide:         tideState(today.Tides, hour.Time),
+		})
+		forecast.HasWind = forecast.HasWind || hour.WindCompass != ""
+		forecast.HasWaterTemp = forecast.HasWaterTemp || hour.WaterTempC != 0
+	}
+
+	return forecast
+}
+
+// tideState describes the tide during the hour starting at t: the high or
+// low tide within the hour, or rising or falling towards the next one.
+func tideState(tides []weatherProvider.Tide, t time.Time) string {
+	var previous *weatherProvider.Tide
+	for i := range tides {
+		tide := &tides[i]
+		switch {
+		case tide.Time.Before(t):
+			previous = tide
+		case tide.Time.Before(t.Add(time.Hour)):
+			return fmt.Sprintf("%s %s", strings.ToLower(tide.Type), tide.Time.Format("15:04"))
+		case isHighTide(tide.Type):
+			return "rising"
+		default:
+			return "falling"
+		}
+	}
+
+	switch {
+	case previous == nil:
+		return ""
+	case isHighTide(previous.Type):
+		return "falling"
+	default:
+		return "rising"
+	}
+}
+
+func isHighTide(tideType string) bool {
+	return strings.EqualFold(tideType, "HIGH")
+}
@@ -0,0 +1,42 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	databasehandler "weather_subscription/internal/db/database_handler"
+	"weather_subscription/internal/db/models"
+	weatherProvider "weather_subscription/internal/weatherProvider"
+)
+
+// recordObservation archives the current conditions of a fetched report for
+// trend analytics. It is best effort: a failure does not hold up deliveries.
+func recordObservation(ctx context.Context, report *weatherProvider.Report) {
+	location, current := report.Location, report.Current
+	observation := &models.WeatherObservation{
+		CityKey:     weatherProvider.LocationKey(location.Name),
+		City:        location.Name,
+		Country:     location.Country,
+		Lat:         &location.Lat,
+		Lon:         &location.Lon,
+		Timezone:    location.Timezone,
+		Source:      report.Source,
+		ObservedAt:  current.Time,
+		Temperature: current.TemperatureC,
+		Humidity:    float64(current.Humidity),
+		WindSpeed:   current.WindKph,
+		PrecipMm:    current.PrecipMm,
+		Description: current.Description,
+	}
+	if observation.Timezone == "" {
+		observation.Timezone = "UTC"
+	}
+	if observation.ObservedAt.IsZero() {
+		observation.ObservedAt = time.Now().Truncate(time.Minute)
+	}
+
+	if err := databasehandler.RecordObservation(ctx, observation); err != nil {
+		log.Printf("Error recording weather observation for %s: %v", location.Name, err)
+	}
+}
@@ -0,0 +1,244 @@
+package scheduler
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"time"
+
+	databasehandler "weather_subscription/internal/db/database_handler"
+	"weather_subscription/internal/db/models"
+	weatherProvider "weather_subscription/internal/weatherProvider"
+)
+
+const (
+	ruleInterval = 5 * time.Minute
+	// ruleForecastDays covers MaxRuleLookahead from any time of the day.
+	ruleForecastDays = 3
+)
+
+// Exposed on /debug/vars.
+var (
+	rulesFired     = expvar.NewInt("scheduler_rules_fired")
+	rulesRearmed   = expvar.NewInt("scheduler_rules_rearmed")
+	ruleSendErrors = expvar.NewInt("scheduler_rule_send_errors")
+)
+
+func (s *WeatherScheduler) evaluateConditions(ctx context.Context) {
+	ticker := time.NewTicker(ruleInterval)
+	defer ticker.Stop()
+
+	for {
+		s.evaluate(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// evaluate checks notification rules and air quality alerts against the
+// weather of their cities, fetched once per location.
+func (s *WeatherScheduler) evaluate(ctx context.Context, now time.Time) {
+	rules, err := databasehandler.ListActiveRules(ctx)
+	if err != nil {
+		log.Printf("Error fetching notification rules: %v", err)
+	}
+	airQualitySubscriptions, err := databasehandler.ListAirQualityAlertSubscriptions(ctx)
+	if err != nil {
+		log.Printf("Error fetching air quality alert subscriptions: %v", err)
+	}
+
+	// Like the updates, readings are fetched in the subscriber's language, so
+	// whatever a notification quotes from them is translated.
+	queries := make(map[string]weatherProvider.Query)
+	for _, rule := range rules {
+		addQuery(queries, queryKey(rule.Subscription), rule.Subscription.LocationQuery(), func(query *weatherProvider.Query) {
+			query.Lang = language(rule.Subscription)
+			query.Days = ruleForecastDays
+		})
+	}
+	for _, sub := range airQualitySubscriptions {
+		addQuery(queries, queryKey(sub), sub.LocationQuery(), func(query *weatherProvider.Query) {
+			query.Lang = language(sub)
+			query.AirQuality = true
+		})
+	}
+	if len(queries) == 0 {
+		return
+	}
+
+	readings := s.fetchAll(ctx, queries)
+
+	s.checkRules(ctx, rules, readings, now)
+	s.checkAirQuality(ctx, airQualitySubscriptions, readings)
+}
+
+// checkRules fires each rule whose condition became met and re-arms those no
+// longer met, so a lasting condition is notified only once.
+func (s *WeatherScheduler) checkRules(ctx context.Context, rules []*models.NotificationRule, readings map[string]reading, now time.Time) {
+	for _, rule := range rules {
+		reading := readings[queryKey(rule.Subscription)]
+		if reading.err != nil {
+			log.Printf("Skipping rule %d: %v", rule.ID, reading.err)
+			continue
+		}
+
+		match, ok, known := evaluateRule(rule, reading.report, now)
+		if !known {
+			continue
+		}
+
+		switch {
+		case ok && !rule.Triggered:
+			s.fire(ctx, rule, match)
+		case !ok && rule.Triggered:
+			if changed, err := databasehandler.SetRuleTriggered(ctx, rule.ID, false); err != nil {
+				log.Printf("Error re-arming rule %d: %v", rule.ID, err)
+			} else if changed {
+				rulesRearmed.Add(1)
+			}
+		}
+	}
+}
+
+// fire marks the rule as triggered and notifies the subscriber. The state is
+// claimed first so only one replica sends, and released if sending fails so
+// the next evaluation retries.
+func (s *WeatherScheduler) fire(ctx context.Context, rule *models.NotificationRule, match models.RuleMatch) {
+	changed, err := databasehandler.SetRuleTriggered(ctx, rule.ID, true)
+	if err != nil {
+		log.Printf("Error triggering rule %d: %v", rule.ID, err)
+		return
+	}
+	if !changed {
+		return
+	}
+
+	if err := s.notifier.SendRuleNotification(ctx, rule.Subscription, rule, match); err != nil {
+		ruleSendErrors.Add(1)
+		log.Printf("Error sending rule %d notification to %s: %v", rule.ID, rule.Subscription.Email, err)
+
+		if _, err := databasehandler.SetRuleTriggered(ctx, rule.ID, false); err != nil {
+			log.Printf("Error releasing rule %d: %v", rule.ID, err)
+		}
+		return
+	}
+
+	rulesFired.Add(1)
+}
+
+// evaluateRule looks for the first value of the rule's field in the lookahead
+// window that meets the condition. known is false when the report has no
+// data for the window, in which case the rule's state is left alone.
+func evaluateRule(rule *models.NotificationRule, report *weatherProvider.Report, now time.Time) (match models.RuleMatch, ok bool, known bool) {
+	for _, sample := range ruleSamples(rule, report, now) {
+		known = true
+		if rule.Comparator.Compare(sample.Value, rule.Threshold) {
+			return sample, true, true
+		}
+	}
+
+	return models.RuleMatch{}, false, known
+}
+
+// ruleSamples returns the values of the rule's field within the window from
+// now to now plus the rule's lookahead.
+func ruleSamples(rule *models.NotificationRule, report *weatherProvider.Report, now time.Time) []models.RuleMatch {
+	end := now.Add(time.Duration(rule.LookaheadHours) * time.Hour)
+
+	var samples []models.RuleMatch
+	if rule.Field.Daily() {
+		for _, day := range report.Daily {
+			if day.Date.After(end) || !day.Date.AddDate(0, 0, 1).After(now) {
+				continue
+			}
+			if value, ok := dailyValue(rule.Field, day); ok {
+				samples = append(samples, models.RuleMatch{Value: value, At: day.Date})
+			}
+		}
+		return samples
+	}
+
+	if rule.LookaheadHours == 0 && report.Current != nil {
+		if value, ok := currentValue(rule.Field, report.Current); ok {
+			return []models.RuleMatch{{Value: value, At: now}}
+		}
+	}
+
+	from := now.Truncate(time.Hour)
+	for _, hour := range report.Hourly {
+		if hour.Time.Before(from) || hour.Time.After(end) {
+			continue
+		}
+		if value, ok := hourlyValue(rule.Field, hour); ok {
+			samples = append(samples, models.RuleMatch{Value: value, At: hour.Time})
+		}
+	}
+
+	return samples
+}
+
+func currentValue(field models.RuleField, current *weatherProvider.Current) (float64, bool) {
+	switch field {
+	case models.RuleTemperature:
+		return current.TemperatureC, true
+	case models.RuleFeelsLike:
+		return current.FeelsLikeC, true
+	case models.RuleWindSpeed:
+		return current.WindKph, true
+	case models.RuleGustSpeed:
+		return current.GustKph, true
+	case models.RuleHumidity:
+		return float64(current.Humidity), true
+	case models.RulePrecipitation:
+		return current.PrecipMm, true
+	default:
+		// Chances of rain and snow are only forecast per hour.
+		return 0, false
+	}
+}
+
+func hourlyValue(field models.RuleField, hour weatherProvider.Hour) (float64, bool) {
+	switch field {
+	case models.RuleTemperature:
+		return hour.TemperatureC, true
+	case models.RuleFeelsLike:
+		return hour.FeelsLikeC, true
+	case models.RuleWindSpeed:
+		return hour.WindKph, true
+	case models.RuleGustSpeed:
+		return hour.GustKph, true
+	case models.RuleHumidity:
+		return float64(hour.Humidity), true
+	case models.RulePrecipitation:
+		return hour.PrecipMm, true
+	case models.RuleChanceOfRain:
+		return float64(hour.ChanceOfRain), true
+	case models.RuleChanceOfSnow:
+		return float64(hour.ChanceOfSnow), true
+	default:
+		return 0, false
+	}
+}
+
+func dailyValue(field models.RuleField, day weatherProvider.Day) (float64, bool) {
+	switch field {
+	case models.RuleDailyMaxTemp:
+		return day.MaxTempC, true
+	case models.RuleDailyMinTemp:
+		return day.MinTempC, true
+	case models.RuleDailyPrecip:
+		return day.TotalPrecipMm, true
+	case models.RuleDailyChanceOfRain:
+		return float64(day.ChanceOfRain), true
+	case models.RuleDailyChanceOfSnow:
+		return float64(day.ChanceOfSnow), true
+	case models.RuleDailyUV:
+		return day.UV, true
+	default:
+		return 0, false
+	}
+}
@@ -2,101 +2,514 @@ package scheduler
 
 import (
 	"context"
+	"errors"
+	"expvar"
+	"fmt"
 	"log"
+	"sync"
 	"time"
 
+	"weather_subscription/internal/backoff"
 	databasehandler "weather_subscription/internal/db/database_handler"
 	"weather_subscription/internal/db/models"
-	"weather_subscription/internal/services/email"
-	weatherClient "weather_subscription/internal/weatherClient"
+	"weather_subscription/internal/schedule"
+	"weather_subscription/internal/services/notifier"
+	weatherProvider "weather_subscription/internal/weatherProvider"
 )
 
+const (
+	planInterval       = 1 * time.Minute
+	pollInterval       = 10 * time.Second
+	claimBatchSize     = 100
+	claimLease         = 10 * time.Minute
+	fetchConcurrency   = 8
+	baseBackoff        = 1 * time.Minute
+	maxBackoff         = 30 * time.Minute
+	defaultMaxAttempts = 5
+	// leaseRenewal is how often the leases of a batch being worked on are
+	// extended; with marine reports and history lookups a batch can take
+	// longer than one lease.
+	leaseRenewal = claimLease / 3
+	// maxCatchUp bounds how far back planning looks after downtime.
+	maxCatchUp = 24 * time.Hour
+)
+
+// Exposed on /debug/vars. weatherFetchesSaved counts deliveries that reused a
+// reading fetched for another subscription to the same location.
+var (
+	weatherFetches      = expvar.NewInt("scheduler_weather_fetches")
+	weatherFetchErrors  = expvar.NewInt("scheduler_weather_fetch_errors")
+	weatherFetchesSaved = expvar.NewInt("scheduler_weather_fetches_saved")
+)
+
+// WeatherScheduler turns subscription schedules into delivery jobs stored in
+// Postgres and works them off. Planning and delivery both run on every
+// replica: job creation is idempotent and jobs are claimed with
+// SELECT ... FOR UPDATE SKIP LOCKED, so each update is sent by one replica and
+// retried with backoff if sending fails.
 type WeatherScheduler struct {
-	weatherClient *weatherClient.APIClient
-	emailService  *email.EmailService
+	provider    weatherProvider.WeatherProvider
+	notifier    notifier.Notifier
+	maxAttempts int
 }
 
-func NewWeatherScheduler(weatherClient *weatherClient.APIClient, emailService *email.EmailService) *WeatherScheduler {
+func NewWeatherScheduler(provider weatherProvider.WeatherProvider, notifier notifier.Notifier, maxAttempts int) *WeatherScheduler {
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+
 	return &WeatherScheduler{
-		weatherClient: weatherClient,
-		emailService:  emailService,
+		provider:    provider,
+		notifier:    notifier,
+		maxAttempts: maxAttempts,
 	}
 }
 
 func (s *WeatherScheduler) Start(ctx context.Context) {
-	// Start daily check at midnight
-	go s.scheduleDailyCheck(ctx)
+	// Start planning due deliveries in each subscriber's local time
+	go s.schedulePlanning(ctx)
+
+	// Start sending planned deliveries
+	go s.processJobs(ctx)
 
-	// Start hourly check
-	go s.scheduleHourlyCheck(ctx)
+	// Start evaluating notification rules and air quality alerts
+	go s.evaluateConditions(ctx)
 }
 
-func (s *WeatherScheduler) scheduleDailyCheck(ctx context.Context) {
+func (s *WeatherScheduler) schedulePlanning(ctx context.Context) {
+	ticker := time.NewTicker(planInterval)
+	defer ticker.Stop()
+
 	for {
-		now := time.Now()
-		next := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
-		time.Sleep(time.Until(next))
+		s.plan(ctx, time.Now())
 
-		// Get all daily subscriptions
-		subscriptions, err := databasehandler.ListActiveSubscriptions(ctx)
-		if err != nil {
-			log.Printf("Error fetching daily subscriptions: %v", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// plan creates a job for the latest occurrence of each subscription's schedule
+// that is due and not yet planned. Missed occurrences (e.g. while no replica
+// was running) collapse into a single catch-up delivery.
+func (s *WeatherScheduler) plan(ctx context.Context, now time.Time) {
+	subscriptions, err := databasehandler.ListActiveSubscriptions(ctx)
+	if err != nil {
+		log.Printf("Error fetching subscriptions to plan: %v", err)
+		return
+	}
+
+	for _, sub := range subscriptions {
+		due := latestDue(sub, now)
+		if due.IsZero() {
 			continue
 		}
 
-		for _, sub := range subscriptions {
-			if sub.Frequency == models.Daily {
-				s.sendWeatherUpdate(ctx, sub)
-			}
+		if err := databasehandler.EnqueueDeliveryJob(ctx, sub.ID, due); err != nil {
+			log.Printf("Error planning delivery for subscription %d: %v", sub.ID, err)
+		}
+	}
+}
+
+// latestDue returns the newest occurrence after the last planned one that is
+// not after now, or the zero time if nothing is due.
+func latestDue(sub *models.Subscription, now time.Time) time.Time {
+	after := sub.LastScheduledAt
+	if after == nil {
+		after = sub.ConfirmedAt
+	}
+	if after == nil {
+		after = &sub.CreatedAt
+	}
+
+	from := *after
+	if earliest := now.Add(-maxCatchUp); from.Before(earliest) {
+		from = earliest
+	}
+
+	var latest time.Time
+	for next := nextRun(sub, from); !next.IsZero() && !next.After(now); next = nextRun(sub, next) {
+		latest = next
+	}
+
+	return latest
+}
+
+// nextRun returns the first occurrence of the subscription's schedule after t.
+func nextRun(sub *models.Subscription, t time.Time) time.Time {
+	switch sub.Frequency {
+	case models.Hourly:
+		return t.Truncate(time.Hour).Add(time.Hour)
+	case models.Daily:
+		return nextDaily(sub, t)
+	case models.Custom:
+		spec, err := schedule.Parse(sub.Schedule)
+		if err != nil {
+			log.Printf("Invalid schedule %q for subscription %d: %v", sub.Schedule, sub.ID, err)
+			return time.Time{}
 		}
+		return spec.Next(t.In(sub.Location()))
+	default:
+		return time.Time{}
 	}
 }
 
-func (s *WeatherScheduler) scheduleHourlyCheck(ctx context.Context) {
-	ticker := time.NewTicker(1 * time.Hour)
+// nextDaily returns the next delivery hour in the subscriber's timezone after
+// t. Building it from the local date follows DST: a delivery hour skipped by
+// a spring-forward transition resolves to a valid time next to the gap, and
+// a repeated hour is delivered once because occurrences only move forward.
+func nextDaily(sub *models.Subscription, t time.Time) time.Time {
+	loc := sub.Location()
+	local := t.In(loc)
+
+	next := time.Date(local.Year(), local.Month(), local.Day(), sub.DeliveryHour, 0, 0, 0, loc)
+	if !next.After(t) {
+		next = time.Date(local.Year(), local.Month(), local.Day()+1, sub.DeliveryHour, 0, 0, 0, loc)
+	}
+
+	return next
+}
+
+func (s *WeatherScheduler) processJobs(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
 	defer ticker.Stop()
 
 	for {
+		s.drain(ctx)
+
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			// Get all hourly subscriptions
-			subscriptions, err := databasehandler.ListActiveSubscriptions(ctx)
-			if err != nil {
-				log.Printf("Error fetching hourly subscriptions: %v", err)
-				continue
-			}
+		}
+	}
+}
+
+// drain keeps claiming batches until no job is due.
+func (s *WeatherScheduler) drain(ctx context.Context) {
+	for {
+		jobs, err := databasehandler.ClaimDeliveryJobs(ctx, claimBatchSize, claimLease)
+		if err != nil {
+			log.Printf("Error claiming delivery jobs: %v", err)
+			return
+		}
+
+		batchCtx, stop := keepLeases(ctx, jobs)
+		s.processBatch(batchCtx, jobs)
+		leaseLost := batchCtx.Err() != nil && ctx.Err() == nil
+		stop()
 
-			for _, sub := range subscriptions {
-				if sub.Frequency == models.Hourly {
-					s.sendWeatherUpdate(ctx, sub)
+		if leaseLost || len(jobs) < claimBatchSize {
+			return
+		}
+	}
+}
+
+// keepLeases renews the leases of the batch's jobs until the returned
+// function is called, so that no other replica claims and sends them again
+// while they are being worked on. Finished jobs are no longer running and
+// keep their state. If a renewal fails the returned context is cancelled: the
+// leases may run out, so the rest of the batch is left to whoever claims it
+// next.
+func keepLeases(ctx context.Context, jobs []*models.DeliveryJob) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	if len(jobs) == 0 {
+		return ctx, cancel
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(leaseRenewal)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := databasehandler.ExtendDeliveryJobLeases(ctx, jobs, claimLease); err != nil {
+					log.Printf("Error extending leases of %d delivery jobs, abandoning the batch: %v", len(jobs), err)
+					cancel()
+					return
 				}
 			}
 		}
+	}()
+
+	return ctx, func() {
+		close(done)
+		<-stopped
+		cancel()
+	}
+}
+
+// processBatch fetches the weather once per location in the batch, with
+// bounded concurrency, and fans each reading out to every job for that
+// location. Daily digests also compare the day with the location's past
+// weather. Marine subscriptions get their own report.
+func (s *WeatherScheduler) processBatch(ctx context.Context, jobs []*models.DeliveryJob) {
+	byLocation := make(map[string][]*models.DeliveryJob)
+	queries := make(map[string]weatherProvider.Query)
+	var marineJobs []*models.DeliveryJob
+	for _, job := range jobs {
+		if !job.Subscription.Active || !job.Subscription.Confirmed {
+			s.finish(ctx, job, errSubscriptionInactive)
+			continue
+		}
+		if job.Subscription.Kind == models.MarineKind {
+			marineJobs = append(marineJobs, job)
+			continue
+		}
+
+		key := queryKey(job.Subscription)
+		byLocation[key] = append(byLocation[key], job)
+		addQuery(queries, key, job.Subscription.LocationQuery(), func(query *weatherProvider.Query) {
+			query.Lang = language(job.Subscription)
+			query.Days = max(query.Days, 1)
+			if job.Subscription.Kind == models.AstronomyKind {
+				query.Days = max(query.Days, astronomyForecastDays)
+			}
+			query.AirQuality = query.AirQuality || job.Subscription.AirQuality.Enabled
+		})
+	}
+
+	readings := s.fetchAll(ctx, queries)
+
+	for key, locationJobs := range byLocation {
+		reading := readings[key]
+
+		// Looked up at most once per location, for its daily digests.
+		var history *models.WeatherHistory
+		compared := false
+
+		for _, job := range locationJobs {
+			if reading.err != nil {
+				s.finish(ctx, job, reading.err)
+				continue
+			}
+			if job.Subscription.Kind == models.AstronomyKind {
+				s.finish(ctx, job, s.sendAstronomyDigest(jobContext(ctx, job), job.Subscription, reading.report))
+				continue
+			}
+			if job.Subscription.Frequency == models.Daily && !compared {
+				history, compared = s.weatherHistory(ctx, job.Subscription.LocationQuery(), reading.report), true
+			}
+			s.finish(ctx, job, s.sendWeatherUpdate(jobContext(ctx, job), job.Subscription, reading.report, history))
+		}
+	}
+
+	s.processMarine(ctx, marineJobs)
+}
+
+type reading struct {
+	report *weatherProvider.Report
+	err    error
+}
+
+// addQuery merges what a subscription needs from its location's weather into
+// the single query made for that location, under the given key.
+func addQuery(queries map[string]weatherProvider.Query, key, city string, update func(*weatherProvider.Query)) {
+	query, ok := queries[key]
+	if ok {
+		weatherFetchesSaved.Add(1)
+	} else {
+		query.Location = city
 	}
+
+	update(&query)
+	queries[key] = query
+}
+
+// queryKey keys the query a subscription's emails are written from: one per
+// location and language, since condition descriptions arrive translated.
+func queryKey(sub *models.Subscription) string {
+	key := weatherProvider.LocationKey(sub.LocationQuery())
+	if lang := language(sub); lang != "" {
+		key += "|" + lang
+	}
+
+	return key
+}
+
+// language is the language to request condition descriptions in, or nothing
+// for the provider's default, English.
+func language(sub *models.Subscription) string {
+	if sub.Language == models.DefaultLanguage {
+		return ""
+	}
+
+	return sub.Language
 }
 
-func (s *WeatherScheduler) sendWeatherUpdate(ctx context.Context, subscription *models.Subscription) {
-	// Get weather data
-	weather, _, err := s.weatherClient.APIsApi.RealtimeWeather(ctx, subscription.City, nil)
+// fetchAll runs the query of every location, at most fetchConcurrency at a
+// time, and returns the readings by location key.
+func (s *WeatherScheduler) fetchAll(ctx context.Context, queries map[string]weatherProvider.Query) map[string]reading {
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		sem      = make(chan struct{}, fetchConcurrency)
+		readings = make(map[string]reading, len(queries))
+	)
+
+	for key, query := range queries {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			report, err := s.fetchWeather(ctx, query)
+
+			mu.Lock()
+			readings[key] = reading{report: report, err: err}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	return readings
+}
+
+func (s *WeatherScheduler) fetchWeather(ctx context.Context, query weatherProvider.Query) (*weatherProvider.Report, error) {
+	weatherFetches.Add(1)
+
+	report, err := s.provider.Fetch(ctx, query)
 	if err != nil {
-		log.Printf("Error fetching weather for %s: %v", subscription.City, err)
+		weatherFetchErrors.Add(1)
+		return nil, fmt.Errorf("failed to fetch weather for %s: %w", query.Location, err)
+	}
+	if report.Current == nil {
+		weatherFetchErrors.Add(1)
+		return nil, fmt.Errorf("incomplete weather data for %s", query.Location)
+	}
+	recordObservation(ctx, report)
+
+	return report, nil
+}
+
+var errSubscriptionInactive = errors.New("subscription is no longer active")
+
+// finish records the outcome of a delivery: sent, retried with backoff, or
+// failed for good once maxAttempts is reached.
+func (s *WeatherScheduler) finish(ctx context.Context, job *models.DeliveryJob, err error) {
+	// The batch was abandoned; the job is claimed again once its lease runs out.
+	if ctx.Err() != nil {
+		return
+	}
+
+	if err == nil {
+		logOutcome(job, "sent", databasehandler.MarkDeliveryJobSent(ctx, job))
+		return
+	}
+
+	if err == errSubscriptionInactive || job.Attempts >= s.maxAttempts {
+		log.Printf("Giving up on delivery job %d after %d attempts: %v", job.ID, job.Attempts, err)
+		logOutcome(job, "failed", databasehandler.FailDeliveryJob(ctx, job, err.Error()))
 		return
 	}
 
+	delay := backoff.Exponential(job.Attempts, baseBackoff, maxBackoff)
+	log.Printf("Error delivering job %d (attempt %d), retrying in %s: %v", job.ID, job.Attempts, delay, err)
+	logOutcome(job, "rescheduled", databasehandler.RescheduleDeliveryJob(ctx, job, err.Error(), delay))
+}
+
+// jobContext lets the notifier skip the channels earlier attempts of the job
+// reached and record the ones this attempt reaches, so a retry only goes to
+// the channels that failed.
+func jobContext(ctx context.Context, job *models.DeliveryJob) context.Context {
+	return notifier.WithDelivered(ctx, &job.Delivered)
+}
+
+// logOutcome reports a failure to record what happened to a job.
+func logOutcome(job *models.DeliveryJob, outcome string, err error) {
+	switch {
+	case err == nil:
+	case errors.Is(err, databasehandler.ErrLeaseLost):
+		log.Printf("Delivery job %d was claimed by another worker before it could be marked as %s", job.ID, outcome)
+	default:
+		log.Printf("Error marking delivery job %d as %s: %v", job.ID, outcome, err)
+	}
+}
+
+func (s *WeatherScheduler) sendWeatherUpdate(ctx context.Context, subscription *models.Subscription, report *weatherProvider.Report, history *models.WeatherHistory) error {
 	// Create weather forecast model
 	forecast := &models.WeatherForecast{
 		City:        subscription.City,
-		Temperature: weather.Current.TempC,
-		Description: weather.Current.Condition.Text,
-		Humidity:    int(weather.Current.Humidity),
-		WindSpeed:   weather.Current.WindKph,
+		Temperature: report.Current.TemperatureC,
+		Description: report.Current.Description,
+		Condition:   string(report.Current.Condition),
+		Humidity:    report.Current.Humidity,
+		WindSpeed:   report.Current.WindKph,
+		Source:      weatherProvider.Attribution(report),
 	}
 
-	// Send email
-	if err := s.emailService.SendWeatherUpdate(ctx, subscription.Email, forecast); err != nil {
-		log.Printf("Error sending weather update to %s: %v", subscription.Email, err)
-		return
+	// Daily subscribers get a digest of their day rather than a snapshot
+	if subscription.Frequency == models.Daily {
+		forecast.Day, forecast.Hours = dailyDigest(report, time.Now())
+		forecast.History = history
+	}
+
+	if subscription.AirQuality.Enabled && report.AirQuality != nil {
+		airQuality := models.AirQualityFromReport(subscription.AirQuality.Scale, report.AirQuality)
+		forecast.AirQuality = &airQuality
+	}
+
+	if err := s.notifier.SendWeatherUpdate(ctx, subscription, forecast); err != nil {
+		return fmt.Errorf("failed to send weather update to %s: %w", subscription.Email, err)
+	}
+
+	return nil
+}
+
+// dailyDigest summarizes today and lists the forecast for the remaining hours
+// of the day from now on.
+func dailyDigest(report *weatherProvider.Report, now time.Time) (*models.DailyForecast, []models.HourlyForecast) {
+	if len(report.Daily) == 0 {
+		return nil, nil
 	}
+
+	today := report.Daily[0]
+	day := &models.DailyForecast{
+		MinTemperature: today.MinTempC,
+		MaxTemperature: today.MaxTempC,
+		AvgTemperature: today.AvgTempC,
+		MaxWindSpeed:   today.MaxWindKph,
+		TotalPrecipMm:  today.TotalPrecipMm,
+		ChanceOfRain:   today.ChanceOfRain,
+		ChanceOfSnow:   today.ChanceOfSnow,
+		UV:             today.UV,
+		Description:    today.Description,
+		Condition:      string(today.Condition),
+		Sunrise:        today.Sunrise,
+		Sunset:         today.Sunset,
+	}
+
+	from := now.Truncate(time.Hour)
+	end := today.Date.AddDate(0, 0, 1)
+
+	var hours []models.HourlyForecast
+	for _, hour := range report.Hourly {
+		if hour.Time.Before(from) || !hour.Time.Before(end) {
+			continue
+		}
+
+		hours = append(hours, models.HourlyForecast{
+			Time:         hour.Time,
+			Temperature:  hour.TemperatureC,
+			Description:  hour.Description,
+			Condition:    string(hour.Condition),
+			ChanceOfRain: hour.ChanceOfRain,
+			ChanceOfSnow: hour.ChanceOfSnow,
+			WindSpeed:    hour.WindKph,
+		})
+	}
+
+	return day, hours
 }
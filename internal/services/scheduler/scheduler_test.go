@@ -0,0 +1,165 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"weather_subscription/internal/db/models"
+)
+
+func TestNextDaily(t *testing.T) {
+	tests := []struct {
+		name string
+		hour int
+		from time.Time
+		want []time.Time
+	}{
+		{
+			name: "later today",
+			hour: 8,
+			from: utc(2026, time.October, 18, 10, 0), // 06:00 EDT
+			want: []time.Time{
+				utc(2026, time.October, 18, 12, 0),
+				utc(2026, time.October, 19, 12, 0),
+			},
+		},
+		{
+			name: "spring-forward gap resolves next to it",
+			hour: 2,
+			from: utc(2026, time.March, 7, 7, 0), // 02:00 EST
+			want: []time.Time{
+				utc(2026, time.March, 8, 6, 0), // 01:00 EST
+				utc(2026, time.March, 9, 6, 0), // 02:00 EDT
+			},
+		},
+		{
+			name: "fall-back repeat is delivered once",
+			hour: 1,
+			from: utc(2026, time.October, 31, 5, 0), // 01:00 EDT
+			want: []time.Time{
+				utc(2026, time.November, 1, 5, 0), // 01:00 EDT
+				utc(2026, time.November, 2, 6, 0), // 01:00 EST
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := &models.Subscription{Timezone: "America/New_York", DeliveryHour: tt.hour}
+
+			next := tt.from
+			for _, want := range tt.want {
+				got := nextDaily(sub, next)
+				if !got.Equal(want) {
+					t.Fatalf("nextDaily(%s) = %s, want %s", next.UTC(), got.UTC(), want)
+				}
+				next = got
+			}
+		})
+	}
+}
+
+func TestLatestDue(t *testing.T) {
+	tests := []struct {
+		name string
+		sub  models.Subscription
+		now  time.Time
+		want time.Time
+	}{
+		{
+			name: "today's delivery",
+			sub: models.Subscription{
+				Frequency:       models.Daily,
+				DeliveryHour:    8,
+				LastScheduledAt: ptr(utc(2026, time.October, 17, 12, 0)),
+			},
+			now:  utc(2026, time.October, 18, 13, 0),
+			want: utc(2026, time.October, 18, 12, 0),
+		},
+		{
+			name: "already planned",
+			sub: models.Subscription{
+				Frequency:       models.Daily,
+				DeliveryHour:    8,
+				LastScheduledAt: ptr(utc(2026, time.October, 18, 12, 0)),
+			},
+			now: utc(2026, time.October, 18, 13, 0),
+		},
+		{
+			name: "missed days collapse into one",
+			sub: models.Subscription{
+				Frequency:       models.Daily,
+				DeliveryHour:    8,
+				LastScheduledAt: ptr(utc(2026, time.October, 12, 12, 0)),
+			},
+			now:  utc(2026, time.October, 18, 13, 0),
+			want: utc(2026, time.October, 18, 12, 0),
+		},
+		{
+			name: "confirmation after today's hour",
+			sub: models.Subscription{
+				Frequency:    models.Daily,
+				DeliveryHour: 8,
+				ConfirmedAt:  ptr(utc(2026, time.October, 18, 12, 30)),
+			},
+			now: utc(2026, time.October, 18, 13, 0),
+		},
+		{
+			name: "daily on the spring-forward day",
+			sub: models.Subscription{
+				Frequency:       models.Daily,
+				DeliveryHour:    2,
+				LastScheduledAt: ptr(utc(2026, time.March, 7, 7, 0)),
+			},
+			now:  utc(2026, time.March, 8, 12, 0),
+			want: utc(2026, time.March, 8, 6, 0), // 01:00 EST
+		},
+		{
+			name: "daily after the fall-back repeat",
+			sub: models.Subscription{
+				Frequency:       models.Daily,
+				DeliveryHour:    1,
+				LastScheduledAt: ptr(utc(2026, time.November, 1, 5, 0)), // 01:00 EDT
+			},
+			now: utc(2026, time.November, 1, 6, 30), // 01:30 EST
+		},
+		{
+			name: "hourly keeps absolute hours across fall-back",
+			sub: models.Subscription{
+				Frequency:       models.Hourly,
+				LastScheduledAt: ptr(utc(2026, time.November, 1, 5, 0)), // 01:00 EDT
+			},
+			now:  utc(2026, time.November, 1, 6, 30),
+			want: utc(2026, time.November, 1, 6, 0), // 01:00 EST
+		},
+		{
+			name: "custom schedule skips the spring-forward gap",
+			sub: models.Subscription{
+				Frequency:       models.Custom,
+				Schedule:        "30 2 * * *",
+				LastScheduledAt: ptr(utc(2026, time.March, 7, 7, 30)),
+			},
+			now: utc(2026, time.March, 8, 12, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := tt.sub
+			sub.Timezone = "America/New_York"
+
+			if got := latestDue(&sub, tt.now); !got.Equal(tt.want) {
+				t.Errorf("latestDue = %s, want %s", got.UTC(), tt.want)
+			}
+		})
+	}
+}
+
+func utc(year int, month time.Month, day, hour, min int) time.Time {
+	return time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+}
+
+func ptr(t time.Time) *time.Time {
+	return &t
+}
@@ -917,11 +917,13 @@ Current weather or realtime weather API method allows a user to get up to date c
  * @param q Pass US Zipcode, UK Postcode, Canada Postalcode, IP address, Latitude/Longitude (decimal degree) or city name. Visit [request parameter section](https://www.weatherapi.com/docs/#intro-request) to learn more.
  * @param optional nil or *APIsApiRealtimeWeatherOpts - Optional Parameters:
      * @param "Lang" (optional.String) -  Returns &#x27;condition:text&#x27; field in API in the desired language.&lt;br /&gt; Visit [request parameter section](https://www.weatherapi.com/docs/#intro-request) to check &#x27;lang-code&#x27;.
+     * @param "Aqi" (optional.String) -  Enable/Disable Air Quality data in realtime API output. Example, aqi&#x3D;yes or aqi&#x3D;no.
 @return InlineResponse200
 */
 
 type APIsApiRealtimeWeatherOpts struct {
     Lang optional.String
+    Aqi optional.String
 }
 
 func (a *APIsApiService) RealtimeWeather(ctx context.Context, q string, localVarOptionals *APIsApiRealtimeWeatherOpts) (InlineResponse200, *http.Response, error) {
@@ -944,6 +946,9 @@ func (a *APIsApiService) RealtimeWeather(ctx context.Context, q string, localVar
 	if localVarOptionals != nil && localVarOptionals.Lang.IsSet() {
 		localVarQueryParams.Add("lang", parameterToString(localVarOptionals.Lang.Value(), ""))
 	}
+	if localVarOptionals != nil && localVarOptionals.Aqi.IsSet() {
+		localVarQueryParams.Add("aqi", parameterToString(localVarOptionals.Aqi.Value(), ""))
+	}
 	// to determine the Content-Type header
 	localVarHttpContentTypes := []string{}
 
@@ -0,0 +1,221 @@
+package swagger
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CachedResponse is a successful API response as stored in a ResponseCache.
+type CachedResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// ResponseCache stores API responses keyed by request. Get returns nil and no
+// error on a miss. Cache errors never fail an API call; they are logged and
+// the request goes upstream.
+type ResponseCache interface {
+	Get(ctx context.Context, key string) (*CachedResponse, error)
+	Set(ctx context.Context, key string, response *CachedResponse, ttl time.Duration) error
+}
+
+// Default fallback TTLs, used when a response carries no caching headers.
+var DefaultCacheTTL = map[string]time.Duration{
+	"/current.json":   10 * time.Minute,
+	"/forecast.json":  1 * time.Hour,
+	"/astronomy.json": 12 * time.Hour,
+	"/search.json":    24 * time.Hour,
+}
+
+// cachedCall serves GET requests to endpoints listed in Configuration.CacheTTL
+// from the cache, and stores successful upstream responses for the TTL given
+// by their Cache-Control/Expires headers or the endpoint's fallback.
+func (c *APIClient) cachedCall(request *http.Request, do func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	fallback, cacheable := c.cacheTTL(request)
+	if !cacheable {
+		return do(request)
+	}
+
+	ctx := request.Context()
+	key := cacheKey(request)
+
+	cached, err := c.cfg.Cache.Get(ctx, key)
+	if err != nil {
+		log.Printf("Error reading weather API cache: %v", err)
+	}
+	if cached != nil {
+		return cached.response(request), nil
+	}
+
+	response, err := do(request)
+	if err != nil || response.StatusCode != http.StatusOK {
+		return response, err
+	}
+
+	body, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = io.NopCloser(bytes.NewReader(body))
+
+	if ttl := responseTTL(response, fallback); ttl > 0 {
+		entry := &CachedResponse{
+			StatusCode: response.StatusCode,
+			Header:     response.Header.Clone(),
+			Body:       body,
+		}
+		if err := c.cfg.Cache.Set(ctx, key, entry, ttl); err != nil {
+			log.Printf("Error writing weather API cache: %v", err)
+		}
+	}
+
+	return response, nil
+}
+
+func (c *APIClient) cacheTTL(request *http.Request) (time.Duration, bool) {
+	if c.cfg.Cache == nil || request.Method != http.MethodGet {
+		return 0, false
+	}
+
+	for endpoint, ttl := range c.cfg.CacheTTL {
+		if strings.HasSuffix(request.URL.Path, endpoint) {
+			return ttl, true
+		}
+	}
+
+	return 0, false
+}
+
+// cacheKey identifies a request by its URL without the API key, so rotating
+// the key does not invalidate the cache and keys never end up in storage.
+func cacheKey(request *http.Request) string {
+	u := *request.URL
+	query := u.Query()
+	query.Del("key")
+	u.RawQuery = query.Encode()
+
+	return request.Method + " " + u.String()
+}
+
+// responseTTL honors no-store/no-cache and max-age, then Expires relative to
+// Date, and falls back to the endpoint default.
+func responseTTL(response *http.Response, fallback time.Duration) time.Duration {
+	cc := parseCacheControl(response.Header)
+	if _, ok := cc["no-store"]; ok {
+		return 0
+	}
+	if _, ok := cc["no-cache"]; ok {
+		return 0
+	}
+	if maxAge, ok := cc["max-age"]; ok {
+		if seconds, err := strconv.Atoi(maxAge); err == nil {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+
+	if response.Header.Get("Expires") != "" {
+		date, err := time.Parse(time.RFC1123, response.Header.Get("Date"))
+		if err == nil {
+			if ttl := CacheExpires(response).Sub(date); ttl > 0 {
+				return ttl
+			}
+			return 0
+		}
+	}
+
+	return fallback
+}
+
+func (r *CachedResponse) response(request *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode)),
+		StatusCode:    r.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        r.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       request,
+	}
+}
+
+// LRUCache is an in-memory ResponseCache holding at most capacity entries.
+type LRUCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List // front is most recently used
+}
+
+type lruEntry struct {
+	key       string
+	response  *CachedResponse
+	expiresAt time.Time
+}
+
+func NewLRUCache(capacity int) *LRUCache {
+	if capacity <= 0 {
+		capacity = 1000
+	}
+
+	return &LRUCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (c *LRUCache) Get(_ context.Context, key string) (*CachedResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, nil
+	}
+
+	entry := element.Value.(*lruEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return nil, nil
+	}
+
+	c.order.MoveToFront(element)
+	return entry.response, nil
+}
+
+func (c *LRUCache) Set(_ context.Context, key string, response *CachedResponse, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := time.Now().Add(ttl)
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*lruEntry)
+		entry.response = response
+		entry.expiresAt = expiresAt
+		c.order.MoveToFront(element)
+		return nil
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, response: response, expiresAt: expiresAt})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+
+	return nil
+}
@@ -39,8 +39,9 @@ var (
 // APIClient manages communication with the Weather API API v1.0.2
 // In most cases there should be only one, shared, APIClient.
 type APIClient struct {
-	cfg    *Configuration
-	common service // Reuse a single struct instead of allocating one for each service on the heap.
+	cfg     *Configuration
+	breaker *circuitBreaker
+	common  service // Reuse a single struct instead of allocating one for each service on the heap.
 
 	// API Services
 
@@ -60,6 +61,7 @@ func NewAPIClient(cfg *Configuration) *APIClient {
 
 	c := &APIClient{}
 	c.cfg = cfg
+	c.breaker = newCircuitBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown)
 	c.common.client = c
 
 	// API Services
@@ -142,9 +144,10 @@ func parameterToString(obj interface{}, collectionFormat string) string {
 	return fmt.Sprintf("%v", obj)
 }
 
-// callAPI do the request.
+// callAPI do the request, going through the response cache if one is configured
+// and retrying failed attempts (see do).
 func (c *APIClient) callAPI(request *http.Request) (*http.Response, error) {
-	return c.cfg.HTTPClient.Do(request)
+	return c.cachedCall(request, c.do)
 }
 
 // Change base path to allow switching to mocks
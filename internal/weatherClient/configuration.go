@@ -10,6 +10,7 @@ package swagger
 
 import (
 	"net/http"
+	"time"
 )
 
 // contextKeys are used to identify the type of value in the context.
@@ -55,6 +56,25 @@ type Configuration struct {
 	DefaultHeader map[string]string `json:"defaultHeader,omitempty"`
 	UserAgent     string            `json:"userAgent,omitempty"`
 	HTTPClient    *http.Client
+
+	// Cache, when set, stores GET responses of the endpoints in CacheTTL. The
+	// TTL is taken from the response's Cache-Control/Expires headers, falling
+	// back to the endpoint's CacheTTL entry.
+	Cache    ResponseCache
+	CacheTTL map[string]time.Duration
+
+	// Timeout bounds each attempt. Failed GETs (network errors, 429, 5xx) are
+	// retried up to MaxRetries times with jittered exponential backoff between
+	// RetryBaseDelay and RetryMaxDelay.
+	Timeout        time.Duration
+	MaxRetries     int
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+
+	// After BreakerThreshold consecutive failures calls fail fast with
+	// ErrCircuitOpen for BreakerCooldown. Zero disables the breaker.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
 }
 
 func NewConfiguration() *Configuration {
@@ -62,6 +82,18 @@ func NewConfiguration() *Configuration {
 		BasePath:      "https://api.weatherapi.com/v1",
 		DefaultHeader: make(map[string]string),
 		UserAgent:     "Swagger-Codegen/1.0.0/go",
+		CacheTTL:      make(map[string]time.Duration, len(DefaultCacheTTL)),
+
+		Timeout:        10 * time.Second,
+		MaxRetries:     2,
+		RetryBaseDelay: 500 * time.Millisecond,
+		RetryMaxDelay:  10 * time.Second,
+
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
+	}
+	for endpoint, ttl := range DefaultCacheTTL {
+		cfg.CacheTTL[endpoint] = ttl
 	}
 	return cfg
 }
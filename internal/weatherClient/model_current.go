@@ -29,7 +29,7 @@ type Current struct {
 	FeelslikeF float64 `json:"feelslike_f,omitempty"`
 	VisKm float64 `json:"vis_km,omitempty"`
 	VisMiles float64 `json:"vis_miles,omitempty"`
-	Uv int32 `json:"uv,omitempty"`
+	Uv float64 `json:"uv,omitempty"`
 	GustMph float64 `json:"gust_mph,omitempty"`
 	GustKph float64 `json:"gust_kph,omitempty"`
 	AirQuality *CurrentAirQuality `json:"air_quality,omitempty"`
@@ -7,6 +7,9 @@
  * Generated by: Swagger Codegen (https://github.com/swagger-api/swagger-codegen.git)
  */
 package swagger
+import (
+	"encoding/json"
+)
 
 type ForecastAstro struct {
 	Sunrise string `json:"sunrise,omitempty"`
@@ -14,5 +17,5 @@ type ForecastAstro struct {
 	Moonrise string `json:"moonrise,omitempty"`
 	Moonset string `json:"moonset,omitempty"`
 	MoonPhase string `json:"moon_phase,omitempty"`
-	MoonIllumination string `json:"moon_illumination,omitempty"`
+	MoonIllumination json.Number `json:"moon_illumination,omitempty"`
 }
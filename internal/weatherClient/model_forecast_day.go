@@ -27,5 +27,7 @@ type ForecastDay struct {
 	DailyWillItSnow int32 `json:"daily_will_it_snow,omitempty"`
 	DailyChanceOfSnow float64 `json:"daily_chance_of_snow,omitempty"`
 	Condition *ForecastDayCondition `json:"condition,omitempty"`
-	Uv int32 `json:"uv,omitempty"`
+	Uv float64 `json:"uv,omitempty"`
+	// Tides is only returned by the marine API, for plans with tide data.
+	Tides []MarineTides `json:"tides,omitempty"`
 }
@@ -41,5 +41,5 @@ type ForecastHour struct {
 	VisMiles float64 `json:"vis_miles,omitempty"`
 	GustMph float64 `json:"gust_mph,omitempty"`
 	GustKph float64 `json:"gust_kph,omitempty"`
-	Uv int32 `json:"uv,omitempty"`
+	Uv float64 `json:"uv,omitempty"`
 }
@@ -15,7 +15,7 @@ type Ip struct {
 	ContinentName string `json:"continent_name,omitempty"`
 	CountryCode string `json:"country_code,omitempty"`
 	CountryName string `json:"country_name,omitempty"`
-	IsEu string `json:"is_eu,omitempty"`
+	IsEu interface{} `json:"is_eu,omitempty"`
 	GeonameId int32 `json:"geoname_id,omitempty"`
 	City string `json:"city,omitempty"`
 	Region string `json:"region,omitempty"`
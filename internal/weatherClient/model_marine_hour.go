@@ -45,7 +45,9 @@ type MarineHour struct {
 	SwellHtMt float64 `json:"swell_ht_mt,omitempty"`
 	SwellHtFt float64 `json:"swell_ht_ft,omitempty"`
 	SwellDir float64 `json:"swell_dir,omitempty"`
-	SwellDir16Point float64 `json:"swell_dir_16_point,omitempty"`
+	SwellDir16Point string `json:"swell_dir_16_point,omitempty"`
 	SwellPeriodSecs float64 `json:"swell_period_secs,omitempty"`
-	Uv int32 `json:"uv,omitempty"`
+	WaterTempC float64 `json:"water_temp_c,omitempty"`
+	WaterTempF float64 `json:"water_temp_f,omitempty"`
+	Uv float64 `json:"uv,omitempty"`
 }
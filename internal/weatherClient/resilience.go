@@ -0,0 +1,228 @@
+package swagger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"weather_subscription/internal/backoff"
+)
+
+// ErrCircuitOpen is returned without calling the API while the circuit
+// breaker is open.
+var ErrCircuitOpen = errors.New("weather API circuit breaker is open")
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// do sends the request with a timeout per attempt. Idempotent GETs that fail
+// with a network error, 429 or 5xx are retried with jittered exponential
+// backoff, waiting for Retry-After when the API sends one. Every attempt is
+// recorded by the circuit breaker.
+func (c *APIClient) do(request *http.Request) (*http.Response, error) {
+	retries := c.cfg.MaxRetries
+	if request.Method != http.MethodGet {
+		retries = 0
+	}
+
+	for attempt := 0; ; attempt++ {
+		if !c.breaker.allow() {
+			return nil, ErrCircuitOpen
+		}
+
+		response, err := c.attempt(request)
+		if request.Context().Err() != nil {
+			// The caller gave up; that says nothing about the API's health.
+			c.breaker.release()
+			return response, err
+		}
+
+		failed := err != nil || retryableStatus(response.StatusCode)
+		c.breaker.record(!failed)
+
+		if !failed || attempt >= retries {
+			return response, err
+		}
+
+		delay, ok := c.retryDelay(attempt+1, response)
+		if !ok {
+			return response, err
+		}
+
+		select {
+		case <-request.Context().Done():
+			return nil, request.Context().Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// attempt performs a single call bounded by Configuration.Timeout. The body
+// is read before the attempt's context is cancelled, so the caller gets a
+// complete response.
+func (c *APIClient) attempt(request *http.Request) (*http.Response, error) {
+	ctx, cancel := request.Context(), context.CancelFunc(func() {})
+	if c.cfg.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(request.Context(), c.cfg.Timeout)
+	}
+	defer cancel()
+
+	response, err := c.cfg.HTTPClient.Do(request.Clone(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = io.NopCloser(bytes.NewReader(body))
+
+	return response, nil
+}
+
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// retryDelay honors Retry-After and otherwise backs off exponentially with
+// full jitter. A Retry-After beyond RetryMaxDelay is not worth waiting for.
+func (c *APIClient) retryDelay(attempt int, response *http.Response) (time.Duration, bool) {
+	if response != nil {
+		if delay, ok := retryAfter(response.Header.Get("Retry-After")); ok {
+			return delay, delay <= c.cfg.RetryMaxDelay
+		}
+	}
+
+	delay := backoff.Exponential(attempt, c.cfg.RetryBaseDelay, c.cfg.RetryMaxDelay)
+	if delay <= 0 {
+		return 0, true
+	}
+
+	return time.Duration(rand.Int63n(int64(delay)) + 1), true
+}
+
+// retryAfter parses Retry-After given either in seconds or as an HTTP date.
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		delay := time.Until(at)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+
+	return 0, false
+}
+
+// BreakerState reports whether calls to the API currently go through.
+func (c *APIClient) BreakerState() BreakerState {
+	return c.breaker.currentState()
+}
+
+// circuitBreaker opens after threshold consecutive failures and fails calls
+// fast for cooldown. It then lets a single trial call through (half-open):
+// success closes it again, failure reopens it.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	trial     bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     BreakerClosed,
+	}
+}
+
+func (b *circuitBreaker) allow() bool {
+	if b.threshold <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.trial = true
+		return true
+	case BreakerHalfOpen:
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *circuitBreaker) record(success bool) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if success {
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// release ends a half-open trial call without recording an outcome.
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+}
+
+func (b *circuitBreaker) currentState() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.cooldown {
+		return BreakerHalfOpen
+	}
+
+	return b.state
+}
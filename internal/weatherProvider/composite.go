@@ -0,0 +1,333 @@
+package weatherprovider
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSourceTimeout = 5 * time.Second
+	// consensusMaxDistanceKm is how far a source's location may be from the
+	// primary's and still be taken for the same place. Sources place a city
+	// a few kilometres apart; anything further is a different place with
+	// the same name.
+	consensusMaxDistanceKm = 25
+)
+
+// Exposed on /debug/vars, keyed by source name. A failover is a request
+// served by a source other than the first one.
+var (
+	sourceServed    = expvar.NewMap("weather_provider_served")
+	sourceErrors    = expvar.NewMap("weather_provider_errors")
+	sourceFailovers = expvar.NewInt("weather_provider_failovers")
+	sourceConsensus = expvar.NewInt("weather_provider_consensus_merges")
+)
+
+// Composite combines several sources. By default it asks them in order and
+// returns the first answer, so a failing or slow source falls back to the
+// next one. With a consensus threshold it asks all sources at once and, when
+// their current temperatures differ by more than the threshold, reports the
+// median instead of trusting a single source.
+type Composite struct {
+	providers          []WeatherProvider
+	sourceTimeout      time.Duration
+	consensusThreshold float64
+}
+
+func NewComposite(providers []WeatherProvider, sourceTimeout time.Duration, consensusThreshold float64) *Composite {
+	if sourceTimeout <= 0 {
+		sourceTimeout = defaultSourceTimeout
+	}
+
+	return &Composite{
+		providers:          providers,
+		sourceTimeout:      sourceTimeout,
+		consensusThreshold: consensusThreshold,
+	}
+}
+
+func (c *Composite) Name() string {
+	return "composite"
+}
+
+// Status reports the sources in order along with their own status.
+func (c *Composite) Status() map[string]any {
+	sources := make([]map[string]any, 0, len(c.providers))
+	for _, provider := range c.providers {
+		status := map[string]any{"name": provider.Name()}
+		if reporter, ok := provider.(StatusReporter); ok {
+			for key, value := range reporter.Status() {
+				status[key] = value
+			}
+		}
+		sources = append(sources, status)
+	}
+
+	return map[string]any{"sources": sources}
+}
+
+func (c *Composite) Locate(ctx context.Context, query string) (*Location, error) {
+	var location *Location
+	err := c.failover(ctx, func(ctx context.Context, provider WeatherProvider) error {
+		var err error
+		location, err = provider.Locate(ctx, query)
+		return err
+	})
+
+	return location, err
+}
+
+func (c *Composite) Search(ctx context.Context, query string) ([]Location, error) {
+	var locations []Location
+	err := c.failover(ctx, func(ctx context.Context, provider WeatherProvider) error {
+		var err error
+		locations, err = provider.Search(ctx, query)
+		return err
+	})
+
+	return locations, err
+}
+
+func (c *Composite) Fetch(ctx context.Context, query Query) (*Report, error) {
+	if c.consensusThreshold > 0 && len(c.providers) > 1 {
+		return c.consensus(ctx, query)
+	}
+
+	var report *Report
+	err := c.failover(ctx, func(ctx context.Context, provider WeatherProvider) error {
+		var err error
+		report, err = provider.Fetch(ctx, query)
+		return err
+	})
+
+	return report, err
+}
+
+// Marine asks the sources with marine forecasts in order.
+func (c *Composite) Marine(ctx context.Context, query Query) (*MarineReport, error) {
+	var report *MarineReport
+	err := c.failover(ctx, func(ctx context.Context, provider WeatherProvider) error {
+		marine, ok := provider.(MarineProvider)
+		if !ok {
+			return errUnsupported
+		}
+
+		var err error
+		report, err = marine.Marine(ctx, query)
+		return err
+	})
+
+	return report, err
+}
+
+// History asks the sources with past weather in order.
+func (c *Composite) History(ctx context.Context, location string, from, to time.Time) (*History, error) {
+	var history *History
+	err := c.failover(ctx, func(ctx context.Context, provider WeatherProvider) error {
+		historyProvider, ok := provider.(HistoryProvider)
+		if !ok {
+			return errUnsupported
+		}
+
+		var err error
+		history, err = historyProvider.History(ctx, location, from, to)
+		return err
+	})
+
+	return history, err
+}
+
+// LocateIP asks the sources that can geolocate IP addresses, in order.
+func (c *Composite) LocateIP(ctx context.Context, ip string) (*Location, error) {
+	var location *Location
+	err := c.failover(ctx, func(ctx context.Context, provider WeatherProvider) error {
+		locator, ok := provider.(IPLocator)
+		if !ok {
+			return errUnsupported
+		}
+
+		var err error
+		location, err = locator.LocateIP(ctx, ip)
+		return err
+	})
+
+	return location, err
+}
+
+// errUnsupported skips a source that lacks the requested data.
+var errUnsupported = errors.New("not supported by source")
+
+// failover calls each source in turn, each bounded by sourceTimeout, until
+// one succeeds. It stops early if the caller's context is done.
+func (c *Composite) failover(ctx context.Context, call func(context.Context, WeatherProvider) error) error {
+	var errs []error
+	for _, provider := range c.providers {
+		sourceCtx, cancel := context.WithTimeout(ctx, c.sourceTimeout)
+		err := call(sourceCtx, provider)
+		cancel()
+
+		if errors.Is(err, errUnsupported) {
+			continue
+		}
+		if err == nil {
+			sourceServed.Add(provider.Name(), 1)
+			if len(errs) > 0 {
+				sourceFailovers.Add(1)
+			}
+			return nil
+		}
+
+		sourceErrors.Add(provider.Name(), 1)
+		log.Printf("Weather source %s failed: %v", provider.Name(), err)
+		errs = append(errs, err)
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return firstError(errs)
+}
+
+// consensus fetches from every source concurrently. The first source in
+// order that answered provides the report; answers for a location further
+// than consensusMaxDistanceKm from it are dropped. If the rest disagree by
+// more than consensusThreshold °C, its current temperature is replaced by the
+// median and Sources lists every source used.
+func (c *Composite) consensus(ctx context.Context, query Query) (*Report, error) {
+	reports := make([]*Report, len(c.providers))
+	errs := make([]error, len(c.providers))
+
+	var wg sync.WaitGroup
+	for i, provider := range c.providers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			sourceCtx, cancel := context.WithTimeout(ctx, c.sourceTimeout)
+			defer cancel()
+
+			reports[i], errs[i] = provider.Fetch(sourceCtx, query)
+			if errs[i] != nil {
+				sourceErrors.Add(provider.Name(), 1)
+				log.Printf("Weather source %s failed: %v", provider.Name(), errs[i])
+			}
+		}()
+	}
+	wg.Wait()
+
+	var answered []*Report
+	for i, report := range reports {
+		if errs[i] != nil || report.Current == nil {
+			continue
+		}
+		if len(answered) > 0 && !samePlace(answered[0].Location, report.Location) {
+			log.Printf("Weather source %s located %q at %.2f,%.2f, too far from %.2f,%.2f; leaving it out",
+				report.Source, query.Location, report.Location.Lat, report.Location.Lon,
+				answered[0].Location.Lat, answered[0].Location.Lon)
+			continue
+		}
+		answered = append(answered, report)
+	}
+	if len(answered) == 0 {
+		return nil, firstError(errs)
+	}
+
+	primary := answered[0]
+	if primary != reports[0] {
+		sourceFailovers.Add(1)
+	}
+
+	temperatures := make([]float64, len(answered))
+	for i, report := range answered {
+		temperatures[i] = report.Current.TemperatureC
+	}
+	sort.Float64s(temperatures)
+
+	if temperatures[len(temperatures)-1]-temperatures[0] <= c.consensusThreshold {
+		sourceServed.Add(primary.Source, 1)
+		return primary, nil
+	}
+
+	merged := *primary
+	current := *primary.Current
+	current.TemperatureC = median(temperatures)
+	merged.Current = &current
+	merged.Source = c.Name()
+	for _, report := range answered {
+		merged.Sources = append(merged.Sources, report.Source)
+		sourceServed.Add(report.Source, 1)
+	}
+	sourceConsensus.Add(1)
+
+	return &merged, nil
+}
+
+// samePlace reports whether two locations are within consensusMaxDistanceKm
+// of each other. A location without coordinates is given the benefit of the
+// doubt.
+func samePlace(a, b Location) bool {
+	if (a.Lat == 0 && a.Lon == 0) || (b.Lat == 0 && b.Lon == 0) {
+		return true
+	}
+
+	return distanceKm(a, b) <= consensusMaxDistanceKm
+}
+
+// distanceKm is the great-circle distance between two locations.
+func distanceKm(a, b Location) float64 {
+	const earthRadiusKm = 6371
+
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Lon - a.Lon) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+func median(sorted []float64) float64 {
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[middle]
+	}
+
+	return (sorted[middle-1] + sorted[middle]) / 2
+}
+
+// firstError prefers ErrLocationNotFound and ErrNotCoastal, so a location
+// every source rejected is not reported as an outage, and otherwise joins
+// the causes.
+func firstError(errs []error) error {
+	var failed []error
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	if len(failed) == 0 {
+		return fmt.Errorf("%w: no weather source returned data", ErrUnavailable)
+	}
+
+	messages := make([]string, 0, len(failed))
+	notFound := 0
+	for _, err := range failed {
+		if errors.Is(err, ErrLocationNotFound) || errors.Is(err, ErrNotCoastal) {
+			notFound++
+		}
+		messages = append(messages, err.Error())
+	}
+	if notFound == len(failed) {
+		return failed[0]
+	}
+
+	return fmt.Errorf("%w: all sources failed: %s", ErrUnavailable, strings.Join(messages, "; "))
+}
@@ -0,0 +1,60 @@
+package weatherprovider
+
+// Condition classifies the weather independently of the language of the
+// description, e.g. to pick an icon for it.
+type Condition string
+
+const (
+	ConditionClear        Condition = "clear"
+	ConditionPartlyCloudy Condition = "partly_cloudy"
+	ConditionCloudy       Condition = "cloudy"
+	ConditionFog          Condition = "fog"
+	ConditionRain         Condition = "rain"
+	ConditionSnow         Condition = "snow"
+	ConditionStorm        Condition = "storm"
+)
+
+// wmoCondition classifies a WMO weather code, as returned by Open-Meteo.
+func wmoCondition(code int) Condition {
+	switch {
+	case code == 0:
+		return ConditionClear
+	case code == 1 || code == 2:
+		return ConditionPartlyCloudy
+	case code == 3:
+		return ConditionCloudy
+	case code == 45 || code == 48:
+		return ConditionFog
+	case code >= 51 && code <= 67, code >= 80 && code <= 82:
+		return ConditionRain
+	case code >= 71 && code <= 77, code == 85 || code == 86:
+		return ConditionSnow
+	case code >= 95 && code <= 99:
+		return ConditionStorm
+	}
+
+	return ""
+}
+
+// weatherAPICondition classifies a WeatherAPI condition code
+// (https://www.weatherapi.com/docs/weather_conditions.json).
+func weatherAPICondition(code int32) Condition {
+	switch code {
+	case 1000:
+		return ConditionClear
+	case 1003:
+		return ConditionPartlyCloudy
+	case 1006, 1009:
+		return ConditionCloudy
+	case 1030, 1135, 1147:
+		return ConditionFog
+	case 1063, 1072, 1150, 1153, 1168, 1171, 1180, 1183, 1186, 1189, 1192, 1195, 1198, 1201, 1240, 1243, 1246:
+		return ConditionRain
+	case 1066, 1069, 1114, 1117, 1204, 1207, 1210, 1213, 1216, 1219, 1222, 1225, 1237, 1249, 1252, 1255, 1258, 1261, 1264:
+		return ConditionSnow
+	case 1087, 1273, 1276, 1279, 1282:
+		return ConditionStorm
+	}
+
+	return ""
+}
@@ -0,0 +1,216 @@
+package weatherprovider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Fixtures serves reports stored as JSON files, for offline development and
+// tests. The report for "New York" is read from <dir>/new-york.json and uses
+// the Report JSON shape; Fetch trims the hourly and daily series to the
+// requested number of days. Marine reports are read from
+// <dir>/new-york-marine.json and past weather from <dir>/new-york-history.json. A "lat,lon" query is served by the fixture whose
+// location lies within coordinateTolerance degrees.
+type Fixtures struct {
+	dir string
+}
+
+func NewFixtures(dir string) *Fixtures {
+	return &Fixtures{dir: dir}
+}
+
+func (p *Fixtures) Name() string {
+	return "fixtures"
+}
+
+func (p *Fixtures) Locate(_ context.Context, query string) (*Location, error) {
+	report, err := p.load(p.resolve(query))
+	if err != nil {
+		return nil, err
+	}
+
+	return &report.Location, nil
+}
+
+func (p *Fixtures) Fetch(_ context.Context, query Query) (*Report, error) {
+	report, err := p.load(p.resolve(query.Location))
+	if err != nil {
+		return nil, err
+	}
+
+	if query.Days <= 0 {
+		report.Hourly, report.Daily = nil, nil
+	} else if len(report.Daily) > query.Days {
+		cutoff := report.Daily[query.Days].Date
+		report.Daily = report.Daily[:query.Days]
+
+		hourly := report.Hourly[:0]
+		for _, hour := range report.Hourly {
+			if hour.Time.Before(cutoff) {
+				hourly = append(hourly, hour)
+			}
+		}
+		report.Hourly = hourly
+	}
+	if !query.Alerts {
+		report.Alerts = nil
+	}
+	if !query.AirQuality {
+		report.AirQuality = nil
+	}
+
+	report.Source = p.Name()
+	return report, nil
+}
+
+// Marine reads the MarineReport stored in <dir>/<slug>-marine.json. A
+// location with a weather fixture but no marine one is not coastal.
+func (p *Fixtures) Marine(_ context.Context, query Query) (*MarineReport, error) {
+	name := p.resolve(query.Location)
+
+	var report MarineReport
+	err := p.read(name, "-marine", &report)
+	if errors.Is(err, ErrLocationNotFound) {
+		if _, weatherErr := p.load(name); weatherErr == nil {
+			return nil, fmt.Errorf("%w: %q", ErrNotCoastal, query.Location)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if days := max(query.Days, 1); len(report.Days) > days {
+		report.Days = report.Days[:days]
+	}
+
+	report.Source = p.Name()
+	return &report, nil
+}
+
+// History reads the days stored in <dir>/<slug>-history.json, in the History
+// JSON shape, that fall between from and to.
+func (p *Fixtures) History(_ context.Context, location string, from, to time.Time) (*History, error) {
+	var history History
+	if err := p.read(p.resolve(location), "-history", &history); err != nil {
+		return nil, err
+	}
+
+	days := history.Days[:0]
+	for _, day := range history.Days {
+		if historyDate(day.Date) >= historyDate(from) && historyDate(day.Date) <= historyDate(to) {
+			days = append(days, day)
+		}
+	}
+	history.Days = days
+
+	history.Source = p.Name()
+	return &history, nil
+}
+
+// Search matches the query against the start of the fixture location names.
+func (p *Fixtures) Search(_ context.Context, query string) ([]Location, error) {
+	prefix := LocationKey(query)
+	if prefix == "" {
+		return nil, nil
+	}
+
+	reports, err := p.all()
+	if err != nil {
+		return nil, err
+	}
+
+	var locations []Location
+	for _, report := range reports {
+		if strings.HasPrefix(LocationKey(report.Location.Name), prefix) {
+			locations = append(locations, report.Location)
+		}
+	}
+
+	return locations, nil
+}
+
+const coordinateTolerance = 0.1
+
+// all reads every weather fixture.
+func (p *Fixtures) all() ([]*Report, error) {
+	paths, err := filepath.Glob(filepath.Join(p.dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: fixtures: %v", ErrUnavailable, err)
+	}
+
+	var reports []*Report
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		if strings.HasSuffix(name, "-marine") || strings.HasSuffix(name, "-history") {
+			continue
+		}
+
+		report, err := p.load(name)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+// resolve turns a "lat,lon" query into the name of the fixture at those
+// coordinates; other queries are fixture names already.
+func (p *Fixtures) resolve(query string) string {
+	lat, lon, ok := parseCoordinates(query)
+	if !ok {
+		return query
+	}
+
+	reports, err := p.all()
+	if err != nil {
+		return query
+	}
+	for _, report := range reports {
+		if math.Abs(report.Location.Lat-lat) <= coordinateTolerance && math.Abs(report.Location.Lon-lon) <= coordinateTolerance {
+			return report.Location.Name
+		}
+	}
+
+	return query
+}
+
+func (p *Fixtures) load(query string) (*Report, error) {
+	var report Report
+	if err := p.read(query, "", &report); err != nil {
+		return nil, err
+	}
+
+	return &report, nil
+}
+
+func (p *Fixtures) read(query, suffix string, v any) error {
+	name := strings.ReplaceAll(LocationKey(query), " ", "-")
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("%w: %q", ErrLocationNotFound, query)
+	}
+	name += suffix
+
+	data, err := os.ReadFile(filepath.Join(p.dir, name+".json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: no fixture for %q", ErrLocationNotFound, query)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: fixtures: %v", ErrUnavailable, err)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: fixtures: invalid %s.json: %v", ErrUnavailable, name, err)
+	}
+
+	return nil
+}
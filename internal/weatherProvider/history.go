@@ -0,0 +1,89 @@
+package weatherprovider
+
+import (
+	"context"
+	"log"
+	"math"
+	"time"
+)
+
+// HistoryProvider is implemented by sources with past weather.
+type HistoryProvider interface {
+	// History returns the observed daily weather from one date to another,
+	// both inclusive and given as dates in the location's timezone.
+	History(ctx context.Context, location string, from, to time.Time) (*History, error)
+}
+
+// MaxHistoryDays bounds a single History request.
+const MaxHistoryDays = 30
+
+// historyWeekDays is the length of the rolling history compared with today.
+const historyWeekDays = 7
+
+// History holds past daily weather, oldest first. Sunrise, sunset, the moon
+// and chances of precipitation are not part of it.
+type History struct {
+	Location Location `json:"location"`
+	Days     []Day    `json:"days"`
+	Source   string   `json:"source"`
+}
+
+// Comparison puts today's forecast next to the same date last year and the
+// past week. Deltas are in °C of average temperature and nil when the
+// history for them is missing.
+type Comparison struct {
+	Today    Day   `json:"today"`
+	LastYear *Day  `json:"last_year,omitempty"`
+	Week     []Day `json:"week"`
+
+	LastYearDelta *float64 `json:"last_year_delta_c,omitempty"`
+	WeekDelta     *float64 `json:"week_delta_c,omitempty"`
+	WeekAvgTempC  *float64 `json:"week_avg_temp_c,omitempty"`
+}
+
+// Compare fetches the same date last year and the seven days before today
+// and compares them with today's forecast. The last year comparison is best
+// effort: sources reject dates beyond their archive, which must not fail the
+// comparison with the past week.
+func Compare(ctx context.Context, provider HistoryProvider, location string, today Day) (*Comparison, error) {
+	comparison := &Comparison{Today: today}
+
+	lastYearDate := today.Date.AddDate(-1, 0, 0)
+	lastYear, err := provider.History(ctx, location, lastYearDate, lastYearDate)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		log.Printf("Skipping last year's weather for %s: %v", location, err)
+	} else if len(lastYear.Days) > 0 {
+		comparison.LastYear = &lastYear.Days[0]
+		delta := roundTenth(today.AvgTempC - lastYear.Days[0].AvgTempC)
+		comparison.LastYearDelta = &delta
+	}
+
+	week, err := provider.History(ctx, location, today.Date.AddDate(0, 0, -historyWeekDays), today.Date.AddDate(0, 0, -1))
+	if err != nil {
+		return nil, err
+	}
+	comparison.Week = week.Days
+	if len(week.Days) > 0 {
+		total := 0.0
+		for _, day := range week.Days {
+			total += day.AvgTempC
+		}
+		average := roundTenth(total / float64(len(week.Days)))
+		delta := roundTenth(today.AvgTempC - average)
+		comparison.WeekAvgTempC, comparison.WeekDelta = &average, &delta
+	}
+
+	return comparison, nil
+}
+
+func roundTenth(value float64) float64 {
+	return math.Round(value*10) / 10
+}
+
+// historyDate formats a History bound for the APIs.
+func historyDate(date time.Time) string {
+	return date.Format("2006-01-02")
+}
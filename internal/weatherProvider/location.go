@@ -0,0 +1,115 @@
+package weatherprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// IPLocator is implemented by sources that geolocate IP addresses.
+type IPLocator interface {
+	// LocateIP returns the location of a public IP address, or
+	// ErrLocationNotFound if it cannot be placed.
+	LocateIP(ctx context.Context, ip string) (*Location, error)
+}
+
+// ErrAmbiguousLocation means a location query matches several places.
+var ErrAmbiguousLocation = errors.New("ambiguous location")
+
+// AmbiguousLocationError lists the places a query could mean.
+type AmbiguousLocationError struct {
+	Query      string
+	Candidates []Location
+}
+
+func (e *AmbiguousLocationError) Error() string {
+	return fmt.Sprintf("%q matches %d locations", e.Query, len(e.Candidates))
+}
+
+func (e *AmbiguousLocationError) Unwrap() error {
+	return ErrAmbiguousLocation
+}
+
+// Resolve turns free-text input into one canonical location with a
+// timezone. The input resolves when it names exactly one search result (by
+// name, optionally followed by region and country) or when the search finds
+// a single place; otherwise an AmbiguousLocationError lists the candidates.
+// A non-zero id picks the search result with that ID, as offered by
+// autocomplete.
+func Resolve(ctx context.Context, provider WeatherProvider, query string, id int64) (*Location, error) {
+	results, err := provider.Search(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var location *Location
+	if id != 0 {
+		for i := range results {
+			if results[i].ID == id {
+				location = &results[i]
+				break
+			}
+		}
+	} else {
+		var named []Location
+		for _, result := range results {
+			if result.Names(query) {
+				named = append(named, result)
+			}
+		}
+
+		switch {
+		case len(named) == 1:
+			location = &named[0]
+		case len(results) == 1:
+			location = &results[0]
+		case len(named) > 1:
+			return nil, &AmbiguousLocationError{Query: query, Candidates: named}
+		case len(results) > 1:
+			return nil, &AmbiguousLocationError{Query: query, Candidates: results}
+		}
+	}
+	if location == nil {
+		return nil, fmt.Errorf("%w: %q", ErrLocationNotFound, query)
+	}
+
+	if location.Timezone == "" {
+		located, err := provider.Locate(ctx, location.Query())
+		if err != nil {
+			return nil, err
+		}
+		location.Timezone = located.Timezone
+	}
+
+	return location, nil
+}
+
+// Names reports whether the query spells out the location: its name alone or
+// followed by its region and/or country, separated by commas.
+func (l Location) Names(query string) bool {
+	parts := strings.Split(query, ",")
+	if LocationKey(parts[0]) != LocationKey(l.Name) {
+		return false
+	}
+
+	qualifiers := []string{LocationKey(l.Region), LocationKey(l.Country)}
+	for _, part := range parts[1:] {
+		key := LocationKey(part)
+		for len(qualifiers) > 0 && qualifiers[0] != key {
+			qualifiers = qualifiers[1:]
+		}
+		if len(qualifiers) == 0 {
+			return false
+		}
+		qualifiers = qualifiers[1:]
+	}
+
+	return true
+}
+
+// Query is the "lat,lon" query for the location's coordinates, which every
+// source answers for the same place.
+func (l Location) Query() string {
+	return formatCoordinate(l.Lat) + "," + formatCoordinate(l.Lon)
+}
@@ -0,0 +1,87 @@
+package weatherprovider
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotCoastal means the location has no sea or ocean forecast.
+var ErrNotCoastal = errors.New("location is not coastal")
+
+// MarineProvider is implemented by sources with sea and surf forecasts.
+type MarineProvider interface {
+	// Marine returns the marine forecast for query.Days days (at least one)
+	// starting today, or ErrNotCoastal for an inland location.
+	Marine(ctx context.Context, query Query) (*MarineReport, error)
+}
+
+type MarineReport struct {
+	Location Location    `json:"location"`
+	Days     []MarineDay `json:"days"`
+	Source   string      `json:"source"`
+}
+
+type MarineDay struct {
+	// Date is midnight of the day in the location's timezone.
+	Date    time.Time `json:"date"`
+	Sunrise string    `json:"sunrise,omitempty"`
+	Sunset  string    `json:"sunset,omitempty"`
+	// Tides are only available from some sources and plans.
+	Tides []Tide       `json:"tides,omitempty"`
+	Hours []MarineHour `json:"hours"`
+}
+
+type Tide struct {
+	Time    time.Time `json:"time"`
+	HeightM float64   `json:"height_m"`
+	Type    string    `json:"type"` // HIGH or LOW
+}
+
+// MarineHour holds wave heights in m, swell directions in degrees (where
+// the swell comes from) and periods in s.
+type MarineHour struct {
+	Time           time.Time `json:"time"`
+	WaveHeightM    float64   `json:"wave_height_m"`
+	SwellHeightM   float64   `json:"swell_height_m"`
+	SwellDirection float64   `json:"swell_direction"`
+	SwellCompass   string    `json:"swell_compass"`
+	SwellPeriodS   float64   `json:"swell_period_s"`
+	WindKph        float64   `json:"wind_kph,omitempty"`
+	WindCompass    string    `json:"wind_compass,omitempty"`
+	GustKph        float64   `json:"gust_kph,omitempty"`
+	TemperatureC   float64   `json:"temperature_c,omitempty"`
+	WaterTempC     float64   `json:"water_temp_c,omitempty"`
+	Description    string    `json:"description,omitempty"`
+}
+
+// MarineAttribution names the source of the marine report for display.
+func MarineAttribution(report *MarineReport) string {
+	return sourceName(report.Source)
+}
+
+// hasWaves reports whether any hour carries wave data; sources answer
+// inland locations with empty series rather than an error.
+func (r *MarineReport) hasWaves() bool {
+	for _, day := range r.Days {
+		for _, hour := range day.Hours {
+			if hour.WaveHeightM > 0 || hour.SwellHeightM > 0 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+var compassPoints = []string{"N", "NNE", "NE", "ENE", "E", "ESE", "SE", "SSE", "S", "SSW", "SW", "WSW", "W", "WNW", "NW", "NNW"}
+
+// compass turns degrees into a 16-point compass direction.
+func compass(degrees float64) string {
+	index := int((degrees+11.25)/22.5) % len(compassPoints)
+	if index < 0 {
+		index += len(compassPoints)
+	}
+
+	return compassPoints[index]
+}
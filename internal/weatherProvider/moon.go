@@ -0,0 +1,30 @@
+package weatherprovider
+
+import (
+	"math"
+	"time"
+)
+
+const synodicMonth = 29.530588853 // days
+
+// knownNewMoon is the new moon of 6 January 2000, 18:14 UTC.
+var knownNewMoon = time.Date(2000, time.January, 6, 18, 14, 0, 0, time.UTC)
+
+var moonPhases = []string{"New Moon", "Waxing Crescent", "First Quarter", "Waxing Gibbous", "Full Moon", "Waning Gibbous", "Last Quarter", "Waning Crescent"}
+
+// moonPhase returns the phase name, as WeatherAPI spells it, and the
+// illuminated percentage of the moon on the given day. It uses the mean
+// synodic month, which is accurate to within a day.
+func moonPhase(date time.Time) (string, int) {
+	noon := date.Add(12 * time.Hour)
+	age := math.Mod(noon.Sub(knownNewMoon).Hours()/24, synodicMonth)
+	if age < 0 {
+		age += synodicMonth
+	}
+
+	fraction := age / synodicMonth
+	phase := moonPhases[int(fraction*float64(len(moonPhases))+0.5)%len(moonPhases)]
+	illumination := (1 - math.Cos(2*math.Pi*fraction)) / 2
+
+	return phase, int(math.Round(illumination * 100))
+}
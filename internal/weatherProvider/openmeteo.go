@@ -0,0 +1,637 @@
+package weatherprovider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultOpenMeteoURL           = "https://api.open-meteo.com/v1"
+	DefaultOpenMeteoGeocodingURL  = "https://geocoding-api.open-meteo.com/v1"
+	DefaultOpenMeteoAirQualityURL = "https://air-quality-api.open-meteo.com/v1"
+	DefaultOpenMeteoMarineURL     = "https://marine-api.open-meteo.com/v1"
+	DefaultOpenMeteoArchiveURL    = "https://archive-api.open-meteo.com/v1"
+	defaultOpenMeteoTimeout       = 10 * time.Second
+)
+
+// OpenMeteo serves weather from an Open-Meteo compatible API (the public
+// service or a self-hosted instance). City names are resolved through its
+// geocoding API; "lat,lon" queries are used as is. Air quality, marine
+// forecasts and history come from its separate air quality, marine and
+// archive APIs.
+type OpenMeteo struct {
+	baseURL       string
+	geocodingURL  string
+	airQualityURL string
+	marineURL     string
+	archiveURL    string
+	httpClient    *http.Client
+
+	// locations caches geocoding results, which do not change.
+	locations sync.Map
+}
+
+func NewOpenMeteo(baseURL, geocodingURL, airQualityURL, marineURL, archiveURL string, timeout time.Duration) *OpenMeteo {
+	if baseURL == "" {
+		baseURL = DefaultOpenMeteoURL
+	}
+	if geocodingURL == "" {
+		geocodingURL = DefaultOpenMeteoGeocodingURL
+	}
+	if airQualityURL == "" {
+		airQualityURL = DefaultOpenMeteoAirQualityURL
+	}
+	if marineURL == "" {
+		marineURL = DefaultOpenMeteoMarineURL
+	}
+	if archiveURL == "" {
+		archiveURL = DefaultOpenMeteoArchiveURL
+	}
+	if timeout <= 0 {
+		timeout = defaultOpenMeteoTimeout
+	}
+
+	return &OpenMeteo{
+		baseURL:       strings.TrimRight(baseURL, "/"),
+		geocodingURL:  strings.TrimRight(geocodingURL, "/"),
+		airQualityURL: strings.TrimRight(airQualityURL, "/"),
+		marineURL:     strings.TrimRight(marineURL, "/"),
+		archiveURL:    strings.TrimRight(archiveURL, "/"),
+		httpClient:    &http.Client{Timeout: timeout},
+	}
+}
+
+func (p *OpenMeteo) Name() string {
+	return "openmeteo"
+}
+
+func (p *OpenMeteo) Locate(ctx context.Context, query string) (*Location, error) {
+	key := LocationKey(query)
+	if cached, ok := p.locations.Load(key); ok {
+		location := cached.(Location)
+		return &location, nil
+	}
+
+	location, err := p.locate(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	p.locations.Store(key, *location)
+	return location, nil
+}
+
+func (p *OpenMeteo) locate(ctx context.Context, query string) (*Location, error) {
+	if lat, lon, ok := parseCoordinates(query); ok {
+		// There is no reverse geocoding; the forecast endpoint resolves the timezone.
+		var response openMeteoForecast
+		params := url.Values{
+			"latitude":      {formatCoordinate(lat)},
+			"longitude":     {formatCoordinate(lon)},
+			"timezone":      {"auto"},
+			"forecast_days": {"1"},
+		}
+		if err := p.get(ctx, p.baseURL+"/forecast", params, &response); err != nil {
+			return nil, err
+		}
+
+		return &Location{
+			Name:     strings.TrimSpace(query),
+			Lat:      lat,
+			Lon:      lon,
+			Timezone: response.Timezone,
+		}, nil
+	}
+
+	locations, err := p.geocode(ctx, query, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(locations) == 0 {
+		return nil, fmt.Errorf("%w: %q", ErrLocationNotFound, query)
+	}
+
+	return &locations[0], nil
+}
+
+func (p *OpenMeteo) Search(ctx context.Context, query string) ([]Location, error) {
+	return p.geocode(ctx, query, searchResults)
+}
+
+// searchResults bounds the locations returned by Search.
+const searchResults = 10
+
+func (p *OpenMeteo) geocode(ctx context.Context, query string, count int) ([]Location, error) {
+	var response struct {
+		Results []struct {
+			ID        int64   `json:"id"`
+			Name      string  `json:"name"`
+			Admin1    string  `json:"admin1"`
+			Country   string  `json:"country"`
+			Latitude  float64 `json:"latitude"`
+			Longitude float64 `json:"longitude"`
+			Timezone  string  `json:"timezone"`
+		} `json:"results"`
+	}
+	params := url.Values{
+		"name":  {strings.TrimSpace(query)},
+		"count": {strconv.Itoa(count)},
+	}
+	if err := p.get(ctx, p.geocodingURL+"/search", params, &response); err != nil {
+		return nil, err
+	}
+
+	locations := make([]Location, 0, len(response.Results))
+	for _, result := range response.Results {
+		locations = append(locations, Location{
+			ID:       result.ID,
+			Name:     result.Name,
+			Region:   result.Admin1,
+			Country:  result.Country,
+			Lat:      result.Latitude,
+			Lon:      result.Longitude,
+			Timezone: result.Timezone,
+		})
+	}
+
+	return locations, nil
+}
+
+type openMeteoForecast struct {
+	Timezone string `json:"timezone"`
+	Current  struct {
+		Time                string  `json:"time"`
+		Temperature2m       float64 `json:"temperature_2m"`
+		ApparentTemperature float64 `json:"apparent_temperature"`
+		RelativeHumidity2m  float64 `json:"relative_humidity_2m"`
+		Precipitation       float64 `json:"precipitation"`
+		WeatherCode         int     `json:"weather_code"`
+		CloudCover          float64 `json:"cloud_cover"`
+		WindSpeed10m        float64 `json:"wind_speed_10m"`
+		WindGusts10m        float64 `json:"wind_gusts_10m"`
+		IsDay               int     `json:"is_day"`
+	} `json:"current"`
+	Hourly struct {
+		Time                     []string  `json:"time"`
+		Temperature2m            []float64 `json:"temperature_2m"`
+		ApparentTemperature      []float64 `json:"apparent_temperature"`
+		RelativeHumidity2m       []float64 `json:"relative_humidity_2m"`
+		Precipitation            []float64 `json:"precipitation"`
+		PrecipitationProbability []float64 `json:"precipitation_probability"`
+		WeatherCode              []int     `json:"weather_code"`
+		CloudCover               []float64 `json:"cloud_cover"`
+		WindSpeed10m             []float64 `json:"wind_speed_10m"`
+		WindGusts10m             []float64 `json:"wind_gusts_10m"`
+	} `json:"hourly"`
+	Daily struct {
+		Time                        []string  `json:"time"`
+		WeatherCode                 []int     `json:"weather_code"`
+		Temperature2mMax            []float64 `json:"temperature_2m_max"`
+		Temperature2mMin            []float64 `json:"temperature_2m_min"`
+		PrecipitationSum            []float64 `json:"precipitation_sum"`
+		PrecipitationProbabilityMax []float64 `json:"precipitation_probability_max"`
+		WindSpeed10mMax             []float64 `json:"wind_speed_10m_max"`
+		UVIndexMax                  []float64 `json:"uv_index_max"`
+		Sunrise                     []string  `json:"sunrise"`
+		Sunset                      []string  `json:"sunset"`
+	} `json:"daily"`
+}
+
+func (p *OpenMeteo) Fetch(ctx context.Context, query Query) (*Report, error) {
+	location, err := p.Locate(ctx, query.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{
+		"latitude":  {formatCoordinate(location.Lat)},
+		"longitude": {formatCoordinate(location.Lon)},
+		"timezone":  {"auto"},
+		"current":   {"temperature_2m,apparent_temperature,relative_humidity_2m,precipitation,weather_code,cloud_cover,wind_speed_10m,wind_gusts_10m,is_day"},
+	}
+	if query.Days > 0 {
+		params.Set("forecast_days", strconv.Itoa(query.Days))
+		params.Set("hourly", "temperature_2m,apparent_temperature,relative_humidity_2m,precipitation,precipitation_probability,weather_code,cloud_cover,wind_speed_10m,wind_gusts_10m")
+		params.Set("daily", "weather_code,temperature_2m_max,temperature_2m_min,precipitation_sum,precipitation_probability_max,wind_speed_10m_max,uv_index_max,sunrise,sunset")
+	}
+
+	var response openMeteoForecast
+	if err := p.get(ctx, p.baseURL+"/forecast", params, &response); err != nil {
+		return nil, err
+	}
+
+	loc, err := time.LoadLocation(response.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	if location.Timezone == "" {
+		location.Timezone = response.Timezone
+	}
+
+	current, _ := time.ParseInLocation(openMeteoTimeLayout, response.Current.Time, loc)
+	report := &Report{
+		Location: *location,
+		Current: &Current{
+			Time:         current,
+			TemperatureC: response.Current.Temperature2m,
+			FeelsLikeC:   response.Current.ApparentTemperature,
+			Humidity:     int(response.Current.RelativeHumidity2m),
+			WindKph:      response.Current.WindSpeed10m,
+			GustKph:      response.Current.WindGusts10m,
+			PrecipMm:     response.Current.Precipitation,
+			CloudCover:   int(response.Current.CloudCover),
+			Description:  DescribeWMOCode(response.Current.WeatherCode),
+			Condition:    wmoCondition(response.Current.WeatherCode),
+			IsDay:        response.Current.IsDay == 1,
+		},
+		Source: p.Name(),
+	}
+
+	hourly := response.Hourly
+	for i, value := range hourly.Time {
+		t, err := time.ParseInLocation(openMeteoTimeLayout, value, loc)
+		if err != nil {
+			continue
+		}
+
+		report.Hourly = append(report.Hourly, Hour{
+			Time:         t,
+			TemperatureC: at(hourly.Temperature2m, i),
+			FeelsLikeC:   at(hourly.ApparentTemperature, i),
+			Humidity:     int(at(hourly.RelativeHumidity2m, i)),
+			WindKph:      at(hourly.WindSpeed10m, i),
+			GustKph:      at(hourly.WindGusts10m, i),
+			PrecipMm:     at(hourly.Precipitation, i),
+			ChanceOfRain: int(at(hourly.PrecipitationProbability, i)),
+			CloudCover:   int(at(hourly.CloudCover, i)),
+			Description:  DescribeWMOCode(at(hourly.WeatherCode, i)),
+			Condition:    wmoCondition(at(hourly.WeatherCode, i)),
+		})
+	}
+
+	daily := response.Daily
+	for i, value := range daily.Time {
+		date, err := time.ParseInLocation("2006-01-02", value, loc)
+		if err != nil {
+			continue
+		}
+
+		day := Day{
+			Date:          date,
+			MaxTempC:      at(daily.Temperature2mMax, i),
+			MinTempC:      at(daily.Temperature2mMin, i),
+			AvgTempC:      averageTemperature(report.Hourly, date),
+			MaxWindKph:    at(daily.WindSpeed10mMax, i),
+			TotalPrecipMm: at(daily.PrecipitationSum, i),
+			ChanceOfRain:  int(at(daily.PrecipitationProbabilityMax, i)),
+			UV:            at(daily.UVIndexMax, i),
+			Description:   DescribeWMOCode(at(daily.WeatherCode, i)),
+			Condition:     wmoCondition(at(daily.WeatherCode, i)),
+			Sunrise:       clockTime(at(daily.Sunrise, i), loc),
+			Sunset:        clockTime(at(daily.Sunset, i), loc),
+		}
+		// Open-Meteo has no moon data; the phase follows from the date. It
+		// has no snow probability either, so ChanceOfSnow stays 0.
+		day.MoonPhase, day.MoonIllumination = moonPhase(date)
+		report.Daily = append(report.Daily, day)
+	}
+
+	if query.AirQuality {
+		// Best effort: the weather is still useful without air quality.
+		report.AirQuality, _ = p.airQuality(ctx, location)
+	}
+
+	return report, nil
+}
+
+func (p *OpenMeteo) airQuality(ctx context.Context, location *Location) (*AirQuality, error) {
+	var response struct {
+		Current struct {
+			PM25            float64 `json:"pm2_5"`
+			PM10            float64 `json:"pm10"`
+			Ozone           float64 `json:"ozone"`
+			NitrogenDioxide float64 `json:"nitrogen_dioxide"`
+			SulphurDioxide  float64 `json:"sulphur_dioxide"`
+			CarbonMonoxide  float64 `json:"carbon_monoxide"`
+			USAQI           float64 `json:"us_aqi"`
+		} `json:"current"`
+	}
+	params := url.Values{
+		"latitude":  {formatCoordinate(location.Lat)},
+		"longitude": {formatCoordinate(location.Lon)},
+		"current":   {"pm2_5,pm10,ozone,nitrogen_dioxide,sulphur_dioxide,carbon_monoxide,us_aqi"},
+	}
+	if err := p.get(ctx, p.airQualityURL+"/air-quality", params, &response); err != nil {
+		return nil, err
+	}
+
+	current := response.Current
+	return &AirQuality{
+		PM25:         current.PM25,
+		PM10:         current.PM10,
+		O3:           current.Ozone,
+		NO2:          current.NitrogenDioxide,
+		SO2:          current.SulphurDioxide,
+		CO:           current.CarbonMonoxide,
+		USEPAIndex:   epaCategory(current.USAQI),
+		GBDEFRAIndex: defraIndex(current.PM25),
+	}, nil
+}
+
+// History reads the reanalysis archive, which lags a few days behind;
+// days it does not cover yet are left out.
+func (p *OpenMeteo) History(ctx context.Context, query string, from, to time.Time) (*History, error) {
+	location, err := p.Locate(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{
+		"latitude":   {formatCoordinate(location.Lat)},
+		"longitude":  {formatCoordinate(location.Lon)},
+		"timezone":   {"auto"},
+		"start_date": {historyDate(from)},
+		"end_date":   {historyDate(to)},
+		"daily":      {"weather_code,temperature_2m_max,temperature_2m_min,temperature_2m_mean,precipitation_sum,snowfall_sum,wind_speed_10m_max"},
+	}
+
+	// Values are null for days not in the archive yet.
+	var response struct {
+		Timezone string `json:"timezone"`
+		Daily    struct {
+			Time             []string   `json:"time"`
+			WeatherCode      []*int     `json:"weather_code"`
+			Temperature2mMax []*float64 `json:"temperature_2m_max"`
+			Temperature2mMin []*float64 `json:"temperature_2m_min"`
+			Temperature2mAvg []*float64 `json:"temperature_2m_mean"`
+			PrecipitationSum []*float64 `json:"precipitation_sum"`
+			SnowfallSum      []*float64 `json:"snowfall_sum"`
+			WindSpeed10mMax  []*float64 `json:"wind_speed_10m_max"`
+		} `json:"daily"`
+	}
+	if err := p.get(ctx, p.archiveURL+"/archive", params, &response); err != nil {
+		return nil, err
+	}
+
+	loc, err := time.LoadLocation(response.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	history := &History{Location: *location, Source: p.Name()}
+	daily := response.Daily
+	for i, value := range daily.Time {
+		date, err := time.ParseInLocation("2006-01-02", value, loc)
+		if err != nil || at(daily.Temperature2mMax, i) == nil {
+			continue
+		}
+
+		day := Day{
+			Date:          date,
+			MaxTempC:      deref(at(daily.Temperature2mMax, i)),
+			MinTempC:      deref(at(daily.Temperature2mMin, i)),
+			AvgTempC:      deref(at(daily.Temperature2mAvg, i)),
+			MaxWindKph:    deref(at(daily.WindSpeed10mMax, i)),
+			TotalPrecipMm: deref(at(daily.PrecipitationSum, i)),
+			Description:   DescribeWMOCode(deref(at(daily.WeatherCode, i))),
+			Condition:     wmoCondition(deref(at(daily.WeatherCode, i))),
+		}
+		day.MoonPhase, day.MoonIllumination = moonPhase(date)
+		history.Days = append(history.Days, day)
+	}
+
+	return history, nil
+}
+
+// deref returns *value, or the zero value for nil.
+func deref[T any](value *T) T {
+	if value == nil {
+		var zero T
+		return zero
+	}
+
+	return *value
+}
+
+func (p *OpenMeteo) Marine(ctx context.Context, query Query) (*MarineReport, error) {
+	location, err := p.Locate(ctx, query.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Timezone string `json:"timezone"`
+		Hourly   struct {
+			Time                  []string  `json:"time"`
+			WaveHeight            []float64 `json:"wave_height"`
+			SwellWaveHeight       []float64 `json:"swell_wave_height"`
+			SwellWaveDirection    []float64 `json:"swell_wave_direction"`
+			SwellWavePeriod       []float64 `json:"swell_wave_period"`
+			SeaSurfaceTemperature []float64 `json:"sea_surface_temperature"`
+		} `json:"hourly"`
+	}
+	params := url.Values{
+		"latitude":      {formatCoordinate(location.Lat)},
+		"longitude":     {formatCoordinate(location.Lon)},
+		"timezone":      {"auto"},
+		"forecast_days": {strconv.Itoa(max(query.Days, 1))},
+		"hourly":        {"wave_height,swell_wave_height,swell_wave_direction,swell_wave_period,sea_surface_temperature"},
+	}
+	if err := p.get(ctx, p.marineURL+"/marine", params, &response); err != nil {
+		// The location itself was found; the marine API rejects points on land.
+		if errors.Is(err, ErrLocationNotFound) {
+			return nil, fmt.Errorf("%w: %q", ErrNotCoastal, query.Location)
+		}
+		return nil, err
+	}
+
+	// The marine API has no wind; it comes from the forecast API for the
+	// same point and hours.
+	var wind struct {
+		Hourly struct {
+			Time             []string  `json:"time"`
+			WindSpeed10m     []float64 `json:"wind_speed_10m"`
+			WindDirection10m []float64 `json:"wind_direction_10m"`
+			WindGusts10m     []float64 `json:"wind_gusts_10m"`
+		} `json:"hourly"`
+	}
+	params.Set("hourly", "wind_speed_10m,wind_direction_10m,wind_gusts_10m")
+	if err := p.get(ctx, p.baseURL+"/forecast", params, &wind); err != nil {
+		return nil, err
+	}
+	windHours := make(map[string]int, len(wind.Hourly.Time))
+	for i, value := range wind.Hourly.Time {
+		windHours[value] = i
+	}
+
+	loc, err := time.LoadLocation(response.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	report := &MarineReport{Location: *location, Source: p.Name()}
+	hourly := response.Hourly
+	for i, value := range hourly.Time {
+		t, err := time.ParseInLocation(openMeteoTimeLayout, value, loc)
+		if err != nil {
+			continue
+		}
+
+		date := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		if len(report.Days) == 0 || !report.Days[len(report.Days)-1].Date.Equal(date) {
+			report.Days = append(report.Days, MarineDay{Date: date})
+		}
+
+		hour := MarineHour{
+			Time:           t,
+			WaveHeightM:    at(hourly.WaveHeight, i),
+			SwellHeightM:   at(hourly.SwellWaveHeight, i),
+			SwellDirection: at(hourly.SwellWaveDirection, i),
+			SwellCompass:   compass(at(hourly.SwellWaveDirection, i)),
+			SwellPeriodS:   at(hourly.SwellWavePeriod, i),
+			WaterTempC:     at(hourly.SeaSurfaceTemperature, i),
+		}
+		if j, ok := windHours[value]; ok {
+			hour.WindKph = at(wind.Hourly.WindSpeed10m, j)
+			hour.WindCompass = compass(at(wind.Hourly.WindDirection10m, j))
+			hour.GustKph = at(wind.Hourly.WindGusts10m, j)
+		}
+
+		day := &report.Days[len(report.Days)-1]
+		day.Hours = append(day.Hours, hour)
+	}
+
+	if !report.hasWaves() {
+		return nil, fmt.Errorf("%w: %q", ErrNotCoastal, query.Location)
+	}
+
+	return report, nil
+}
+
+// epaCategory turns a US AQI value (0-500) into the EPA category (1-6)
+// WeatherAPI reports.
+func epaCategory(aqi float64) int {
+	for i, upper := range []float64{50, 100, 150, 200, 300} {
+		if aqi <= upper {
+			return i + 1
+		}
+	}
+
+	return 6
+}
+
+// defraIndex derives the UK Daily Air Quality Index (1-10) from PM2.5 alone,
+// as Open-Meteo does not report it.
+func defraIndex(pm25 float64) int {
+	for i, upper := range []float64{11, 23, 35, 41, 47, 53, 58, 64, 70} {
+		if pm25 <= upper {
+			return i + 1
+		}
+	}
+
+	return 10
+}
+
+const openMeteoTimeLayout = "2006-01-02T15:04"
+
+// averageTemperature averages the hourly temperatures of the day starting at
+// date, as Open-Meteo's forecast has no daily mean.
+func averageTemperature(hourly []Hour, date time.Time) float64 {
+	end := date.AddDate(0, 0, 1)
+
+	var sum float64
+	var count int
+	for _, hour := range hourly {
+		if !hour.Time.Before(date) && hour.Time.Before(end) {
+			sum += hour.TemperatureC
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+
+	return sum / float64(count)
+}
+
+func (p *OpenMeteo) get(ctx context.Context, endpoint string, params url.Values, v any) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := p.httpClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("%w: openmeteo: %v", ErrUnavailable, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusBadRequest {
+		var body struct {
+			Reason string `json:"reason"`
+		}
+		_ = json.NewDecoder(response.Body).Decode(&body)
+		return fmt.Errorf("%w: %s", ErrLocationNotFound, body.Reason)
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: openmeteo: %s", ErrUnavailable, response.Status)
+	}
+
+	if err := json.NewDecoder(response.Body).Decode(v); err != nil {
+		return fmt.Errorf("%w: openmeteo: invalid response: %v", ErrUnavailable, err)
+	}
+
+	return nil
+}
+
+// parseCoordinates accepts "lat,lon" in decimal degrees.
+func parseCoordinates(query string) (float64, float64, bool) {
+	latText, lonText, ok := strings.Cut(query, ",")
+	if !ok {
+		return 0, 0, false
+	}
+
+	lat, err := strconv.ParseFloat(strings.TrimSpace(latText), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return 0, 0, false
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(lonText), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return 0, 0, false
+	}
+
+	return lat, lon, true
+}
+
+func formatCoordinate(value float64) string {
+	return strconv.FormatFloat(value, 'f', 4, 64)
+}
+
+// clockTime turns Open-Meteo's "2024-06-01T04:43" into "04:43 AM", the format
+// WeatherAPI uses for sunrise and sunset.
+func clockTime(value string, loc *time.Location) string {
+	t, err := time.ParseInLocation(openMeteoTimeLayout, value, loc)
+	if err != nil {
+		return ""
+	}
+
+	return t.Format("03:04 PM")
+}
+
+// at returns values[i], or the zero value when Open-Meteo omitted the series.
+func at[T any](values []T, i int) T {
+	var zero T
+	if i >= len(values) {
+		return zero
+	}
+
+	return values[i]
+}
@@ -0,0 +1,193 @@
+// Package weatherprovider hides the weather data source behind one interface
+// and one normalized data shape, so the rest of the service does not depend
+// on a particular API.
+package weatherprovider
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrLocationNotFound means the source does not know the queried location.
+	ErrLocationNotFound = errors.New("location not found")
+	// ErrUnavailable means the source could not be reached or answered with
+	// an error; the request may succeed later or with another source.
+	ErrUnavailable = errors.New("weather source unavailable")
+)
+
+// WeatherProvider returns normalized weather data for a location.
+type WeatherProvider interface {
+	// Name identifies the source, e.g. "weatherapi".
+	Name() string
+	// Locate resolves a location query (city name, "lat,lon", ...).
+	Locate(ctx context.Context, query string) (*Location, error)
+	// Search returns the locations matching a partial name, best match
+	// first, or none. Results may lack a timezone.
+	Search(ctx context.Context, query string) ([]Location, error)
+	// Fetch returns current conditions and, when query.Days > 0, hourly and
+	// daily forecasts for that many days starting today.
+	Fetch(ctx context.Context, query Query) (*Report, error)
+}
+
+// StatusReporter is implemented by providers that expose their health, such
+// as the state of a circuit breaker, on /health.
+type StatusReporter interface {
+	Status() map[string]any
+}
+
+type Query struct {
+	Location string
+	Days     int
+	// Lang requests condition descriptions in a language, where supported.
+	Lang string
+	// Alerts requests active weather alerts. Sources without alert data
+	// (Open-Meteo) return none.
+	Alerts bool
+	// AirQuality requests current air quality along with the weather. It is
+	// best effort: Report.AirQuality stays nil when the source has none.
+	AirQuality bool
+}
+
+type Location struct {
+	// ID identifies the location within the source that found it.
+	ID       int64   `json:"id,omitempty"`
+	Name     string  `json:"name"`
+	Region   string  `json:"region,omitempty"`
+	Country  string  `json:"country,omitempty"`
+	Lat      float64 `json:"lat"`
+	Lon      float64 `json:"lon"`
+	Timezone string  `json:"timezone"`
+}
+
+type Report struct {
+	Location Location `json:"location"`
+	Current  *Current `json:"current,omitempty"`
+	Hourly   []Hour   `json:"hourly,omitempty"`
+	Daily    []Day    `json:"daily,omitempty"`
+	Alerts   []Alert  `json:"alerts,omitempty"`
+
+	AirQuality *AirQuality `json:"air_quality,omitempty"`
+	// Source is the provider that produced the report. Reports merged from
+	// several providers list them in Sources.
+	Source  string   `json:"source"`
+	Sources []string `json:"sources,omitempty"`
+}
+
+// Current holds the latest observed conditions. Temperatures are in °C, wind
+// speeds in km/h and precipitation in mm.
+type Current struct {
+	Time         time.Time `json:"time"`
+	TemperatureC float64   `json:"temperature_c"`
+	FeelsLikeC   float64   `json:"feels_like_c"`
+	Humidity     int       `json:"humidity"`
+	WindKph      float64   `json:"wind_kph"`
+	GustKph      float64   `json:"gust_kph"`
+	PrecipMm     float64   `json:"precip_mm"`
+	CloudCover   int       `json:"cloud_cover"`
+	Description  string    `json:"description"`
+	Condition    Condition `json:"condition,omitempty"`
+	IsDay        bool      `json:"is_day"`
+}
+
+type Hour struct {
+	Time         time.Time `json:"time"`
+	TemperatureC float64   `json:"temperature_c"`
+	FeelsLikeC   float64   `json:"feels_like_c"`
+	Humidity     int       `json:"humidity"`
+	WindKph      float64   `json:"wind_kph"`
+	GustKph      float64   `json:"gust_kph"`
+	PrecipMm     float64   `json:"precip_mm"`
+	ChanceOfRain int       `json:"chance_of_rain"`
+	ChanceOfSnow int       `json:"chance_of_snow"`
+	CloudCover   int       `json:"cloud_cover"`
+	Description  string    `json:"description"`
+	Condition    Condition `json:"condition,omitempty"`
+}
+
+type Day struct {
+	// Date is midnight of the day in the location's timezone.
+	Date          time.Time `json:"date"`
+	MaxTempC      float64   `json:"max_temp_c"`
+	MinTempC      float64   `json:"min_temp_c"`
+	AvgTempC      float64   `json:"avg_temp_c"`
+	MaxWindKph    float64   `json:"max_wind_kph"`
+	TotalPrecipMm float64   `json:"total_precip_mm"`
+	ChanceOfRain  int       `json:"chance_of_rain"`
+	ChanceOfSnow  int       `json:"chance_of_snow"`
+	UV            float64   `json:"uv"`
+	Description   string    `json:"description"`
+	Condition     Condition `json:"condition,omitempty"`
+	Sunrise       string    `json:"sunrise,omitempty"`
+	Sunset        string    `json:"sunset,omitempty"`
+	Moonrise      string    `json:"moonrise,omitempty"`
+	Moonset       string    `json:"moonset,omitempty"`
+	MoonPhase     string    `json:"moon_phase,omitempty"`
+	// MoonIllumination is the lit fraction of the moon in percent.
+	MoonIllumination int `json:"moon_illumination"`
+}
+
+// AirQuality holds current pollutant concentrations in μg/m³ and the US EPA
+// (1 good to 6 hazardous) and UK DEFRA (1 low to 10 very high) indexes.
+type AirQuality struct {
+	PM25         float64 `json:"pm2_5"`
+	PM10         float64 `json:"pm10"`
+	O3           float64 `json:"o3"`
+	NO2          float64 `json:"no2"`
+	SO2          float64 `json:"so2"`
+	CO           float64 `json:"co"`
+	USEPAIndex   int     `json:"us_epa_index"`
+	GBDEFRAIndex int     `json:"gb_defra_index"`
+}
+
+// Alert is a weather warning in CAP terms, as issued by national weather
+// services.
+type Alert struct {
+	Headline    string    `json:"headline"`
+	Event       string    `json:"event"`
+	Severity    string    `json:"severity"`
+	Urgency     string    `json:"urgency"`
+	Category    string    `json:"category"`
+	Certainty   string    `json:"certainty"`
+	Areas       string    `json:"areas"`
+	Effective   time.Time `json:"effective"`
+	Expires     time.Time `json:"expires"`
+	Description string    `json:"description"`
+	Instruction string    `json:"instruction"`
+}
+
+var sourceNames = map[string]string{
+	"weatherapi": "WeatherAPI.com",
+	"openmeteo":  "Open-Meteo",
+	"fixtures":   "local fixtures",
+}
+
+// Attribution names the source(s) of a report for display, e.g. in emails.
+func Attribution(report *Report) string {
+	if len(report.Sources) == 0 {
+		return sourceName(report.Source)
+	}
+
+	names := make([]string, len(report.Sources))
+	for i, source := range report.Sources {
+		names[i] = sourceName(source)
+	}
+
+	return "median of " + strings.Join(names, ", ")
+}
+
+func sourceName(source string) string {
+	if name, ok := sourceNames[source]; ok {
+		return name
+	}
+
+	return source
+}
+
+// LocationKey normalizes a location query so that "London" and " london"
+// refer to the same place.
+func LocationKey(query string) string {
+	return strings.ToLower(strings.Join(strings.Fields(query), " "))
+}
@@ -0,0 +1,398 @@
+package weatherprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/antihax/optional"
+
+	weatherClient "weather_subscription/internal/weatherClient"
+)
+
+// WeatherAPI serves weather from weatherapi.com through the generated client,
+// which already caches responses and retries failed calls.
+type WeatherAPI struct {
+	client *weatherClient.APIClient
+}
+
+func NewWeatherAPI(client *weatherClient.APIClient) *WeatherAPI {
+	return &WeatherAPI{client: client}
+}
+
+func (p *WeatherAPI) Name() string {
+	return "weatherapi"
+}
+
+func (p *WeatherAPI) Status() map[string]any {
+	return map[string]any{"circuit_breaker": p.client.BreakerState()}
+}
+
+func (p *WeatherAPI) Locate(ctx context.Context, query string) (*Location, error) {
+	location, response, err := p.client.APIsApi.TimeZone(ctx, query)
+	if err != nil {
+		return nil, p.wrapError(query, response, err)
+	}
+
+	return convertLocation(&location), nil
+}
+
+func (p *WeatherAPI) LocateIP(ctx context.Context, ip string) (*Location, error) {
+	result, response, err := p.client.APIsApi.IpLookup(ctx, ip)
+	if err != nil {
+		return nil, p.wrapError(ip, response, err)
+	}
+	if result.City == "" && result.Lat == 0 && result.Lon == 0 {
+		return nil, fmt.Errorf("%w: %q", ErrLocationNotFound, ip)
+	}
+
+	return &Location{
+		Name:     result.City,
+		Region:   result.Region,
+		Country:  result.CountryName,
+		Lat:      result.Lat,
+		Lon:      result.Lon,
+		Timezone: result.TzId,
+	}, nil
+}
+
+func (p *WeatherAPI) Search(ctx context.Context, query string) ([]Location, error) {
+	results, response, err := p.client.APIsApi.SearchAutocompleteWeather(ctx, query)
+	if err != nil {
+		return nil, p.wrapError(query, response, err)
+	}
+
+	locations := make([]Location, 0, len(results))
+	for _, result := range results {
+		locations = append(locations, Location{
+			ID:      int64(result.Id),
+			Name:    result.Name,
+			Region:  result.Region,
+			Country: result.Country,
+			Lat:     result.Lat,
+			Lon:     result.Lon,
+		})
+	}
+
+	return locations, nil
+}
+
+func (p *WeatherAPI) Fetch(ctx context.Context, query Query) (*Report, error) {
+	// Alerts are only returned by the forecast endpoint.
+	if query.Alerts && query.Days <= 0 {
+		query.Days = 1
+	}
+
+	if query.Days <= 0 {
+		opts := &weatherClient.APIsApiRealtimeWeatherOpts{}
+		if query.Lang != "" {
+			opts.Lang = optional.NewString(query.Lang)
+		}
+		if query.AirQuality {
+			opts.Aqi = optional.NewString("yes")
+		}
+
+		weather, response, err := p.client.APIsApi.RealtimeWeather(ctx, query.Location, opts)
+		if err != nil {
+			return nil, p.wrapError(query.Location, response, err)
+		}
+
+		return p.report(weather.Location, weather.Current, nil)
+	}
+
+	opts := &weatherClient.APIsApiForecastWeatherOpts{}
+	if query.Lang != "" {
+		opts.Lang = optional.NewString(query.Lang)
+	}
+	if query.Alerts {
+		opts.Alerts = optional.NewString("yes")
+	}
+	if query.AirQuality {
+		opts.Aqi = optional.NewString("yes")
+	}
+
+	weather, response, err := p.client.APIsApi.ForecastWeather(ctx, query.Location, int32(query.Days), opts)
+	if err != nil {
+		return nil, p.wrapError(query.Location, response, err)
+	}
+
+	report, err := p.report(weather.Location, weather.Current, weather.Forecast)
+	if err != nil {
+		return nil, err
+	}
+	if weather.Alerts != nil {
+		for _, alert := range weather.Alerts.Alert {
+			report.Alerts = append(report.Alerts, Alert{
+				Headline:    alert.Headline,
+				Event:       alert.Event,
+				Severity:    alert.Severity,
+				Urgency:     alert.Urgency,
+				Category:    alert.Category,
+				Certainty:   alert.Certainty,
+				Areas:       alert.Areas,
+				Effective:   alert.Effective,
+				Expires:     alert.Expires,
+				Description: alert.Desc,
+				Instruction: alert.Instruction,
+			})
+		}
+	}
+
+	return report, nil
+}
+
+// History covers at most MaxHistoryDays days per call; how far back depends
+// on the WeatherAPI plan.
+func (p *WeatherAPI) History(ctx context.Context, location string, from, to time.Time) (*History, error) {
+	opts := &weatherClient.APIsApiHistoryWeatherOpts{}
+	if to.After(from) {
+		opts.EndDt = optional.NewString(historyDate(to))
+	}
+
+	weather, response, err := p.client.APIsApi.HistoryWeather(ctx, location, historyDate(from), opts)
+	if err != nil {
+		return nil, p.wrapError(location, response, err)
+	}
+	if weather.Location == nil {
+		return nil, fmt.Errorf("%w: weatherapi returned incomplete data", ErrUnavailable)
+	}
+
+	loc, err := time.LoadLocation(weather.Location.TzId)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	history := &History{Location: *convertLocation(weather.Location), Source: p.Name()}
+	if weather.Forecast != nil {
+		for _, forecastDay := range weather.Forecast.Forecastday {
+			date, err := time.ParseInLocation("2006-01-02", forecastDay.Date, loc)
+			if err != nil || forecastDay.Day == nil {
+				continue
+			}
+			history.Days = append(history.Days, convertDay(&forecastDay, date))
+		}
+	}
+
+	return history, nil
+}
+
+func (p *WeatherAPI) Marine(ctx context.Context, query Query) (*MarineReport, error) {
+	var opts *weatherClient.APIsApiMarineWeatherOpts
+	if query.Lang != "" {
+		opts = &weatherClient.APIsApiMarineWeatherOpts{Lang: optional.NewString(query.Lang)}
+	}
+
+	weather, response, err := p.client.APIsApi.MarineWeather(ctx, query.Location, int32(max(query.Days, 1)), opts)
+	if err != nil {
+		return nil, p.wrapError(query.Location, response, err)
+	}
+	if weather.Location == nil || weather.Forecast == nil {
+		return nil, fmt.Errorf("%w: weatherapi returned incomplete marine data", ErrUnavailable)
+	}
+
+	loc := time.UTC
+	if tz, err := time.LoadLocation(weather.Location.TzId); err == nil {
+		loc = tz
+	}
+
+	report := &MarineReport{
+		Location: *convertLocation(weather.Location),
+		Source:   p.Name(),
+	}
+	for _, forecastDay := range weather.Forecast.Forecastday {
+		date, err := time.ParseInLocation("2006-01-02", forecastDay.Date, loc)
+		if err != nil {
+			continue
+		}
+
+		day := MarineDay{Date: date}
+		if forecastDay.Astro != nil {
+			day.Sunrise = forecastDay.Astro.Sunrise
+			day.Sunset = forecastDay.Astro.Sunset
+		}
+		if forecastDay.Day != nil {
+			for _, tides := range forecastDay.Day.Tides {
+				for _, tide := range tides.Tide {
+					t, err := time.ParseInLocation("2006-01-02 15:04", tide.TideTime, loc)
+					if err != nil {
+						continue
+					}
+					height, _ := strconv.ParseFloat(tide.TideHeightMt, 64)
+					day.Tides = append(day.Tides, Tide{Time: t, HeightM: height, Type: tide.TideType})
+				}
+			}
+		}
+
+		for _, marineHour := range forecastDay.Hour {
+			hour := MarineHour{
+				Time:           time.Unix(int64(marineHour.TimeEpoch), 0).In(loc),
+				WaveHeightM:    marineHour.SigHtMt,
+				SwellHeightM:   marineHour.SwellHtMt,
+				SwellDirection: marineHour.SwellDir,
+				SwellCompass:   marineHour.SwellDir16Point,
+				SwellPeriodS:   marineHour.SwellPeriodSecs,
+				WindKph:        marineHour.WindKph,
+				WindCompass:    marineHour.WindDir,
+				GustKph:        marineHour.GustKph,
+				TemperatureC:   marineHour.TempC,
+				WaterTempC:     marineHour.WaterTempC,
+			}
+			if hour.SwellCompass == "" {
+				hour.SwellCompass = compass(hour.SwellDirection)
+			}
+			if marineHour.Condition != nil {
+				hour.Description = marineHour.Condition.Text
+			}
+			day.Hours = append(day.Hours, hour)
+		}
+
+		report.Days = append(report.Days, day)
+	}
+
+	if !report.hasWaves() {
+		return nil, fmt.Errorf("%w: %q", ErrNotCoastal, query.Location)
+	}
+
+	return report, nil
+}
+
+// wrapError maps WeatherAPI's 400 (no matching location) to
+// ErrLocationNotFound and everything else to ErrUnavailable.
+func (p *WeatherAPI) wrapError(query string, response *http.Response, err error) error {
+	if response != nil && response.StatusCode == http.StatusBadRequest {
+		return fmt.Errorf("%w: %q", ErrLocationNotFound, query)
+	}
+	if errors.Is(err, weatherClient.ErrCircuitOpen) {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+
+	return fmt.Errorf("%w: weatherapi: %v", ErrUnavailable, err)
+}
+
+func (p *WeatherAPI) report(location *weatherClient.Location, current *weatherClient.Current, forecast *weatherClient.Forecast) (*Report, error) {
+	if location == nil || current == nil {
+		return nil, fmt.Errorf("%w: weatherapi returned incomplete data", ErrUnavailable)
+	}
+
+	report := &Report{
+		Location: *convertLocation(location),
+		Current: &Current{
+			Time:         time.Unix(int64(current.LastUpdatedEpoch), 0),
+			TemperatureC: current.TempC,
+			FeelsLikeC:   current.FeelslikeC,
+			Humidity:     int(current.Humidity),
+			WindKph:      current.WindKph,
+			GustKph:      current.GustKph,
+			PrecipMm:     current.PrecipMm,
+			CloudCover:   int(current.Cloud),
+			IsDay:        current.IsDay == 1,
+		},
+		Source: p.Name(),
+	}
+	if current.Condition != nil {
+		report.Current.Description = current.Condition.Text
+		report.Current.Condition = weatherAPICondition(current.Condition.Code)
+	}
+	if aq := current.AirQuality; aq != nil {
+		report.AirQuality = &AirQuality{
+			PM25:         aq.Pm25,
+			PM10:         aq.Pm10,
+			O3:           aq.O3,
+			NO2:          aq.No2,
+			SO2:          aq.So2,
+			CO:           aq.Co,
+			USEPAIndex:   int(aq.UsEpaIndex),
+			GBDEFRAIndex: int(aq.GbDefraIndex),
+		}
+	}
+
+	if forecast == nil {
+		return report, nil
+	}
+
+	loc := time.UTC
+	if tz, err := time.LoadLocation(location.TzId); err == nil {
+		loc = tz
+	}
+
+	for _, forecastDay := range forecast.Forecastday {
+		date, err := time.ParseInLocation("2006-01-02", forecastDay.Date, loc)
+		if err != nil {
+			continue
+		}
+
+		if forecastDay.Day != nil {
+			report.Daily = append(report.Daily, convertDay(&forecastDay, date))
+		}
+
+		for _, forecastHour := range forecastDay.Hour {
+			hour := Hour{
+				Time:         time.Unix(int64(forecastHour.TimeEpoch), 0).In(loc),
+				TemperatureC: forecastHour.TempC,
+				FeelsLikeC:   forecastHour.FeelslikeC,
+				Humidity:     int(forecastHour.Humidity),
+				WindKph:      forecastHour.WindKph,
+				GustKph:      forecastHour.GustKph,
+				PrecipMm:     forecastHour.PrecipMm,
+				ChanceOfRain: int(forecastHour.ChanceOfRain),
+				ChanceOfSnow: int(forecastHour.ChanceOfSnow),
+				CloudCover:   int(forecastHour.Cloud),
+			}
+			if forecastHour.Condition != nil {
+				hour.Description = forecastHour.Condition.Text
+				hour.Condition = weatherAPICondition(forecastHour.Condition.Code)
+			}
+			report.Hourly = append(report.Hourly, hour)
+		}
+	}
+
+	return report, nil
+}
+
+// convertDay maps a forecast or history day whose Day is set.
+func convertDay(forecastDay *weatherClient.ForecastForecastday, date time.Time) Day {
+	day := Day{
+		Date:          date,
+		MaxTempC:      forecastDay.Day.MaxtempC,
+		MinTempC:      forecastDay.Day.MintempC,
+		AvgTempC:      forecastDay.Day.AvgtempC,
+		MaxWindKph:    forecastDay.Day.MaxwindKph,
+		TotalPrecipMm: forecastDay.Day.TotalprecipMm,
+		ChanceOfRain:  int(forecastDay.Day.DailyChanceOfRain),
+		ChanceOfSnow:  int(forecastDay.Day.DailyChanceOfSnow),
+		UV:            float64(forecastDay.Day.Uv),
+	}
+	if forecastDay.Day.Condition != nil {
+		day.Description = forecastDay.Day.Condition.Text
+		day.Condition = weatherAPICondition(forecastDay.Day.Condition.Code)
+	}
+	if forecastDay.Astro != nil {
+		day.Sunrise = forecastDay.Astro.Sunrise
+		day.Sunset = forecastDay.Astro.Sunset
+		day.Moonrise = forecastDay.Astro.Moonrise
+		day.Moonset = forecastDay.Astro.Moonset
+		day.MoonPhase = forecastDay.Astro.MoonPhase
+		if illumination, err := forecastDay.Astro.MoonIllumination.Float64(); err == nil {
+			day.MoonIllumination = int(illumination)
+		}
+	}
+	if day.MoonPhase == "" {
+		day.MoonPhase, day.MoonIllumination = moonPhase(date)
+	}
+
+	return day
+}
+
+func convertLocation(location *weatherClient.Location) *Location {
+	return &Location{
+		Name:     location.Name,
+		Region:   location.Region,
+		Country:  location.Country,
+		Lat:      location.Lat,
+		Lon:      location.Lon,
+		Timezone: location.TzId,
+	}
+}
@@ -2,32 +2,97 @@ package main
 
 import (
 	"context"
+	"encoding/csv"
+	"errors"
+	"expvar"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // subscriber timezones must resolve without system tzdata
 
 	"weather_subscription/config"
 	databasehandler "weather_subscription/internal/db/database_handler"
 	models "weather_subscription/internal/db/models"
+	"weather_subscription/internal/netguard"
+	"weather_subscription/internal/services/alerts"
+	"weather_subscription/internal/services/cleanup"
 	"weather_subscription/internal/services/email"
+	"weather_subscription/internal/services/notifier"
+	"weather_subscription/internal/services/outbox"
 
 	"weather_subscription/internal/services/scheduler"
 	weatherClient "weather_subscription/internal/weatherClient"
+	weatherProvider "weather_subscription/internal/weatherProvider"
 
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/viper"
 )
 
 const (
-	serverPortKey = "serverPort"
-	receiverKey   = "from"
-	passwordKey   = "password"
-	smtpHostKey   = "smtphost"
-	smtpPortKey   = "smtpport"
+	serverPortKey     = "serverPort"
+	adminAddrKey      = "adminAddr"
+	trustedProxiesKey = "trustedProxies"
+	receiverKey       = "from"
+	passwordKey       = "password"
+	smtpHostKey       = "smtphost"
+	smtpPortKey       = "smtpport"
+
+	publicBaseURLKey     = "publicBaseURL"
+	emailTemplatesDirKey = "email.templatesDir"
+
+	notifierTimeoutKey  = "notifier.timeout"
+	telegramBaseURLKey  = "notifier.telegram.baseURL"
+	telegramBotTokenKey = "notifier.telegram.botToken"
+
+	outboxPollIntervalKey = "outbox.pollInterval"
+	outboxMaxAttemptsKey  = "outbox.maxAttempts"
+
+	schedulerMaxAttemptsKey = "scheduler.maxAttempts"
+
+	purgeUnconfirmedAfterDaysKey = "subscription.purgeUnconfirmedAfterDays"
+
+	observationDownsampleAfterDaysKey = "observations.downsampleAfterDays"
+	observationRetentionDaysKey       = "observations.retentionDays"
+
+	weatherProviderKey           = "weather.provider"
+	weatherFallbacksKey          = "weather.fallbacks"
+	weatherSourceTimeoutKey      = "weather.sourceTimeout"
+	weatherConsensusThresholdKey = "weather.consensusThreshold"
+	openMeteoURLKey              = "weather.openmeteo.baseURL"
+	openMeteoGeocodingURLKey     = "weather.openmeteo.geocodingURL"
+	openMeteoAirQualityURLKey    = "weather.openmeteo.airQualityURL"
+	openMeteoMarineURLKey        = "weather.openmeteo.marineURL"
+	openMeteoArchiveURLKey       = "weather.openmeteo.archiveURL"
+	openMeteoTimeoutKey          = "weather.openmeteo.timeout"
+	fixturesDirKey               = "weather.fixtures.dir"
+
+	alertsPollIntervalKey = "alerts.pollInterval"
+
+	weatherAPIKeyKey       = "weather_api.key"
+	weatherCacheBackendKey = "weather_api.cache.backend"
+	weatherCacheSizeKey    = "weather_api.cache.size"
+	weatherCacheTTLKey     = "weather_api.cache.ttl"
+
+	weatherTimeoutKey          = "weather_api.timeout"
+	weatherMaxRetriesKey       = "weather_api.maxRetries"
+	weatherRetryBaseDelayKey   = "weather_api.retryBaseDelay"
+	weatherRetryMaxDelayKey    = "weather_api.retryMaxDelay"
+	weatherBreakerThresholdKey = "weather_api.breaker.threshold"
+	weatherBreakerCooldownKey  = "weather_api.breaker.cooldown"
+
+	defaultDeliveryHour = 7
 )
 
-var emailService *email.EmailService
+var (
+	emailService *email.EmailService
+	fanout       *notifier.Fanout
+)
 
 func main() {
 	config.LoadConfig()
@@ -45,46 +110,102 @@ func main() {
 		emailConfig = viper.GetStringMapString("email.production")
 	}
 
-	emailService = email.NewEmailService(
+	// Links in emails point at the public address of the API
+	baseURL := viper.GetString(publicBaseURLKey)
+	if baseURL == "" {
+		baseURL = "http://localhost:" + viper.GetString(serverPortKey)
+	}
+
+	var err error
+	emailService, err = email.NewEmailService(
 		emailConfig[receiverKey],
 		emailConfig[passwordKey],
 		emailConfig[smtpHostKey],
 		emailConfig[smtpPortKey],
+		baseURL,
+		viper.GetString(emailTemplatesDirKey),
 	)
+	if err != nil {
+		log.Fatalf("Failed to initialize email service: %v", err)
+	}
+
+	// Deliver notifications to the channels subscribers registered besides
+	// their email address. Webhook and Slack URLs come from subscribers and
+	// may only reach public addresses; the Telegram Bot API URL is ours and
+	// may be a local server. Telegram needs a bot.
+	notifierTimeout := viper.GetDuration(notifierTimeoutKey)
+	publicClient := notifier.NewPublicHTTPClient(notifierTimeout)
+	fanout = notifier.NewFanout(emailService)
+	fanout.Register(models.WebhookChannel, notifier.NewWebhook(publicClient))
+	fanout.Register(models.SlackChannel, notifier.NewSlack(publicClient))
+	if botToken := viper.GetString(telegramBotTokenKey); botToken != "" {
+		fanout.Register(models.TelegramChannel, notifier.NewTelegram(notifier.NewHTTPClient(notifierTimeout), viper.GetString(telegramBaseURLKey), botToken))
+	}
 
 	// Initialize database
-	err := databasehandler.Init(context.Background())
+	err = databasehandler.Init(context.Background())
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer databasehandler.Close()
 
-	// Initialize WeatherAPI client
-	apiKey := viper.GetString("weather_api.key")
-	if apiKey == "" {
-		log.Fatal("Weather API key not found in configuration")
-		return
-	}
-	configuration := weatherClient.NewConfiguration()
-	configuration.AddDefaultHeader("key", apiKey)
-
-	weatherClient := weatherClient.NewAPIClient(configuration)
-	if weatherClient == nil {
-		log.Fatalf("Failed to create weather client")
-		return
-	}
+	// Initialize the weather provider, shared by the scheduler and the API so
+	// both use the same response cache
+	provider := newWeatherProvider()
 
 	// Initialize and start scheduler
-	scheduler := scheduler.NewWeatherScheduler(weatherClient, emailService)
+	scheduler := scheduler.NewWeatherScheduler(provider, fanout, viper.GetInt(schedulerMaxAttemptsKey))
 	ctx := context.Background()
 	go scheduler.Start(ctx)
 
+	// Start outbox dispatcher for confirmation emails and channel
+	// confirmations
+	dispatcher := outbox.NewDispatcher(emailService, fanout,
+		viper.GetDuration(outboxPollIntervalKey),
+		viper.GetInt(outboxMaxAttemptsKey),
+	)
+	go dispatcher.Start(ctx)
+
+	// Start purging subscriptions that were never confirmed and old weather
+	// observations
+	purger := cleanup.NewPurger(
+		time.Duration(viper.GetInt(purgeUnconfirmedAfterDaysKey))*24*time.Hour,
+		time.Hour,
+		time.Duration(viper.GetInt(observationDownsampleAfterDaysKey))*24*time.Hour,
+		time.Duration(viper.GetInt(observationRetentionDaysKey))*24*time.Hour,
+	)
+	go purger.Start(ctx)
+
+	// Start polling subscribed cities for severe weather alerts
+	alertPoller := alerts.NewPoller(provider, fanout, viper.GetDuration(alertsPollIntervalKey))
+	go alertPoller.Start(ctx)
+
+	// Metrics stay off the public API, on their own listener
+	if addr := viper.GetString(adminAddrKey); addr != "" {
+		go startAdminServer(addr)
+	}
+
 	// Setup routes and start server
-	startAPIServer()
+	startAPIServer(provider)
+}
+
+// startAdminServer serves /debug/vars, which should only be reachable by
+// operators, e.g. on a loopback or internal address.
+func startAdminServer(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Printf("Admin server stopped: %v", err)
+	}
 }
 
-func startAPIServer() {
+func startAPIServer(provider weatherProvider.WeatherProvider) {
 	router := gin.Default()
+	// X-Forwarded-For is only honored from these proxies (none by default).
+	if err := router.SetTrustedProxies(viper.GetStringSlice(trustedProxiesKey)); err != nil {
+		log.Fatalf("Invalid trusted proxies: %v", err)
+	}
 
 	// Serve static files
 	router.Static("/frontend", "./frontend")
@@ -93,58 +214,179 @@ func startAPIServer() {
 		c.HTML(http.StatusOK, "index.html", nil)
 	})
 
-	// Initialize WeatherAPI client
-	apiKey := viper.GetString("weather_api.key")
+	registerRoutes(router, provider)
+
+	port := viper.GetString(serverPortKey)
+	if port == "" {
+		port = "8080"
+	}
+	router.Run(":" + port)
+}
+
+// newWeatherProvider builds the configured provider. With fallbacks (or
+// consensus) configured, the sources are combined into a composite provider
+// that tries them in order.
+func newWeatherProvider() weatherProvider.WeatherProvider {
+	names := append([]string{viper.GetString(weatherProviderKey)}, viper.GetStringSlice(weatherFallbacksKey)...)
+	if len(names) == 1 {
+		return buildWeatherProvider(names[0])
+	}
+
+	providers := make([]weatherProvider.WeatherProvider, 0, len(names))
+	for _, name := range names {
+		providers = append(providers, buildWeatherProvider(name))
+	}
+
+	return weatherProvider.NewComposite(providers,
+		viper.GetDuration(weatherSourceTimeoutKey),
+		viper.GetFloat64(weatherConsensusThresholdKey),
+	)
+}
+
+func buildWeatherProvider(name string) weatherProvider.WeatherProvider {
+	switch name {
+	case "", "weatherapi":
+		return weatherProvider.NewWeatherAPI(newWeatherClient())
+	case "openmeteo":
+		return weatherProvider.NewOpenMeteo(
+			viper.GetString(openMeteoURLKey),
+			viper.GetString(openMeteoGeocodingURLKey),
+			viper.GetString(openMeteoAirQualityURLKey),
+			viper.GetString(openMeteoMarineURLKey),
+			viper.GetString(openMeteoArchiveURLKey),
+			viper.GetDuration(openMeteoTimeoutKey),
+		)
+	case "fixtures":
+		return weatherProvider.NewFixtures(viper.GetString(fixturesDirKey))
+	default:
+		log.Fatalf("Unknown weather provider %q", name)
+		return nil
+	}
+}
+
+func newWeatherClient() *weatherClient.APIClient {
+	apiKey := viper.GetString(weatherAPIKeyKey)
 	if apiKey == "" {
 		log.Fatal("Weather API key not found in configuration")
-		return
 	}
 	configuration := weatherClient.NewConfiguration()
 	configuration.AddDefaultHeader("key", apiKey)
 
-	weatherClient := weatherClient.NewAPIClient(configuration)
-
-	if weatherClient == nil {
-		log.Fatalf("Failed to create weather client")
-		return
+	switch backend := viper.GetString(weatherCacheBackendKey); backend {
+	case "", "memory":
+		configuration.Cache = weatherClient.NewLRUCache(viper.GetInt(weatherCacheSizeKey))
+	case "postgres":
+		configuration.Cache = databasehandler.NewResponseCache()
+	case "none":
+	default:
+		log.Fatalf("Unknown weather API cache backend %q", backend)
 	}
 
-	//emailService := &EmailService{}
-	//scheduler := scheduler.NewWeatherScheduler(weatherClient, emailService)
+	for endpoint, ttl := range viper.GetStringMapString(weatherCacheTTLKey) {
+		duration, err := time.ParseDuration(ttl)
+		if err != nil {
+			log.Fatalf("Invalid cache TTL %q for %s: %v", ttl, endpoint, err)
+		}
+		configuration.CacheTTL["/"+endpoint+".json"] = duration
+	}
 
-	registerRoutes(router, weatherClient)
-	// Start scheduler in background
-	//ctx := context.Background()
-	//go scheduler.Start(ctx)
+	if viper.IsSet(weatherTimeoutKey) {
+		configuration.Timeout = viper.GetDuration(weatherTimeoutKey)
+	}
+	if viper.IsSet(weatherMaxRetriesKey) {
+		configuration.MaxRetries = viper.GetInt(weatherMaxRetriesKey)
+	}
+	if viper.IsSet(weatherRetryBaseDelayKey) {
+		configuration.RetryBaseDelay = viper.GetDuration(weatherRetryBaseDelayKey)
+	}
+	if viper.IsSet(weatherRetryMaxDelayKey) {
+		configuration.RetryMaxDelay = viper.GetDuration(weatherRetryMaxDelayKey)
+	}
+	if viper.IsSet(weatherBreakerThresholdKey) {
+		configuration.BreakerThreshold = viper.GetInt(weatherBreakerThresholdKey)
+	}
+	if viper.IsSet(weatherBreakerCooldownKey) {
+		configuration.BreakerCooldown = viper.GetDuration(weatherBreakerCooldownKey)
+	}
 
-	port := viper.GetString(serverPortKey)
-	if port == "" {
-		port = "8080"
+	client := weatherClient.NewAPIClient(configuration)
+	if client == nil {
+		log.Fatalf("Failed to create weather client")
 	}
-	router.Run(":" + port)
+
+	return client
 }
 
-func registerRoutes(router *gin.Engine, weatherClient *weatherClient.APIClient) {
-	router.GET("/health", healthCheck())
+func registerRoutes(router *gin.Engine, provider weatherProvider.WeatherProvider) {
+	router.GET("/health", healthCheck(provider))
 
-	router.GET("/api/weather/:city", getWeather(weatherClient))
-	router.POST("/api/subscribe", subscribe())
-	router.GET("/api/unsubscribe/:email", unsubscribe())
+	router.GET("/api/weather/:city", getWeather(provider))
+	router.GET("/api/weather/:city/history", getWeatherHistory(provider))
+	router.GET("/api/air-quality/:city", getAirQuality(provider))
+	router.GET("/api/marine/:location", getMarine(provider))
+	router.GET("/api/observations/:city/daily", getDailyObservations())
+	router.GET("/api/observations/:city/rolling", getRollingAverages())
+	router.GET("/api/observations/:city/anomalies", getTemperatureAnomalies())
+	router.GET("/api/locations", searchLocations(provider))
+	router.POST("/api/subscribe", subscribe(provider))
+	router.POST("/api/subscribe/resend", resendConfirmation(provider))
+	// GET serves the link in the email body with a page asking to confirm, so
+	// that link scanners and prefetchers do not unsubscribe anyone. POST
+	// unsubscribes, from that page or as the RFC 8058 one-click
+	// List-Unsubscribe-Post request sent by mail clients.
+	router.GET("/api/unsubscribe/:token", unsubscribePage())
+	router.POST("/api/unsubscribe/:token", unsubscribe())
 	router.GET("/api/confirm/:token", confirm())
+
+	router.POST("/api/subscribers/:email/token", requestManagementToken())
+
+	// Everything else about a subscriber requires their management token.
+	subscriber := router.Group("/api/subscribers/:email", requireManagementToken())
+	subscriber.GET("/subscriptions", listSubscriptions())
+	subscriber.POST("/subscriptions", addSubscription(provider))
+	subscriber.DELETE("/subscriptions/:id", removeSubscription())
+	subscriber.PUT("/subscriptions/:id/alerts", updateAlerts())
+	subscriber.PUT("/subscriptions/:id/air-quality", updateAirQuality())
+	subscriber.GET("/subscriptions/:id/rules", listRules())
+	subscriber.POST("/subscriptions/:id/rules", createRule())
+	subscriber.DELETE("/subscriptions/:id/rules/:ruleId", deleteRule())
+	subscriber.PUT("/subscriptions/:id/channels", updateSubscriptionChannels())
+	subscriber.GET("/channels", listChannels())
+	subscriber.POST("/channels", createChannel())
+	subscriber.DELETE("/channels/:id", deleteChannel())
+
+	router.GET("/api/channels/confirm/:token", confirmChannel())
 }
 
-func healthCheck() gin.HandlerFunc {
+func healthCheck(provider weatherProvider.WeatherProvider) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+		status := gin.H{"name": provider.Name()}
+		if reporter, ok := provider.(weatherProvider.StatusReporter); ok {
+			for key, value := range reporter.Status() {
+				status[key] = value
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":           "ok",
+			"weather_provider": status,
+		})
 	}
 }
 
-func subscribe() gin.HandlerFunc {
+func subscribe(provider weatherProvider.WeatherProvider) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req struct {
-			Email     string                       `json:"email" binding:"required,email"`
-			City      string                       `json:"city" binding:"required"`
-			Frequency models.SubscriptionFrequency `json:"frequency" binding:"required,oneof=daily hourly"`
+			Email string `json:"email" binding:"required,email"`
+			locationRequest
+			Kind         models.SubscriptionKind      `json:"kind" binding:"omitempty,oneof=weather marine astronomy"`
+			Frequency    models.SubscriptionFrequency `json:"frequency" binding:"required,oneof=daily hourly custom"`
+			Schedule     string                       `json:"schedule" binding:"required_if=Frequency custom"`
+			DeliveryHour *int                         `json:"delivery_hour" binding:"omitempty,min=0,max=23"`
+			Language     string                       `json:"language"`
+			Channels     []models.ChannelKind         `json:"channels"`
+			Alerts       *alertsRequest               `json:"alerts"`
+			AirQuality   *airQualityRequest           `json:"air_quality"`
 		}
 
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -152,39 +394,326 @@ func subscribe() gin.HandlerFunc {
 			return
 		}
 
-		token, err := databasehandler.CreateSubscription(c.Request.Context(), req.Email, req.City, req.Frequency)
+		location, err := req.resolve(c, provider)
 		if err != nil {
-			if err.Error() == "subscription already exists" {
+			respondLocationError(c, req.locationRequest, err)
+			return
+		}
+		if req.Kind == models.MarineKind {
+			if status, err := checkCoastal(c.Request.Context(), provider, location); err != nil {
+				c.JSON(status, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		// The confirmation email is queued in the outbox together with the
+		// subscription and delivered by the outbox dispatcher.
+		_, err = databasehandler.CreateSubscription(c.Request.Context(), &models.Subscription{
+			Email:        req.Email,
+			City:         location.Name,
+			Kind:         req.Kind,
+			Frequency:    req.Frequency,
+			Schedule:     req.Schedule,
+			Timezone:     location.Timezone,
+			Place:        place(location),
+			DeliveryHour: deliveryHour(req.DeliveryHour),
+			Language:     req.Language,
+			Channels:     req.Channels,
+			Alerts:       req.Alerts.preferences(),
+			AirQuality:   req.AirQuality.preferences(),
+		})
+		if err != nil {
+			if errors.Is(err, databasehandler.ErrSubscriptionExists) {
 				c.JSON(http.StatusConflict, gin.H{"error": "Subscription already exists"})
+			} else if isInvalidSubscription(err) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			} else {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			}
 			return
 		}
 
-		// Send confirmation email
-		if err := emailService.SendConfirmationEmail(req.Email, *token); err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Failed to send confirmation email: %v", err)})
-		}
-
 		c.JSON(http.StatusCreated, gin.H{
 			"status": "Subscription created successfully. Please check your email to confirm.",
-			"token":  *token,
 		})
 	}
 }
 
+// locationRequest says where a subscription is for: a city name (with the
+// location_id of a GET /api/locations suggestion), coordinates, or the
+// caller's IP address.
+type locationRequest struct {
+	City       string   `json:"city"`
+	LocationID int64    `json:"location_id"`
+	Lat        *float64 `json:"lat" binding:"required_with=Lon,omitempty,min=-90,max=90"`
+	Lon        *float64 `json:"lon" binding:"required_with=Lat,omitempty,min=-180,max=180"`
+	UseMyIP    bool     `json:"use_my_ip"`
+}
+
+var (
+	errLocationChoice = errors.New("exactly one of city, lat and lon, or use_my_ip is required")
+	errUnlocatableIP  = errors.New("cannot determine a location from your IP address")
+)
+
+// resolve turns the request into one canonical location with a supported
+// timezone. The caller's IP is taken from X-Forwarded-For only when the
+// request comes through one of the configured trusted proxies.
+func (r *locationRequest) resolve(c *gin.Context, provider weatherProvider.WeatherProvider) (*weatherProvider.Location, error) {
+	choices := 0
+	for _, chosen := range []bool{r.City != "", r.Lat != nil, r.UseMyIP} {
+		if chosen {
+			choices++
+		}
+	}
+	if choices != 1 {
+		return nil, errLocationChoice
+	}
+
+	ctx := c.Request.Context()
+
+	var location *weatherProvider.Location
+	var err error
+	switch {
+	case r.UseMyIP:
+		location, err = locateIP(ctx, provider, c.ClientIP())
+	case r.Lat != nil:
+		location, err = provider.Locate(ctx, weatherProvider.Location{Lat: *r.Lat, Lon: *r.Lon}.Query())
+		if err == nil {
+			// Keep the exact point rather than the nearest named place.
+			location.Lat, location.Lon = *r.Lat, *r.Lon
+		}
+	default:
+		location, err = weatherProvider.Resolve(ctx, provider, r.City, r.LocationID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if location.Name == "" {
+		location.Name = location.Query()
+	}
+	if _, err := time.LoadLocation(location.Timezone); err != nil || location.Timezone == "" {
+		return nil, fmt.Errorf("unsupported timezone %q for %q", location.Timezone, location.Name)
+	}
+
+	return location, nil
+}
+
+// describe names the requested location in error messages.
+func (r *locationRequest) describe() string {
+	switch {
+	case r.UseMyIP:
+		return "your IP address"
+	case r.Lat != nil:
+		return weatherProvider.Location{Lat: *r.Lat, Lon: *r.Lon}.Query()
+	default:
+		return r.City
+	}
+}
+
+// locateIP geolocates a public IP address through the weather provider.
+func locateIP(ctx context.Context, provider weatherProvider.WeatherProvider, ip string) (*weatherProvider.Location, error) {
+	if !netguard.IsPublic(net.ParseIP(ip)) {
+		return nil, fmt.Errorf("%w: %s is not a public address", errUnlocatableIP, ip)
+	}
+
+	locator, ok := provider.(weatherProvider.IPLocator)
+	if !ok {
+		return nil, fmt.Errorf("%w: the weather provider cannot locate IP addresses", errUnlocatableIP)
+	}
+
+	location, err := locator.LocateIP(ctx, ip)
+	if errors.Is(err, weatherProvider.ErrLocationNotFound) {
+		return nil, fmt.Errorf("%w: %s", errUnlocatableIP, ip)
+	}
+
+	return location, err
+}
+
+// respondLocationError maps a failure to resolve the requested location to
+// the HTTP response. Ambiguous input lists the candidates to choose from.
+func respondLocationError(c *gin.Context, req locationRequest, err error) {
+	var ambiguous *weatherProvider.AmbiguousLocationError
+	switch {
+	case errors.Is(err, errLocationChoice):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errUnlocatableIP):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error() + "; pass a city or lat and lon instead"})
+	case errors.As(err, &ambiguous):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":      fmt.Sprintf("%q matches several locations; pick one by location_id or add the region or country", req.City),
+			"candidates": ambiguous.Candidates,
+		})
+	case errors.Is(err, weatherProvider.ErrLocationNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown location %q", req.describe())})
+	default:
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("failed to resolve %s: %v", req.describe(), err)})
+	}
+}
+
+func place(location *weatherProvider.Location) models.Place {
+	return models.Place{
+		ID:      location.ID,
+		Region:  location.Region,
+		Country: location.Country,
+		Lat:     &location.Lat,
+		Lon:     &location.Lon,
+	}
+}
+
+// checkCoastal makes sure a marine subscription is for a location with a sea
+// forecast. On failure it also returns the HTTP status to respond with.
+func checkCoastal(ctx context.Context, provider weatherProvider.WeatherProvider, location *weatherProvider.Location) (int, error) {
+	city := location.Name
+	marine, ok := provider.(weatherProvider.MarineProvider)
+	if !ok {
+		return http.StatusNotImplemented, errors.New("marine forecasts are not supported by the weather provider")
+	}
+
+	if _, err := marine.Marine(ctx, weatherProvider.Query{Location: location.Query(), Days: 1}); err != nil {
+		switch {
+		case errors.Is(err, weatherProvider.ErrNotCoastal):
+			return http.StatusUnprocessableEntity, fmt.Errorf("%q is not a coastal location; marine reports need a location on the sea", city)
+		case errors.Is(err, weatherProvider.ErrLocationNotFound):
+			return http.StatusBadRequest, fmt.Errorf("unknown city %q", city)
+		default:
+			return http.StatusBadGateway, fmt.Errorf("failed to check the marine forecast for %q: %w", city, err)
+		}
+	}
+
+	return http.StatusOK, nil
+}
+
+// alertsRequest opts a subscription in to severe weather alerts.
+type alertsRequest struct {
+	Enabled     bool     `json:"enabled"`
+	MinSeverity string   `json:"min_severity" binding:"omitempty,oneof=minor moderate severe extreme"`
+	Categories  []string `json:"categories"`
+}
+
+func (r *alertsRequest) preferences() models.AlertPreferences {
+	if r == nil {
+		return models.AlertPreferences{}
+	}
+
+	return models.AlertPreferences{
+		Enabled:     r.Enabled,
+		MinSeverity: models.AlertSeverity(r.MinSeverity),
+		Categories:  r.Categories,
+	}
+}
+
+// airQualityRequest adds air quality to a subscription's updates, with an
+// optional alert threshold.
+type airQualityRequest struct {
+	Enabled        bool   `json:"enabled"`
+	Scale          string `json:"scale" binding:"omitempty,oneof=epa defra"`
+	AlertThreshold int    `json:"alert_threshold" binding:"min=0"`
+}
+
+func (r *airQualityRequest) preferences() models.AirQualityPreferences {
+	if r == nil {
+		return models.AirQualityPreferences{}
+	}
+
+	return models.AirQualityPreferences{
+		Enabled:        r.Enabled,
+		Scale:          models.AQIScale(r.Scale),
+		AlertThreshold: r.AlertThreshold,
+	}
+}
+
+// isInvalidSubscription reports whether creating a subscription failed on
+// invalid input rather than on the server.
+func isInvalidSubscription(err error) bool {
+	return errors.Is(err, databasehandler.ErrInvalidSchedule) ||
+		errors.Is(err, databasehandler.ErrInvalidKind) ||
+		errors.Is(err, databasehandler.ErrInvalidLanguage) ||
+		errors.Is(err, databasehandler.ErrInvalidChannel) ||
+		errors.Is(err, databasehandler.ErrInvalidAlertPreferences) ||
+		errors.Is(err, databasehandler.ErrInvalidAirQualityPreferences)
+}
+
+// deliveryHour returns the requested local delivery hour of daily updates, or
+// the morning default.
+func deliveryHour(requested *int) int {
+	if requested == nil {
+		return defaultDeliveryHour
+	}
+
+	return *requested
+}
+
+// resendConfirmation resolves the location the way subscribe does, so the
+// pending subscription is found by its location rather than its city name.
+func resendConfirmation(provider weatherProvider.WeatherProvider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Email string `json:"email" binding:"required,email"`
+			locationRequest
+			Kind models.SubscriptionKind `json:"kind" binding:"omitempty,oneof=weather marine astronomy"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if req.Kind == "" {
+			req.Kind = models.WeatherKind
+		}
+
+		location, err := req.resolve(c, provider)
+		if err != nil {
+			respondLocationError(c, req.locationRequest, err)
+			return
+		}
+
+		if _, err := databasehandler.ResendConfirmation(c.Request.Context(), &models.Subscription{
+			Email: req.Email,
+			City:  location.Name,
+			Kind:  req.Kind,
+			Place: place(location),
+		}); err != nil {
+			switch {
+			case errors.Is(err, databasehandler.ErrSubscriptionNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			case errors.Is(err, databasehandler.ErrAlreadyConfirmed):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			case errors.Is(err, databasehandler.ErrRecentlySent):
+				c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{"status": "A new confirmation email is on its way."})
+	}
+}
+
+func unsubscribePage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "no-store")
+		c.HTML(http.StatusOK, "unsubscribe.html", gin.H{"Token": c.Param("token")})
+	}
+}
+
 func unsubscribe() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		email := c.Param("email")
+		token := c.Param("token")
 
-		if email == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Email is required"})
+		if token == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unsubscribe token is required"})
 			return
 		}
 
-		if err := databasehandler.DeleteSubscription(c.Request.Context(), email); err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		if err := databasehandler.Unsubscribe(c.Request.Context(), token); err != nil {
+			if errors.Is(err, databasehandler.ErrSubscriptionNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
 			return
 		}
 
@@ -192,37 +721,889 @@ func unsubscribe() gin.HandlerFunc {
 	}
 }
 
-func confirm() gin.HandlerFunc {
+// requestManagementToken emails the subscriber their management token. The
+// response is the same whether or not the address is subscribed.
+func requestManagementToken() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := c.Param("token")
-		if err := databasehandler.ConfirmSubscription(c.Request.Context(), token); err != nil {
+		var req struct {
+			Language string `json:"language"`
+		}
+		// The body is optional.
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := databasehandler.SendManagementToken(c.Request.Context(), c.Param("email"), req.Language); err != nil {
+			if errors.Is(err, databasehandler.ErrInvalidLanguage) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{"status": "If the address is subscribed, its management token has been emailed to it."})
+	}
+}
+
+// requireManagementToken only lets a request about a subscriber through with
+// their management token, sent as "Authorization: Bearer <token>".
+func requireManagementToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok {
+			token = ""
+		}
+
+		if err := databasehandler.AuthorizeSubscriber(c.Request.Context(), c.Param("email"), strings.TrimSpace(token)); err != nil {
+			if errors.Is(err, databasehandler.ErrUnauthorized) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			} else {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func listSubscriptions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		email := c.Param("email")
+
+		subscriptions, err := databasehandler.ListSubscriptions(c.Request.Context(), email)
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"status": "Subscription is confirmed"})
+		if subscriptions == nil {
+			subscriptions = []*models.Subscription{}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"email": email, "subscriptions": subscriptions})
 	}
 }
 
-func getWeather(weatherClient *weatherClient.APIClient) gin.HandlerFunc {
+func addSubscription(provider weatherProvider.WeatherProvider) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		city := c.Param("city")
-		weather, response, err := weatherClient.APIsApi.RealtimeWeather(c.Request.Context(), city, nil)
-		if err != nil && response != nil {
-			c.JSON(response.StatusCode, gin.H{"error": err.Error()})
+		var req struct {
+			locationRequest
+			Kind         models.SubscriptionKind      `json:"kind" binding:"omitempty,oneof=weather marine astronomy"`
+			Frequency    models.SubscriptionFrequency `json:"frequency" binding:"required,oneof=daily hourly custom"`
+			Schedule     string                       `json:"schedule" binding:"required_if=Frequency custom"`
+			DeliveryHour *int                         `json:"delivery_hour" binding:"omitempty,min=0,max=23"`
+			Language     string                       `json:"language"`
+			Channels     []models.ChannelKind         `json:"channels"`
+			Alerts       *alertsRequest               `json:"alerts"`
+			AirQuality   *airQualityRequest           `json:"air_quality"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		location, err := req.resolve(c, provider)
+		if err != nil {
+			respondLocationError(c, req.locationRequest, err)
+			return
+		}
+		if req.Kind == models.MarineKind {
+			if status, err := checkCoastal(c.Request.Context(), provider, location); err != nil {
+				c.JSON(status, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		_, err = databasehandler.CreateSubscription(c.Request.Context(), &models.Subscription{
+			Email:        c.Param("email"),
+			City:         location.Name,
+			Kind:         req.Kind,
+			Frequency:    req.Frequency,
+			Schedule:     req.Schedule,
+			Timezone:     location.Timezone,
+			Place:        place(location),
+			DeliveryHour: deliveryHour(req.DeliveryHour),
+			Language:     req.Language,
+			Channels:     req.Channels,
+			Alerts:       req.Alerts.preferences(),
+			AirQuality:   req.AirQuality.preferences(),
+		})
+		if err != nil {
+			if errors.Is(err, databasehandler.ErrSubscriptionExists) {
+				c.JSON(http.StatusConflict, gin.H{"error": "Subscription already exists"})
+			} else if isInvalidSubscription(err) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
 			return
 		}
 
-		c.JSON(http.StatusOK, weather)
+		c.JSON(http.StatusCreated, gin.H{
+			"status": "Subscription created successfully. Please check your email to confirm.",
+		})
 	}
 }
 
-// EmailService implements the EmailService interface
-type EmailService struct{}
+func removeSubscription() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription id"})
+			return
+		}
+
+		if err := databasehandler.RemoveSubscription(c.Request.Context(), c.Param("email"), uint(id)); err != nil {
+			if errors.Is(err, databasehandler.ErrSubscriptionNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
 
-func (s *EmailService) SendWeatherUpdate(ctx context.Context, email string, forecast *models.WeatherForecast) error {
-	// TODO: Implement actual email sending
-	log.Printf("Sending weather update to %s for %s: %.1f°C, %s",
-		email, forecast.City, forecast.Temperature, forecast.Description)
-	return nil
+		c.JSON(http.StatusOK, gin.H{"status": "Subscription is cancelled successfully"})
+	}
+}
+
+func confirm() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.Param("token")
+		if err := databasehandler.ConfirmSubscription(c.Request.Context(), token); err != nil {
+			switch {
+			case errors.Is(err, databasehandler.ErrTokenNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			case errors.Is(err, databasehandler.ErrTokenExpired):
+				c.JSON(http.StatusGone, gin.H{"error": "Confirmation token has expired, please request a new one"})
+			case errors.Is(err, databasehandler.ErrAlreadyConfirmed):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": "Subscription is confirmed"})
+	}
+}
+
+func getWeather(provider weatherProvider.WeatherProvider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		city := c.Param("city")
+		report, err := provider.Fetch(c.Request.Context(), weatherProvider.Query{Location: city})
+		if err != nil {
+			respondWeatherError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// historyResponse puts today's forecast next to the same date last year, the
+// past week and the requested range of past days.
+type historyResponse struct {
+	Location      weatherProvider.Location `json:"location"`
+	Today         weatherProvider.Day      `json:"today"`
+	LastYear      *weatherProvider.Day     `json:"last_year,omitempty"`
+	LastYearDelta *float64                 `json:"last_year_delta_c,omitempty"`
+	WeekAvgTempC  *float64                 `json:"week_avg_temp_c,omitempty"`
+	WeekDelta     *float64                 `json:"week_delta_c,omitempty"`
+	Summary       []string                 `json:"summary"`
+	From          string                   `json:"from"`
+	To            string                   `json:"to"`
+	Days          []weatherProvider.Day    `json:"days"`
+	Source        string                   `json:"source"`
+}
+
+// getWeatherHistory compares today's forecast with the past. from and to
+// (YYYY-MM-DD, in the location's timezone) pick the past days listed and
+// default to the week before today. The response is CSV with format=csv or
+// an Accept header asking for text/csv.
+func getWeatherHistory(provider weatherProvider.WeatherProvider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		historyProvider, ok := provider.(weatherProvider.HistoryProvider)
+		if !ok {
+			c.JSON(http.StatusNotImplemented, gin.H{"error": "weather history is not supported by the weather provider"})
+			return
+		}
+
+		city := c.Param("city")
+		report, err := provider.Fetch(c.Request.Context(), weatherProvider.Query{Location: city, Days: 1})
+		if err != nil {
+			respondWeatherError(c, err)
+			return
+		}
+		if len(report.Daily) == 0 {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "today's forecast is not available for this location"})
+			return
+		}
+		today := report.Daily[0]
+
+		from, to, custom, err := historyRange(c, today.Date)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		comparison, err := weatherProvider.Compare(c.Request.Context(), historyProvider, city, today)
+		if err != nil {
+			respondWeatherError(c, err)
+			return
+		}
+
+		days := comparison.Week
+		if custom {
+			history, err := historyProvider.History(c.Request.Context(), city, from, to)
+			if err != nil {
+				respondWeatherError(c, err)
+				return
+			}
+			days = history.Days
+		}
+		if days == nil {
+			days = []weatherProvider.Day{}
+		}
+
+		response := historyResponse{
+			Location:      report.Location,
+			Today:         today,
+			LastYear:      comparison.LastYear,
+			LastYearDelta: comparison.LastYearDelta,
+			WeekAvgTempC:  comparison.WeekAvgTempC,
+			WeekDelta:     comparison.WeekDelta,
+			Summary:       []string{},
+			From:          from.Format(time.DateOnly),
+			To:            to.Format(time.DateOnly),
+			Days:          days,
+			Source:        weatherProvider.Attribution(report),
+		}
+		if comparison.LastYearDelta != nil {
+			response.Summary = append(response.Summary, models.TemperatureDelta(*comparison.LastYearDelta, "last year"))
+		}
+		if comparison.WeekDelta != nil {
+			response.Summary = append(response.Summary, models.TemperatureDelta(*comparison.WeekDelta, "the past week"))
+		}
+
+		if c.Query("format") == "csv" || strings.Contains(c.GetHeader("Accept"), "text/csv") {
+			writeHistoryCSV(c, &response)
+			return
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// historyRange parses the from and to query parameters. Both default to the
+// week before today, and from to the week ending on a given to; custom
+// reports whether either was given.
+func historyRange(c *gin.Context, today time.Time) (from, to time.Time, custom bool, err error) {
+	to = today.AddDate(0, 0, -1)
+	from = today.AddDate(0, 0, -7)
+
+	for name, date := range map[string]*time.Time{"from": &from, "to": &to} {
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.ParseInLocation(time.DateOnly, value, today.Location())
+		if err != nil {
+			return from, to, false, fmt.Errorf("%s must be a date formatted as YYYY-MM-DD", name)
+		}
+		*date, custom = parsed, true
+	}
+	if c.Query("from") == "" && c.Query("to") != "" {
+		from = to.AddDate(0, 0, -6)
+	}
+
+	switch {
+	case !to.Before(today):
+		return from, to, false, errors.New("to must be before today")
+	case to.Before(from):
+		return from, to, false, errors.New("from must not be after to")
+	case from.AddDate(0, 0, weatherProvider.MaxHistoryDays-1).Before(to):
+		return from, to, false, fmt.Errorf("the range must not exceed %d days", weatherProvider.MaxHistoryDays)
+	}
+
+	return from, to, custom, nil
+}
+
+// writeHistoryCSV writes today's forecast, the same date last year and the
+// past days as CSV rows.
+func writeHistoryCSV(c *gin.Context, response *historyResponse) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="weather-history.csv"`)
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	row := func(period string, day weatherProvider.Day) []string {
+		return []string{
+			period,
+			day.Date.Format(time.DateOnly),
+			strconv.FormatFloat(day.MinTempC, 'f', 1, 64),
+			strconv.FormatFloat(day.MaxTempC, 'f', 1, 64),
+			strconv.FormatFloat(day.AvgTempC, 'f', 1, 64),
+			strconv.FormatFloat(day.TotalPrecipMm, 'f', 1, 64),
+			strconv.FormatFloat(day.MaxWindKph, 'f', 1, 64),
+			day.Description,
+		}
+	}
+
+	w.Write([]string{"period", "date", "min_temp_c", "max_temp_c", "avg_temp_c", "total_precip_mm", "max_wind_kph", "description"})
+	w.Write(row("today", response.Today))
+	if response.LastYear != nil {
+		w.Write(row("last_year", *response.LastYear))
+	}
+	for _, day := range response.Days {
+		w.Write(row("history", day))
+	}
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		log.Printf("Error writing weather history CSV: %v", err)
+	}
+}
+
+// minSearchLength avoids searching for every place starting with a letter.
+const minSearchLength = 2
+
+func searchLocations(provider weatherProvider.WeatherProvider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := strings.TrimSpace(c.Query("q"))
+		if len([]rune(query)) < minSearchLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("q must have at least %d characters", minSearchLength)})
+			return
+		}
+
+		locations, err := provider.Search(c.Request.Context(), query)
+		if err != nil {
+			respondWeatherError(c, err)
+			return
+		}
+		if locations == nil {
+			locations = []weatherProvider.Location{}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"locations": locations})
+	}
+}
+
+// respondWeatherError maps a weather provider error to the HTTP response.
+func respondWeatherError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, weatherProvider.ErrLocationNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, weatherClient.ErrCircuitOpen):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusBadGateway, gin.H{"error": "weather service unavailable"})
+	}
+}
+
+func getAirQuality(provider weatherProvider.WeatherProvider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scale, ok := models.ParseAQIScale(c.DefaultQuery("scale", string(models.AQIScaleEPA)))
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "scale must be 'epa' or 'defra'"})
+			return
+		}
+
+		report, err := provider.Fetch(c.Request.Context(), weatherProvider.Query{Location: c.Param("city"), AirQuality: true})
+		if err != nil {
+			respondWeatherError(c, err)
+			return
+		}
+		if report.AirQuality == nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "air quality is not available for this location"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"location":    report.Location,
+			"air_quality": models.AirQualityFromReport(scale, report.AirQuality),
+			"source":      weatherProvider.Attribution(report),
+		})
+	}
+}
+
+// maxMarineDays is the longest marine forecast the sources provide.
+const maxMarineDays = 7
+
+func getMarine(provider weatherProvider.WeatherProvider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		days, err := strconv.Atoi(c.DefaultQuery("days", "1"))
+		if err != nil || days < 1 || days > maxMarineDays {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("days must be between 1 and %d", maxMarineDays)})
+			return
+		}
+
+		marine, ok := provider.(weatherProvider.MarineProvider)
+		if !ok {
+			c.JSON(http.StatusNotImplemented, gin.H{"error": "marine forecasts are not supported by the weather provider"})
+			return
+		}
+
+		location := c.Param("location")
+		report, err := marine.Marine(c.Request.Context(), weatherProvider.Query{Location: location, Days: days})
+		if err != nil {
+			if errors.Is(err, weatherProvider.ErrNotCoastal) {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("%q is not a coastal location; there is no marine forecast for it", location)})
+				return
+			}
+			respondWeatherError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// Bounds of the observation analytics. Ranges cover at most
+// maxObservationDays; rolling averages and anomaly baselines look back up to
+// maxObservationWindow days before the range.
+const (
+	defaultObservationDays = 30
+	maxObservationDays     = 366
+	defaultRollingWindow   = 7
+	defaultAnomalyWindow   = 30
+	defaultAnomalyZScore   = 2.0
+	maxObservationWindow   = 90
+)
+
+// getDailyObservations returns the daily minimum, maximum and mean
+// temperature archived for a city.
+func getDailyObservations() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, to, ok := observationRange(c)
+		if !ok {
+			return
+		}
+
+		days, ok := dailyObservations(c, from, to)
+		if !ok {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"city": c.Param("city"), "from": from.Format(time.DateOnly), "to": to.Format(time.DateOnly), "days": days})
+	}
+}
+
+// getRollingAverages returns, for each day of the range, the mean temperature
+// over the window of days ending on it.
+func getRollingAverages() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		window, ok := observationWindow(c, defaultRollingWindow)
+		if !ok {
+			return
+		}
+		from, to, ok := observationRange(c)
+		if !ok {
+			return
+		}
+
+		days, ok := dailyObservations(c, from.AddDate(0, 0, -window+1), to)
+		if !ok {
+			return
+		}
+
+		averages := []models.RollingAverage{}
+		for _, average := range models.RollingAverages(days, window) {
+			if !average.Date.Before(from) {
+				averages = append(averages, average)
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"city": c.Param("city"), "window": window, "from": from.Format(time.DateOnly), "to": to.Format(time.DateOnly), "days": averages})
+	}
+}
+
+// getTemperatureAnomalies returns the days of the range whose mean
+// temperature departs from the window of days before them by at least
+// threshold standard deviations.
+func getTemperatureAnomalies() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		window, ok := observationWindow(c, defaultAnomalyWindow)
+		if !ok {
+			return
+		}
+		threshold, err := strconv.ParseFloat(c.DefaultQuery("threshold", strconv.FormatFloat(defaultAnomalyZScore, 'f', -1, 64)), 64)
+		if err != nil || threshold <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "threshold must be a positive number of standard deviations"})
+			return
+		}
+		from, to, ok := observationRange(c)
+		if !ok {
+			return
+		}
+
+		days, ok := dailyObservations(c, from.AddDate(0, 0, -window), to)
+		if !ok {
+			return
+		}
+
+		anomalies := []models.TemperatureAnomaly{}
+		for _, anomaly := range models.Anomalies(days, window, threshold) {
+			if !anomaly.Date.Before(from) {
+				anomalies = append(anomalies, anomaly)
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"city": c.Param("city"), "window": window, "threshold": threshold, "from": from.Format(time.DateOnly), "to": to.Format(time.DateOnly), "anomalies": anomalies})
+	}
+}
+
+// observationRange parses the from and to dates (YYYY-MM-DD) of an analytics
+// request, defaulting to the last defaultObservationDays days. It responds
+// with 400 and returns false if they are invalid.
+func observationRange(c *gin.Context) (from, to time.Time, ok bool) {
+	now := time.Now().UTC()
+	to = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	from = to.AddDate(0, 0, -defaultObservationDays+1)
+
+	for name, date := range map[string]*time.Time{"from": &from, "to": &to} {
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s must be a date formatted as YYYY-MM-DD", name)})
+			return from, to, false
+		}
+		*date = parsed
+	}
+
+	switch {
+	case to.Before(from):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must not be after to"})
+		return from, to, false
+	case from.AddDate(0, 0, maxObservationDays-1).Before(to):
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("the range must not exceed %d days", maxObservationDays)})
+		return from, to, false
+	}
+
+	return from, to, true
+}
+
+// observationWindow parses the window query parameter, in days.
+func observationWindow(c *gin.Context, defaultWindow int) (int, bool) {
+	window, err := strconv.Atoi(c.DefaultQuery("window", strconv.Itoa(defaultWindow)))
+	if err != nil || window < 2 || window > maxObservationWindow {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("window must be between 2 and %d days", maxObservationWindow)})
+		return 0, false
+	}
+
+	return window, true
+}
+
+// dailyObservations aggregates the archived observations of the requested
+// city, narrowed down by the optional country query parameter for places
+// sharing a name. It responds with 500 and returns false on failure.
+func dailyObservations(c *gin.Context, from, to time.Time) ([]models.DailyObservations, bool) {
+	cityKey := weatherProvider.LocationKey(c.Param("city"))
+	days, err := databasehandler.DailyObservations(c.Request.Context(), cityKey, c.Query("country"), from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if days == nil {
+		days = []models.DailyObservations{}
+	}
+
+	return days, true
+}
+
+func updateAlerts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription id"})
+			return
+		}
+
+		var req alertsRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := databasehandler.UpdateAlertPreferences(c.Request.Context(), c.Param("email"), uint(id), req.preferences()); err != nil {
+			switch {
+			case errors.Is(err, databasehandler.ErrSubscriptionNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			case errors.Is(err, databasehandler.ErrInvalidAlertPreferences):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": "Alert preferences updated"})
+	}
+}
+
+func listRules() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription id"})
+			return
+		}
+
+		rules, err := databasehandler.ListRules(c.Request.Context(), c.Param("email"), uint(id))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if rules == nil {
+			rules = []*models.NotificationRule{}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"subscription_id": id, "rules": rules})
+	}
+}
+
+func createRule() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription id"})
+			return
+		}
+
+		var req struct {
+			Field          models.RuleField      `json:"field" binding:"required"`
+			Comparator     models.RuleComparator `json:"comparator" binding:"required,oneof=gt gte lt lte"`
+			Threshold      *float64              `json:"threshold" binding:"required"`
+			LookaheadHours int                   `json:"lookahead_hours" binding:"min=0"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		rule := &models.NotificationRule{
+			SubscriptionID: uint(id),
+			Field:          req.Field,
+			Comparator:     req.Comparator,
+			Threshold:      *req.Threshold,
+			LookaheadHours: req.LookaheadHours,
+		}
+		if err := databasehandler.CreateRule(c.Request.Context(), c.Param("email"), rule); err != nil {
+			switch {
+			case errors.Is(err, databasehandler.ErrInvalidRule):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			case errors.Is(err, databasehandler.ErrSubscriptionNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		c.JSON(http.StatusCreated, rule)
+	}
+}
+
+func deleteRule() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription id"})
+			return
+		}
+		ruleID, err := strconv.ParseUint(c.Param("ruleId"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule id"})
+			return
+		}
+
+		if err := databasehandler.DeleteRule(c.Request.Context(), c.Param("email"), uint(id), uint(ruleID)); err != nil {
+			if errors.Is(err, databasehandler.ErrRuleNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": "Rule deleted"})
+	}
+}
+
+func updateAirQuality() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription id"})
+			return
+		}
+
+		var req airQualityRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := databasehandler.UpdateAirQualityPreferences(c.Request.Context(), c.Param("email"), uint(id), req.preferences()); err != nil {
+			switch {
+			case errors.Is(err, databasehandler.ErrSubscriptionNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			case errors.Is(err, databasehandler.ErrInvalidAirQualityPreferences):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": "Air quality preferences updated"})
+	}
+}
+
+func listChannels() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		channels, err := databasehandler.ListChannels(c.Request.Context(), c.Param("email"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if channels == nil {
+			channels = []*models.DeliveryChannel{}
+		}
+		c.JSON(http.StatusOK, channels)
+	}
+}
+
+// createChannel registers a webhook, Slack or Telegram channel and sends the
+// link that confirms it over the channel itself. A webhook's signing secret
+// is only ever returned here.
+func createChannel() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Kind     models.ChannelKind `json:"kind" binding:"required,oneof=webhook slack telegram"`
+			Target   string             `json:"target" binding:"required"`
+			Secret   string             `json:"secret"`
+			Language string             `json:"language"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !fanout.Supports(req.Kind) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s channels are not configured on this server", req.Kind)})
+			return
+		}
+
+		channel := &models.DeliveryChannel{
+			Kind:   req.Kind,
+			Target: req.Target,
+			Secret: req.Secret,
+		}
+		if err := databasehandler.CreateChannel(c.Request.Context(), c.Param("email"), req.Language, channel); err != nil {
+			switch {
+			case errors.Is(err, databasehandler.ErrInvalidChannel), errors.Is(err, databasehandler.ErrInvalidLanguage):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			case errors.Is(err, databasehandler.ErrSubscriberNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			case errors.Is(err, databasehandler.ErrChannelExists):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		response := gin.H{
+			"status":  "Channel created successfully. Please confirm it with the link sent to it.",
+			"channel": channel,
+		}
+		if channel.Kind == models.WebhookChannel {
+			response["secret"] = channel.Secret
+		}
+		c.JSON(http.StatusCreated, response)
+	}
+}
+
+func deleteChannel() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid channel id"})
+			return
+		}
+
+		if err := databasehandler.DeleteChannel(c.Request.Context(), c.Param("email"), uint(id)); err != nil {
+			if errors.Is(err, databasehandler.ErrChannelNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": "Channel deleted"})
+	}
+}
+
+func confirmChannel() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := databasehandler.ConfirmChannel(c.Request.Context(), c.Param("token")); err != nil {
+			switch {
+			case errors.Is(err, databasehandler.ErrTokenNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			case errors.Is(err, databasehandler.ErrChannelConfirmed):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": "Channel is confirmed"})
+	}
+}
+
+// updateSubscriptionChannels chooses the kinds of channels a subscription is
+// delivered to, e.g. ["email", "telegram"].
+func updateSubscriptionChannels() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription id"})
+			return
+		}
+
+		var req struct {
+			Channels []models.ChannelKind `json:"channels" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		channels, err := databasehandler.UpdateSubscriptionChannels(c.Request.Context(), c.Param("email"), uint(id), req.Channels)
+		if err != nil {
+			switch {
+			case errors.Is(err, databasehandler.ErrSubscriptionNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			case errors.Is(err, databasehandler.ErrInvalidChannel):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": "Subscription channels updated", "channels": channels})
+	}
 }